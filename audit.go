@@ -0,0 +1,282 @@
+package kfnetwork
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// RedactedValue - Replaces the value of any packet field tagged
+// `audit:"redact"` in audit and debug logs.
+const RedactedValue = "[REDACTED]"
+
+// AuditDirection - Whether an audited packet was received or sent.
+type AuditDirection string
+
+const (
+	// AuditInbound - A packet the server received from a client.
+	AuditInbound AuditDirection = "in"
+	// AuditOutbound - A packet the server sent to a client.
+	AuditOutbound AuditDirection = "out"
+)
+
+// AuditConfiguration - Settings for the packet audit log. When Enabled is
+// false only the players listed are audited.
+type AuditConfiguration struct {
+	Enabled bool                   `json:"enabled"`
+	Players []string               `json:"players,omitempty"`
+	Sinks   []LogSinkConfiguration `json:"sinks"`
+}
+
+// DefaultAuditConfiguration - Audits nobody, writing JSON lines to stderr
+// once someone is switched on.
+func DefaultAuditConfiguration() AuditConfiguration {
+	config := AuditConfiguration{}
+	config.Sinks = []LogSinkConfiguration{{Type: "stderr", Format: LogFormatJSON}}
+	return config
+}
+
+// AuditLog - Records the traffic between the server and its clients, in both
+// directions, with sensitive fields redacted. Auditing can be switched on for
+// everyone or just for the players being debugged.
+type AuditLog struct {
+	auditMutex sync.RWMutex
+	logger     *LogManager
+	all        bool
+	players    map[string]bool
+}
+
+// NewAuditLog - Returns a pointer to a new audit log writing through the
+// given logger. Nothing is audited until it is switched on.
+func NewAuditLog(logger *LogManager) *AuditLog {
+	audit := new(AuditLog)
+	audit.logger = logger.Subsystem("audit")
+	audit.players = make(map[string]bool)
+	return audit
+}
+
+// NewAuditLogFromConfig - Returns an audit log with its own logger, writing
+// to the sinks described by the configuration.
+func NewAuditLogFromConfig(config AuditConfiguration) (*AuditLog, error) {
+	logger, e := NewLogManagerFromConfig(config.logConfiguration())
+
+	if e != nil {
+		return nil, e
+	}
+
+	audit := NewAuditLog(logger)
+	audit.SetEnabled(config.Enabled)
+
+	for _, id := range config.Players {
+		audit.EnablePlayer(id)
+	}
+
+	return audit, nil
+}
+
+// Configure - Applies a new audit configuration, replacing the sinks and
+// the list of audited players.
+func (a *AuditLog) Configure(config AuditConfiguration) error {
+	sinks, e := config.logConfiguration().OpenSinks()
+
+	if e != nil {
+		return e
+	}
+
+	a.configure(config, sinks)
+	return nil
+}
+
+// configure - Applies an audit configuration whose sinks have already been
+// opened.
+func (a *AuditLog) configure(config AuditConfiguration, sinks []LogSink) {
+	a.logger.configure(config.logConfiguration(), sinks)
+
+	a.auditMutex.Lock()
+	defer a.auditMutex.Unlock()
+
+	a.all = config.Enabled
+	a.players = make(map[string]bool)
+
+	for _, id := range config.Players {
+		a.players[id] = true
+	}
+}
+
+// logConfiguration - The configuration of the logger audit entries are
+// written through.
+func (c AuditConfiguration) logConfiguration() LogConfiguration {
+	return LogConfiguration{Level: LogLevelInfo, Sinks: c.Sinks}
+}
+
+// SetEnabled - Switches auditing on or off for every player.
+func (a *AuditLog) SetEnabled(enabled bool) {
+	a.auditMutex.Lock()
+	defer a.auditMutex.Unlock()
+
+	a.all = enabled
+}
+
+// EnablePlayer - Switches auditing on for the player with the given ID.
+func (a *AuditLog) EnablePlayer(id string) {
+	a.auditMutex.Lock()
+	defer a.auditMutex.Unlock()
+
+	a.players[id] = true
+}
+
+// DisablePlayer - Switches auditing off for the player with the given ID.
+func (a *AuditLog) DisablePlayer(id string) {
+	a.auditMutex.Lock()
+	defer a.auditMutex.Unlock()
+
+	delete(a.players, id)
+}
+
+// Active - Determine whether anyone at all is being audited.
+func (a *AuditLog) Active() bool {
+	a.auditMutex.RLock()
+	defer a.auditMutex.RUnlock()
+
+	return a.all || len(a.players) > 0
+}
+
+// Auditing - Determine whether traffic for the given player is audited. A
+// nil player is a connection which has not logged in yet, and is only
+// audited when auditing is on for everyone.
+func (a *AuditLog) Auditing(player *Player) bool {
+	a.auditMutex.RLock()
+	defer a.auditMutex.RUnlock()
+
+	if a.all {
+		return true
+	}
+
+	return player != nil && a.players[player.ID]
+}
+
+// Record - Writes an entry for a packet if its player is being audited.
+func (a *AuditLog) Record(direction AuditDirection, client Connection, player *Player, packet Packet) {
+	if !a.Auditing(player) {
+		return
+	}
+
+	header := packet.GetHeader()
+	fields := Fields{
+		"direction":   string(direction),
+		"packet_type": header.Type,
+		"sequence":    header.Sequence,
+	}
+
+	if client != nil && client.RemoteAddr() != nil {
+		fields["remote_addr"] = client.RemoteAddr().String()
+	}
+
+	if player != nil {
+		fields["player_id"] = player.ID
+		fields["player_name"] = player.Name
+	}
+
+	payload, e := RedactPacket(packet)
+
+	if e != nil {
+		fields["error"] = e.Error()
+	} else {
+		fields["payload"] = payload
+	}
+
+	if direction == AuditInbound {
+		a.logger.Info("Packet received.", fields)
+	} else {
+		a.logger.Info("Packet sent.", fields)
+	}
+}
+
+// Flush - Blocks until every entry recorded so far has been written.
+func (a *AuditLog) Flush() {
+	a.logger.Flush()
+}
+
+// Close - Writes out anything still queued and closes the audit sinks.
+func (a *AuditLog) Close() error {
+	return a.logger.Close()
+}
+
+// RedactPacket - Returns the packet's JSON payload as an object with every
+// field tagged `audit:"redact"` replaced by RedactedValue.
+func RedactPacket(packet Packet) (map[string]interface{}, error) {
+	payload, e := GetPacketPayload(packet)
+
+	if e != nil {
+		return nil, e
+	}
+
+	object := make(map[string]interface{})
+	e = json.Unmarshal(payload, &object)
+
+	if e != nil {
+		return nil, e
+	}
+
+	for _, name := range redactedFields(reflect.TypeOf(packet)) {
+		if _, ok := object[name]; ok {
+			object[name] = RedactedValue
+		}
+	}
+
+	return object, nil
+}
+
+// RedactedPacketPayload - Same as GetPacketPayload, but with sensitive
+// fields redacted.
+func RedactedPacketPayload(packet Packet) ([]byte, error) {
+	object, e := RedactPacket(packet)
+
+	if e != nil {
+		return nil, e
+	}
+
+	return json.Marshal(object)
+}
+
+var redactedFieldCache sync.Map
+
+// redactedFields - Returns the JSON names of the fields tagged for
+// redaction, including those of embedded structs.
+func redactedFields(packetType reflect.Type) []string {
+	for packetType.Kind() == reflect.Ptr {
+		packetType = packetType.Elem()
+	}
+
+	if cached, ok := redactedFieldCache.Load(packetType); ok {
+		return cached.([]string)
+	}
+
+	names := []string{}
+
+	if packetType.Kind() == reflect.Struct {
+		for i := 0; i < packetType.NumField(); i++ {
+			field := packetType.Field(i)
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+
+			if field.Anonymous && name == "" {
+				names = append(names, redactedFields(field.Type)...)
+				continue
+			}
+
+			if field.Tag.Get("audit") != "redact" || name == "-" {
+				continue
+			}
+
+			if name == "" {
+				name = field.Name
+			}
+
+			names = append(names, name)
+		}
+	}
+
+	redactedFieldCache.Store(packetType, names)
+	return names
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"math/rand"
 	"os"
+	"sort"
 	"strings"
 )
 
@@ -32,6 +33,9 @@ type Card struct {
 	IsStunned   bool   `json:"-"`
 	PowerBonus  int    `json:"-"`
 	ArmorBonus  int    `json:"-"`
+
+	// text - The parsed card text, filled in by the card database.
+	text *CardText
 }
 
 // Stun - Mark a creature card as stunned.
@@ -66,76 +70,48 @@ func (c *Card) PrettyPrint() {
 
 // GetActionCards - Return all action cards from a given pile.
 func GetActionCards(cards []Card) []Card {
-	actions := []Card{}
-
-	for _, card := range cards {
-		if strings.ToLower(card.CardType) == "action" {
-			actions = append(actions, card)
-		}
-	}
-
-	return actions
+	query := NewCardQuery()
+	query.SetTypes("action")
+	return filterPile(cards, query)
 }
 
 // GetArtifactCards - Return all artifact cards from a given pile.
 func GetArtifactCards(cards []Card) []Card {
-	artifacts := []Card{}
-
-	for _, card := range cards {
-		if strings.ToLower(card.CardType) == "artifact" {
-			artifacts = append(artifacts, card)
-		}
-	}
-
-	return artifacts
+	query := NewCardQuery()
+	query.SetTypes("artifact")
+	return filterPile(cards, query)
 }
 
 // GetCreatureCards - Return all creature cards from a given pile.
 func GetCreatureCards(cards []Card) []Card {
-	creatures := []Card{}
-
-	for _, card := range cards {
-		if strings.ToLower(card.CardType) == "creature" {
-			creatures = append(creatures, card)
-		}
-	}
-
-	return creatures
+	query := NewCardQuery()
+	query.SetTypes("creature")
+	return filterPile(cards, query)
 }
 
 // GetUpgradeCards - Return all upgrade cards from a given pile.
 func GetUpgradeCards(cards []Card) []Card {
-	upgrades := []Card{}
-
-	for _, card := range cards {
-		if strings.ToLower(card.CardType) == "upgrade" {
-			upgrades = append(upgrades, card)
-		}
-	}
-
-	return upgrades
+	query := NewCardQuery()
+	query.SetTypes("upgrade")
+	return filterPile(cards, query)
 }
 
 // FindCardByID - Find a card in a pile given a card ID.
 func FindCardByID(cards []Card, cardID string) (Card, error) {
-	for _, card := range cards {
-		if card.ID == cardID {
-			return card, nil
-		}
+	matches, e := FindCardsByID(cards, cardID)
+
+	if e != nil {
+		return Card{}, fmt.Errorf("no card found with ID %s", cardID)
 	}
-	errorMessage := fmt.Sprintf("no card found with ID %s", cardID)
-	return Card{}, errors.New(errorMessage)
+
+	return matches[0], nil
 }
 
 // FindCardsByID - Find a cards in a pile given a card ID.
 func FindCardsByID(cards []Card, cardID string) ([]Card, error) {
-	totalCards := []Card{}
-
-	for _, card := range cards {
-		if card.ID == cardID {
-			totalCards = append(totalCards, card)
-		}
-	}
+	query := NewCardQuery()
+	query.SetID(cardID)
+	totalCards := filterPile(cards, query)
 
 	if len(totalCards) == 0 {
 		errorMessage := fmt.Sprintf("no cards found with ID %s", cardID)
@@ -148,26 +124,23 @@ func FindCardsByID(cards []Card, cardID string) ([]Card, error) {
 // FindCardByNumber - Find a card in a pile given a set and card number.
 // This ends up being useful mostly for detecting mavericks in a pile.
 func FindCardByNumber(cards []Card, setNumber int, cardNumber int) (Card, error) {
-	for _, card := range cards {
-		if card.CardNumber == cardNumber && card.Expansion == setNumber {
-			return card, nil
-		}
+	matches, e := FindCardsByNumber(cards, setNumber, cardNumber)
+
+	if e != nil {
+		return Card{}, e
 	}
-	errorMessage := fmt.Sprintf("no card found with set #%d and card #%d", setNumber, cardNumber)
-	return Card{}, errors.New(errorMessage)
+
+	return matches[0], nil
 }
 
 // FindCardsByNumber - Find cards in a pile given a set and card number.
 // This ends up being useful mostly for detecting mavericks in a pile since
 // mavericks are assigned unique card IDs in the Vault.
 func FindCardsByNumber(cards []Card, setNumber int, cardNumber int) ([]Card, error) {
-	totalCards := []Card{}
-
-	for _, card := range cards {
-		if card.CardNumber == cardNumber && card.Expansion == setNumber {
-			totalCards = append(totalCards, card)
-		}
-	}
+	query := NewCardQuery()
+	query.SetExpansion(setNumber)
+	query.SetNumber(cardNumber)
+	totalCards := filterPile(cards, query)
 
 	if len(totalCards) == 0 {
 		errorMessage := fmt.Sprintf("no card found with set #%d and card #%d", setNumber, cardNumber)
@@ -177,6 +150,14 @@ func FindCardsByNumber(cards []Card, setNumber int, cardNumber int) ([]Card, err
 	return totalCards, nil
 }
 
+// filterPile - Returns the cards in a pile matching the query, in the order
+// they appear in the pile.
+func filterPile(cards []Card, query *CardQuery) []Card {
+	query.SetSort(CardSortPile, false)
+	matches, _ := query.Filter(cards)
+	return matches
+}
+
 // GetTotalAmber - Count the amount of amber in a given card pile. This
 // function only calculates the total number of amber icons in a card
 // pile; it will not calculate gained/stolen amber based on board state.
@@ -246,13 +227,9 @@ func GetMinimumCreaturePower(cards []Card) int {
 
 // FindCardsByHouse - Return an array of cards filtered by house name.
 func FindCardsByHouse(cards []Card, house string) ([]Card, error) {
-	totalCards := []Card{}
-
-	for _, card := range cards {
-		if strings.ToLower(house) == strings.ToLower(card.House) {
-			totalCards = append(totalCards, card)
-		}
-	}
+	query := NewCardQuery()
+	query.SetHouses(house)
+	totalCards := filterPile(cards, query)
 
 	if len(totalCards) == 0 {
 		errorMessage := fmt.Sprintf("no card found with house %s", house)
@@ -378,20 +355,16 @@ func PrependCard(cards []Card, card Card) []Card {
 	return newCards
 }
 
+// SortCardsByNumber - Sorts cards by expansion, in release order, and then
+// by card number within each expansion.
 func SortCardsByNumber(cards []Card) []Card {
-	size := len(cards)
-
-	if size < 1 {
-		return cards
-	}
-
-	for !BubbleSortByExpansionNumber(cards) {
-		BubbleSortByExpansionNumber(cards)
-	}
+	sort.SliceStable(cards, func(i, j int) bool {
+		if cards[i].Expansion != cards[j].Expansion {
+			return DefaultExpansions.Less(cards[i].Expansion, cards[j].Expansion)
+		}
 
-	for !BubbleSortByCardNumber(cards) {
-		BubbleSortByCardNumber(cards)
-	}
+		return cards[i].CardNumber < cards[j].CardNumber
+	})
 
 	return cards
 }
@@ -422,6 +395,8 @@ func BubbleSortByCardNumber(cards []Card) bool {
 	return sorted
 }
 
+// BubbleSortByExpansionNumber - Makes one pass putting cards in the release
+// order of their expansions, returning true if they already were.
 func BubbleSortByExpansionNumber(cards []Card) bool {
 	sorted := true
 
@@ -439,7 +414,7 @@ func BubbleSortByExpansionNumber(cards []Card) bool {
 		// If our left-most value is greater than our right-most value then
 		// swap them. Mark the sorted variable to false to perform another
 		// pass over the slice.
-		if cards[i].Expansion > cards[i+1].Expansion {
+		if DefaultExpansions.Less(cards[i+1].Expansion, cards[i].Expansion) {
 			cards[i], cards[i+1] = cards[i+1], cards[i]
 			sorted = false
 		}
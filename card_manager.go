@@ -1,128 +1,554 @@
 package kfnetwork
 
 import (
-	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 )
 
-type CardQuery struct {
-	id        string
-	number    int
-	expansion int
+// CardManager - The card database. It is safe for concurrent use. Cards are
+// indexed by ID, by
+// expansion and number, and by house, type, rarity, trait and the words of
+// their text, so queries only look at the cards which can match.
+type CardManager struct {
+	cardMutex sync.RWMutex
+	cards     []Card
+	ids       map[string]int
+	numbers   map[cardNumber][]int
+	houses    map[string][]int
+	types     map[string][]int
+	rarities  map[string][]int
+	traits    map[string][]int
+	words     map[string][]int
+	titles    map[string][]int
+
+	// duplicates - Cards dropped from the last load because a card with the
+	// same ID was loaded before them.
+	duplicates []Card
+	// origins - The file each card was loaded from, by position, or an
+	// empty string for cards learned since.
+	origins []string
 }
 
-func NewCardQuery() *CardQuery {
-	cardQuery := new(CardQuery)
-	return cardQuery
+// cardNumber - Identifies a card within an expansion. Mavericks share the
+// number of the usual version of the card.
+type cardNumber struct {
+	expansion int
+	number    int
 }
 
-type CardManager struct {
-	cards []Card
+// CardSearchResult - A page of cards from a query, along with the number of
+// cards matching it across every page.
+type CardSearchResult struct {
+	Total int
+	Cards []Card
 }
 
 func NewCardManager() *CardManager {
 	cardManager := new(CardManager)
+	cardManager.reset()
 	return cardManager
 }
 
-func (q *CardQuery) ID() string {
-	return q.id
+// reset - Empties the database and its indexes. The caller must hold the
+// write lock.
+func (c *CardManager) reset() {
+	c.cards = nil
+	c.ids = make(map[string]int)
+	c.numbers = make(map[cardNumber][]int)
+	c.houses = make(map[string][]int)
+	c.types = make(map[string][]int)
+	c.rarities = make(map[string][]int)
+	c.traits = make(map[string][]int)
+	c.words = make(map[string][]int)
+	c.titles = make(map[string][]int)
+	c.duplicates = nil
+	c.origins = nil
 }
 
-func (q *CardQuery) SetID(id string) {
-	q.id = id
+// LoadFromFile - Replaces the cards with those in a JSON file.
+func (c *CardManager) LoadFromFile(location string) error {
+	return c.LoadFromPaths(location)
 }
 
-func (q *CardQuery) Number() int {
-	return q.number
+// LoadFromPaths - Replaces the cards with those in the given JSON files and
+// directories, where every .json file in a directory is read in name order.
+// A card found in more than one file is taken from the first. Nothing is
+// replaced unless every file can be read.
+func (c *CardManager) LoadFromPaths(paths ...string) error {
+	files := []string{}
+
+	for _, path := range paths {
+		info, e := os.Stat(path)
+
+		if e != nil {
+			return e
+		}
+
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		matches, e := filepath.Glob(filepath.Join(path, "*.json"))
+
+		if e != nil {
+			return e
+		}
+
+		sort.Strings(matches)
+		files = append(files, matches...)
+	}
+
+	loaded := [][]Card{}
+
+	for _, file := range files {
+		data, e := ioutil.ReadFile(file)
+
+		if e != nil {
+			return e
+		}
+
+		cards := []Card{}
+		e = json.Unmarshal(data, &cards)
+
+		if e != nil {
+			return fmt.Errorf("%s: %s", file, e.Error())
+		}
+
+		loaded = append(loaded, cards)
+	}
+
+	c.cardMutex.Lock()
+	defer c.cardMutex.Unlock()
+
+	c.reset()
+
+	for i, cards := range loaded {
+		origin := filepath.Clean(files[i])
+
+		for _, card := range cards {
+			if _, ok := c.ids[card.ID]; ok {
+				c.duplicates = append(c.duplicates, card)
+				continue
+			}
+
+			c.merge([]Card{card}, origin)
+		}
+	}
+
+	return nil
 }
 
-func (q *CardQuery) SetNumber(number int) {
-	q.number = number
+// Count - Returns how many cards are loaded.
+func (c *CardManager) Count() int {
+	c.cardMutex.RLock()
+	defer c.cardMutex.RUnlock()
+
+	return len(c.cards)
 }
 
-func (q *CardQuery) Expansion() int {
-	return q.expansion
+// Cards - Returns a copy of every card.
+func (c *CardManager) Cards() []Card {
+	c.cardMutex.RLock()
+	defer c.cardMutex.RUnlock()
+
+	return append([]Card(nil), c.cards...)
 }
 
-func (q *CardQuery) SetExpansion(expansion int) {
-	q.expansion = expansion
+// Merge - Adds the cards which aren't known yet, going by their Vault ID,
+// and returns how many were added. Mavericks have IDs of their own, so they
+// are learned alongside the usual version of the card.
+func (c *CardManager) Merge(cards []Card) int {
+	c.cardMutex.Lock()
+	defer c.cardMutex.Unlock()
+
+	return c.merge(cards, "")
 }
 
-func (c *CardManager) LoadFromFile(location string) error {
-	cards := []Card{}
-	buffer := bytes.Buffer{}
+// Unknown - Returns the cards the database doesn't have yet, going by their
+// Vault ID in the same way as Merge.
+func (c *CardManager) Unknown(cards []Card) []Card {
+	c.cardMutex.RLock()
+	defer c.cardMutex.RUnlock()
 
-	file, e := os.Open(location)
+	unknown := []Card{}
 
-	if e != nil {
-		return e
+	for _, card := range cards {
+		if _, ok := c.ids[card.ID]; !ok && card.ID != "" {
+			unknown = append(unknown, card)
+		}
 	}
 
-	buffer.ReadFrom(file)
+	return unknown
+}
+
+// Clone - Returns a copy of the database which can be changed without
+// affecting this one.
+func (c *CardManager) Clone() *CardManager {
+	c.cardMutex.RLock()
+	defer c.cardMutex.RUnlock()
 
-	if e != nil {
-		return e
+	clone := NewCardManager()
+	clone.cards = append([]Card(nil), c.cards...)
+	clone.origins = append([]string(nil), c.origins...)
+	clone.duplicates = append([]Card(nil), c.duplicates...)
+
+	for position, card := range clone.cards {
+		clone.index(card, position)
 	}
 
-	e = json.Unmarshal(buffer.Bytes(), &cards)
+	return clone
+}
+
+// merge - Adds unseen cards, noting the file they came from. The caller
+// must hold the write lock.
+func (c *CardManager) merge(cards []Card, origin string) int {
+	added := 0
+
+	for _, card := range cards {
+		if _, ok := c.ids[card.ID]; ok || card.ID == "" {
+			continue
+		}
+
+		// Game state doesn't belong in the database.
+		card.IsExhausted = false
+		card.IsStunned = false
+		card.PowerBonus = 0
+		card.ArmorBonus = 0
+		card.text = ParseCardText(card.CardText)
 
-	if e != nil {
-		return e
+		c.index(card, len(c.cards))
+		c.cards = append(c.cards, card)
+		c.origins = append(c.origins, origin)
+		added++
 	}
 
-	return nil
+	return added
 }
 
+// WriteToFile - Saves the cards loaded from the file at location, along
+// with every card learned since, as a JSON file. Cards loaded from other
+// files are left to them, so they aren't copied in and loaded twice. The
+// file is written through a temporary file so a crash never leaves a half
+// written database behind.
 func (c *CardManager) WriteToFile(location string) error {
-	bytes, e := json.MarshalIndent(c.cards, "", "    ")
+	c.cardMutex.RLock()
+	defer c.cardMutex.RUnlock()
 
-	if e != nil {
-		return e
+	location = filepath.Clean(location)
+	cards := []Card{}
+
+	for i, card := range c.cards {
+		if c.origins[i] == "" || c.origins[i] == location {
+			cards = append(cards, card)
+		}
 	}
 
-	file, e := os.Create(location)
+	return writeJSONFile(location, cards)
+}
+
+// index - Adds a card at the given position to the indexes. The caller
+// must hold the write lock.
+func (c *CardManager) index(card Card, position int) {
+	key := cardNumber{expansion: card.Expansion, number: card.CardNumber}
+
+	c.ids[card.ID] = position
+	c.numbers[key] = append(c.numbers[key], position)
+	c.houses[strings.ToLower(card.House)] = append(c.houses[strings.ToLower(card.House)], position)
+	c.types[strings.ToLower(card.CardType)] = append(c.types[strings.ToLower(card.CardType)], position)
+	c.rarities[strings.ToLower(card.Rarity)] = append(c.rarities[strings.ToLower(card.Rarity)], position)
+	c.titles[strings.ToLower(card.CardTitle)] = append(c.titles[strings.ToLower(card.CardTitle)], position)
 
-	if e != nil {
-		return e
+	for _, trait := range CardTraits(card) {
+		c.traits[strings.ToLower(trait)] = append(c.traits[strings.ToLower(trait)], position)
 	}
 
-	file.WriteString(string(bytes))
-	file.Close()
+	seen := make(map[string]bool)
 
-	return nil
+	for _, word := range cardTextWords(card) {
+		if !seen[word] {
+			seen[word] = true
+			c.words[word] = append(c.words[word], position)
+		}
+	}
 }
 
-func (c *CardManager) QueryCard(query *CardQuery) (Card, error) {
-	for _, card := range c.cards {
-		if query.ID() == card.ID && query.Expansion() == card.Expansion && query.Number() == card.CardNumber {
-			return card, nil
+// candidates - Returns the positions of the cards which could match the
+// query, taken from the narrowest index the query uses, or nil if it uses
+// none. The caller must hold the read lock.
+func (c *CardManager) candidates(query *CardQuery) []int {
+	if query.id != "" {
+		if position, ok := c.ids[query.id]; ok {
+			return []int{position}
+		}
+
+		return []int{}
+	}
+
+	if query.expansion != 0 && query.number != 0 {
+		return c.numbers[cardNumber{expansion: query.expansion, number: query.number}]
+	}
+
+	var narrowest []int
+	found := false
+
+	consider := func(positions []int) {
+		if !found || len(positions) < len(narrowest) {
+			narrowest = positions
+			found = true
+		}
+	}
+
+	lists := []struct {
+		index  map[string][]int
+		values []string
+	}{
+		{c.houses, query.houses},
+		{c.types, query.types},
+		{c.rarities, query.rarities},
+	}
+
+	for _, list := range lists {
+		if len(list.values) > 0 {
+			positions := []int{}
+
+			for _, value := range list.values {
+				positions = append(positions, list.index[strings.ToLower(value)]...)
+			}
+
+			consider(positions)
+		}
+	}
+
+	for _, trait := range query.traits {
+		consider(c.traits[strings.ToLower(trait)])
+	}
+
+	for _, word := range query.text {
+		consider(c.words[word])
+	}
+
+	if !found {
+		return nil
+	}
+
+	if narrowest == nil {
+		return []int{}
+	}
+
+	return narrowest
+}
+
+// Search - Returns the page of cards matching the query, sorted as it asks,
+// along with the number of matches across every page.
+func (c *CardManager) Search(query *CardQuery) CardSearchResult {
+	c.cardMutex.RLock()
+	defer c.cardMutex.RUnlock()
+
+	positions := c.candidates(query)
+	cards := c.cards
+
+	if positions != nil {
+		cards = make([]Card, 0, len(positions))
+
+		for _, position := range positions {
+			cards = append(cards, c.cards[position])
 		}
 	}
 
-	for _, card := range c.cards {
-		if query.Expansion() == card.Expansion && query.Number() == card.CardNumber {
-			return card, nil
+	page, total := query.Filter(cards)
+	return CardSearchResult{Total: total, Cards: page}
+}
+
+// Find - Returns the cards matching the query.
+func (c *CardManager) Find(query *CardQuery) []Card {
+	return c.Search(query).Cards
+}
+
+// QueryCard - Returns the first card matching the query. If the query names
+// a card ID which doesn't match, the search is repeated without it so a
+// maverick's ID still finds the usual version of the card.
+func (c *CardManager) QueryCard(query *CardQuery) (Card, error) {
+	cards := c.Find(query)
+
+	if len(cards) == 0 && query.id != "" {
+		fallback := *query
+		fallback.id = ""
+
+		if fallback.expansion != 0 || fallback.number != 0 {
+			cards = c.Find(&fallback)
 		}
 	}
 
-	return Card{}, errors.New("no card found with the given query")
+	if len(cards) == 0 {
+		return Card{}, errors.New("no card found with the given query")
+	}
+
+	return cards[0], nil
 }
 
-func (c *CardManager) CardExists(query *CardQuery) bool {
-	for _, card := range c.cards {
-		if query.ID() == card.ID && query.Expansion() == card.Expansion && query.Number() == card.CardNumber {
-			return true
+// FindByTitle - Returns every printing of a card, ignoring case, with the
+// most recent expansion first.
+func (c *CardManager) FindByTitle(title string) []Card {
+	c.cardMutex.RLock()
+	defer c.cardMutex.RUnlock()
+
+	cards := []Card{}
+
+	for _, position := range c.titles[strings.ToLower(strings.TrimSpace(title))] {
+		cards = append(cards, c.cards[position])
+	}
+
+	sort.SliceStable(cards, func(i, j int) bool {
+		return DefaultExpansions.Less(cards[j].Expansion, cards[i].Expansion)
+	})
+
+	return cards
+}
+
+// ResolveCard - Returns the database's version of a card. Cards are looked
+// up by ID, then by expansion and number, then by title, so a reprint in a
+// set the database has no data for still resolves to an earlier printing.
+// When the card is only found by title, the printing from the same
+// expansion is preferred, then the most recent one; the result keeps the
+// card's own ID, expansion, number, house and maverick status, taking only
+// the rules from the database.
+func (c *CardManager) ResolveCard(card Card) (Card, error) {
+	c.cardMutex.RLock()
+	position, ok := c.ids[card.ID]
+
+	if !ok {
+		positions := c.numbers[cardNumber{expansion: card.Expansion, number: card.CardNumber}]
+
+		// A number alone isn't enough when the title says otherwise.
+		for _, p := range positions {
+			if card.CardTitle == "" || strings.EqualFold(c.cards[p].CardTitle, card.CardTitle) {
+				position, ok = p, true
+				break
+			}
+		}
+	}
+
+	if ok {
+		resolved := c.cards[position]
+		c.cardMutex.RUnlock()
+
+		if resolved.ID != card.ID && card.ID != "" {
+			return reprintCard(card, resolved), nil
+		}
+
+		return resolved, nil
+	}
+
+	c.cardMutex.RUnlock()
+
+	if card.CardTitle == "" {
+		return Card{}, fmt.Errorf("no card found for %d/%d", card.Expansion, card.CardNumber)
+	}
+
+	printings := c.FindByTitle(card.CardTitle)
+
+	if len(printings) == 0 {
+		return Card{}, fmt.Errorf("no card found for %q (%d/%d)", card.CardTitle, card.Expansion, card.CardNumber)
+	}
+
+	for _, printing := range printings {
+		if printing.Expansion == card.Expansion {
+			return reprintCard(card, printing), nil
 		}
 	}
 
-	for _, card := range c.cards {
-		if query.Expansion() == card.Expansion && query.Number() == card.CardNumber {
-			return true
+	return reprintCard(card, printings[0]), nil
+}
+
+// ResolveDeck - Fills in any of the deck's cards which lack their rules,
+// such as cards read from a deck file holding only titles or reprints from
+// a newer set, from the database. Cards which are complete already keep
+// their rules, but are given parsed text, shared with the database where it
+// has the same card. It returns the deck along with the titles of the cards
+// which couldn't be resolved.
+func (c *CardManager) ResolveDeck(deck Deck) (Deck, []string) {
+	unresolved := []string{}
+	cards := make([]Card, 0, len(deck.Cards))
+
+	for _, card := range deck.Cards {
+		if card.CardType != "" {
+			cards = append(cards, c.withText(card))
+			continue
 		}
+
+		resolved, e := c.ResolveCard(card)
+
+		if e != nil {
+			unresolved = append(unresolved, card.CardTitle)
+			cards = append(cards, c.withText(card))
+			continue
+		}
+
+		cards = append(cards, resolved)
 	}
 
-	return false
+	deck.Cards = cards
+	return deck, unresolved
+}
+
+// withText - Returns the card with its text parsed, taking the database's
+// parsed text when it holds the same card with the same text.
+func (c *CardManager) withText(card Card) Card {
+	if card.text != nil && card.text.Raw == card.CardText {
+		return card
+	}
+
+	c.cardMutex.RLock()
+
+	if position, ok := c.ids[card.ID]; ok && c.cards[position].CardText == card.CardText {
+		card.text = c.cards[position].text
+	}
+
+	c.cardMutex.RUnlock()
+
+	if card.text == nil || card.text.Raw != card.CardText {
+		card.text = ParseCardText(card.CardText)
+	}
+
+	return card
+}
+
+// reprintCard - Returns the printing's rules under the card's own identity.
+func reprintCard(card Card, printing Card) Card {
+	resolved := printing
+	resolved.ID = card.ID
+	resolved.IsMaverick = card.IsMaverick
+
+	if card.Expansion != 0 {
+		resolved.Expansion = card.Expansion
+	}
+
+	if card.CardNumber != 0 {
+		resolved.CardNumber = card.CardNumber
+	}
+
+	if card.House != "" {
+		resolved.House = card.House
+	}
+
+	if card.FrontImage != "" {
+		resolved.FrontImage = card.FrontImage
+	}
+
+	return resolved
+}
+
+// CardExists - Determine whether any card matches the query, falling back
+// in the same way as QueryCard.
+func (c *CardManager) CardExists(query *CardQuery) bool {
+	_, e := c.QueryCard(query)
+	return e == nil
 }
@@ -0,0 +1,337 @@
+package kfnetwork
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// CardSortField - What a card query's results are ordered by.
+type CardSortField int
+
+const (
+	// CardSortNumber - By expansion in release order, then card number.
+	// The default.
+	CardSortNumber CardSortField = iota
+	// CardSortTitle - By card title.
+	CardSortTitle
+	// CardSortHouse - By house, then card number.
+	CardSortHouse
+	// CardSortAmber - By the amber bonus.
+	CardSortAmber
+	// CardSortPower - By power.
+	CardSortPower
+	// CardSortArmor - By armor.
+	CardSortArmor
+	// CardSortPile - Keeps the cards in the order they were given, as when
+	// filtering a hand or draw pile.
+	CardSortPile
+)
+
+// cardRange - An inclusive range of values a card's stat must fall in.
+type cardRange struct {
+	set bool
+	min int
+	max int
+}
+
+func (r cardRange) contains(value int) bool {
+	return !r.set || (value >= r.min && value <= r.max)
+}
+
+// CardQuery - Filters, ordering and paging for searching cards. Filters
+// which haven't been set match every card, and every filter which has been
+// set must match. Within a filter listing several houses, types or
+// rarities any one of them matches, while every trait listed is required.
+type CardQuery struct {
+	id         string
+	number     int
+	expansion  int
+	title      string
+	text       []string
+	houses     []string
+	types      []string
+	rarities   []string
+	traits     []string
+	amber      cardRange
+	power      cardRange
+	armor      cardRange
+	sortBy     CardSortField
+	descending bool
+	page       int
+	pageSize   int
+}
+
+func NewCardQuery() *CardQuery {
+	cardQuery := new(CardQuery)
+	return cardQuery
+}
+
+func (q *CardQuery) ID() string {
+	return q.id
+}
+
+func (q *CardQuery) SetID(id string) {
+	q.id = id
+}
+
+func (q *CardQuery) Number() int {
+	return q.number
+}
+
+func (q *CardQuery) SetNumber(number int) {
+	q.number = number
+}
+
+func (q *CardQuery) Expansion() int {
+	return q.expansion
+}
+
+func (q *CardQuery) SetExpansion(expansion int) {
+	q.expansion = expansion
+}
+
+// SetTitle - Only cards whose title contains the text, ignoring case.
+func (q *CardQuery) SetTitle(title string) {
+	q.title = strings.ToLower(title)
+}
+
+// SetText - Only cards whose card text or flavor text contains every word
+// given, ignoring case and punctuation.
+func (q *CardQuery) SetText(text string) {
+	q.text = cardWords(text)
+}
+
+// SetHouses - Only cards from one of the houses.
+func (q *CardQuery) SetHouses(houses ...string) {
+	q.houses = houses
+}
+
+// SetTypes - Only cards of one of the types, such as creature or action.
+func (q *CardQuery) SetTypes(types ...string) {
+	q.types = types
+}
+
+// SetRarities - Only cards of one of the rarities.
+func (q *CardQuery) SetRarities(rarities ...string) {
+	q.rarities = rarities
+}
+
+// SetTraits - Only cards with every one of the traits.
+func (q *CardQuery) SetTraits(traits ...string) {
+	q.traits = traits
+}
+
+// SetAmberRange - Only cards whose amber bonus is between min and max.
+func (q *CardQuery) SetAmberRange(min, max int) {
+	q.amber = cardRange{set: true, min: min, max: max}
+}
+
+// SetPowerRange - Only cards whose power is between min and max.
+func (q *CardQuery) SetPowerRange(min, max int) {
+	q.power = cardRange{set: true, min: min, max: max}
+}
+
+// SetArmorRange - Only cards whose armor is between min and max.
+func (q *CardQuery) SetArmorRange(min, max int) {
+	q.armor = cardRange{set: true, min: min, max: max}
+}
+
+// SetSort - Orders the results. Cards which compare equal are ordered by
+// expansion and card number.
+func (q *CardQuery) SetSort(field CardSortField, descending bool) {
+	q.sortBy = field
+	q.descending = descending
+}
+
+// SetPage - Returns only the given page of results, counting from one. A
+// page size of zero returns every result.
+func (q *CardQuery) SetPage(page, pageSize int) {
+	q.page = page
+	q.pageSize = pageSize
+}
+
+// Matches - Determine whether a card passes every filter.
+func (q *CardQuery) Matches(card Card) bool {
+	if q.id != "" && card.ID != q.id {
+		return false
+	}
+
+	if q.expansion != 0 && card.Expansion != q.expansion {
+		return false
+	}
+
+	if q.number != 0 && card.CardNumber != q.number {
+		return false
+	}
+
+	if q.title != "" && !strings.Contains(strings.ToLower(card.CardTitle), q.title) {
+		return false
+	}
+
+	if !matchesAny(card.House, q.houses) || !matchesAny(card.CardType, q.types) || !matchesAny(card.Rarity, q.rarities) {
+		return false
+	}
+
+	if len(q.traits) > 0 {
+		traits := CardTraits(card)
+
+		for _, trait := range q.traits {
+			if len(traits) == 0 || !matchesAny(trait, traits) {
+				return false
+			}
+		}
+	}
+
+	if !q.amber.contains(card.Amber) || !q.power.contains(card.Power) || !q.armor.contains(card.Armor) {
+		return false
+	}
+
+	if len(q.text) > 0 {
+		words := make(map[string]bool)
+
+		for _, word := range cardTextWords(card) {
+			words[word] = true
+		}
+
+		for _, word := range q.text {
+			if !words[word] {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// Filter - Applies the query to a pile of cards, such as a hand or a draw
+// pile, returning the matching cards sorted and paged. The total number of
+// matches before paging is returned too.
+func (q *CardQuery) Filter(cards []Card) ([]Card, int) {
+	matches := []Card{}
+
+	for _, card := range cards {
+		if q.Matches(card) {
+			matches = append(matches, card)
+		}
+	}
+
+	q.sort(matches)
+	return q.paginate(matches), len(matches)
+}
+
+func (q *CardQuery) sort(cards []Card) {
+	if q.sortBy == CardSortPile {
+		return
+	}
+
+	key := func(card Card) (int, string) {
+		switch q.sortBy {
+		case CardSortTitle:
+			return 0, strings.ToLower(card.CardTitle)
+		case CardSortHouse:
+			return 0, strings.ToLower(card.House)
+		case CardSortAmber:
+			return card.Amber, ""
+		case CardSortPower:
+			return card.Power, ""
+		case CardSortArmor:
+			return card.Armor, ""
+		}
+
+		return 0, ""
+	}
+
+	sort.SliceStable(cards, func(i, j int) bool {
+		iNumber, iText := key(cards[i])
+		jNumber, jText := key(cards[j])
+
+		if iNumber != jNumber || iText != jText {
+			if q.descending {
+				return iNumber > jNumber || (iNumber == jNumber && iText > jText)
+			}
+
+			return iNumber < jNumber || (iNumber == jNumber && iText < jText)
+		}
+
+		if cards[i].Expansion != cards[j].Expansion {
+			return DefaultExpansions.Less(cards[i].Expansion, cards[j].Expansion) != (q.descending && q.sortBy == CardSortNumber)
+		}
+
+		if cards[i].CardNumber != cards[j].CardNumber {
+			return (cards[i].CardNumber < cards[j].CardNumber) != (q.descending && q.sortBy == CardSortNumber)
+		}
+
+		return cards[i].ID < cards[j].ID
+	})
+}
+
+func (q *CardQuery) paginate(cards []Card) []Card {
+	if q.pageSize <= 0 {
+		return cards
+	}
+
+	page := q.page
+
+	if page < 1 {
+		page = 1
+	}
+
+	start := (page - 1) * q.pageSize
+
+	if start >= len(cards) {
+		return []Card{}
+	}
+
+	end := start + q.pageSize
+
+	if end > len(cards) {
+		end = len(cards)
+	}
+
+	return cards[start:end]
+}
+
+// CardTraits - Returns a card's traits, which the Vault gives as a single
+// string separated by bullets.
+func CardTraits(card Card) []string {
+	traits := []string{}
+
+	for _, trait := range strings.Split(card.Traits, "•") {
+		trait = strings.TrimSpace(trait)
+
+		if trait != "" {
+			traits = append(traits, trait)
+		}
+	}
+
+	return traits
+}
+
+// cardTextWords - Returns the words of a card's text and flavor text.
+func cardTextWords(card Card) []string {
+	return cardWords(card.CardText + " " + card.FlavorText)
+}
+
+// cardWords - Splits text into lower case words, dropping punctuation.
+func cardWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// matchesAny - Determine whether the value is one of the wanted values,
+// ignoring case. Nothing wanted matches everything.
+func matchesAny(value string, wanted []string) bool {
+	if len(wanted) == 0 {
+		return true
+	}
+
+	for _, want := range wanted {
+		if strings.EqualFold(value, want) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,267 @@
+package kfnetwork
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// CardSearchSyntax - A summary of the card search syntax, for help text.
+const CardSearchSyntax = `Words on their own search card titles. Filters:
+  house:dis,mars   type:creature   rarity:rare   trait:knight   text:"capture"
+  set:cota or set:341   number:12   id:<vault id>   title:"mighty tiger"
+  amber, power and armor with :, =, >, >=, < or <=, e.g. power>=4
+  sort:title, sort:house, sort:amber, sort:power or sort:armor, with a leading
+  - to reverse, e.g. sort:-power`
+
+// cardSearchOperators - The operators which can follow a filter name, longest
+// first so >= isn't read as >.
+var cardSearchOperators = []string{">=", "<=", ":", "=", ">", "<"}
+
+// cardSearchAliases - Other names for filters, mapped to the name used when
+// checking a filter isn't given twice.
+var cardSearchAliases = map[string]string{
+	"houses":    "house",
+	"types":     "type",
+	"expansion": "set",
+}
+
+// narrow - Narrows the range by a comparison from a card search, starting
+// from every value if the range isn't set yet.
+func (r *cardRange) narrow(operator string, value int) {
+	if !r.set {
+		r.set = true
+		r.min = math.MinInt32
+		r.max = math.MaxInt32
+	}
+
+	switch operator {
+	case ":", "=":
+		r.min = maxInt(r.min, value)
+		r.max = minInt(r.max, value)
+	case ">=":
+		r.min = maxInt(r.min, value)
+	case ">":
+		r.min = maxInt(r.min, value+1)
+	case "<=":
+		r.max = minInt(r.max, value)
+	case "<":
+		r.max = minInt(r.max, value-1)
+	}
+}
+
+// ParseCardQuery - Parses a card search such as
+// `house:dis type:creature power>=4 text:"capture"` into a CardQuery. See
+// CardSearchSyntax for everything it understands.
+func ParseCardQuery(search string) (*CardQuery, error) {
+	terms, e := splitCardSearch(search)
+
+	if e != nil {
+		return nil, e
+	}
+
+	query := NewCardQuery()
+	title := []string{}
+	traits := []string{}
+	text := []string{}
+	stats := map[string]*cardRange{"amber": &query.amber, "power": &query.power, "armor": &query.armor}
+	seen := make(map[string]bool)
+
+	for _, term := range terms {
+		key, operator, value := splitCardSearchTerm(term)
+
+		if operator == "" {
+			title = append(title, unquoteCardSearch(term))
+			continue
+		}
+
+		key = strings.ToLower(key)
+		value = unquoteCardSearch(value)
+
+		if value == "" {
+			return nil, fmt.Errorf("%s has no value", key)
+		}
+
+		if _, ok := stats[key]; !ok && operator != ":" && operator != "=" {
+			return nil, fmt.Errorf("%s can't be compared with %s", key, operator)
+		}
+
+		// Titles, text and traits add up, and stat comparisons narrow each
+		// other, but a second house, type, rarity, id, set, number or sort
+		// would silently replace the first.
+		name := key
+
+		if alias, ok := cardSearchAliases[key]; ok {
+			name = alias
+		}
+
+		if seen[name] {
+			return nil, fmt.Errorf("%s is given more than once; list several values as %s:a,b", name, name)
+		}
+
+		switch name {
+		case "house", "type", "rarity", "id", "set", "number", "sort":
+			seen[name] = true
+		}
+
+		switch key {
+		case "house", "houses":
+			query.SetHouses(strings.Split(value, ",")...)
+		case "type", "types":
+			query.SetTypes(strings.Split(value, ",")...)
+		case "rarity":
+			query.SetRarities(strings.Split(value, ",")...)
+		case "trait", "traits":
+			traits = append(traits, strings.Split(value, ",")...)
+		case "text":
+			text = append(text, value)
+		case "title", "name":
+			title = append(title, value)
+		case "id":
+			query.SetID(value)
+		case "set", "expansion":
+			expansion, e := DefaultExpansions.Resolve(value)
+
+			if e != nil {
+				return nil, e
+			}
+
+			query.SetExpansion(expansion.ID)
+		case "number":
+			number, e := strconv.Atoi(value)
+
+			if e != nil {
+				return nil, fmt.Errorf("%s must be a number, not %q", key, value)
+			}
+
+			query.SetNumber(number)
+		case "amber", "power", "armor":
+			number, e := strconv.Atoi(value)
+
+			if e != nil {
+				return nil, fmt.Errorf("%s must be a number, not %q", key, value)
+			}
+
+			stats[key].narrow(operator, number)
+		case "sort":
+			e = parseCardSort(query, value)
+
+			if e != nil {
+				return nil, e
+			}
+		default:
+			return nil, fmt.Errorf("unknown filter %q", key)
+		}
+	}
+
+	if len(title) > 0 {
+		query.SetTitle(strings.Join(title, " "))
+	}
+
+	if len(traits) > 0 {
+		query.SetTraits(traits...)
+	}
+
+	if len(text) > 0 {
+		query.SetText(strings.Join(text, " "))
+	}
+
+	return query, nil
+}
+
+func parseCardSort(query *CardQuery, value string) error {
+	descending := strings.HasPrefix(value, "-")
+	fields := map[string]CardSortField{
+		"number": CardSortNumber,
+		"title":  CardSortTitle,
+		"name":   CardSortTitle,
+		"house":  CardSortHouse,
+		"amber":  CardSortAmber,
+		"power":  CardSortPower,
+		"armor":  CardSortArmor,
+	}
+
+	field, ok := fields[strings.ToLower(strings.TrimPrefix(value, "-"))]
+
+	if !ok {
+		return fmt.Errorf("can't sort by %q", value)
+	}
+
+	query.SetSort(field, descending)
+	return nil
+}
+
+// splitCardSearch - Splits a search into terms at spaces outside of double
+// quotes. The quotes are kept so a term's operator can be told apart from
+// the same character inside a quoted value.
+func splitCardSearch(search string) ([]string, error) {
+	terms := []string{}
+	term := strings.Builder{}
+	quoted := false
+
+	for _, r := range search {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			term.WriteRune(r)
+		case !quoted && (r == ' ' || r == '\t'):
+			if term.Len() > 0 {
+				terms = append(terms, term.String())
+				term.Reset()
+			}
+		default:
+			term.WriteRune(r)
+		}
+	}
+
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote in %q", search)
+	}
+
+	if term.Len() > 0 {
+		terms = append(terms, term.String())
+	}
+
+	return terms, nil
+}
+
+// splitCardSearchTerm - Splits a term at its first operator outside of
+// quotes. Terms without one are returned with an empty operator.
+func splitCardSearchTerm(term string) (string, string, string) {
+	end := strings.Index(term, `"`)
+
+	if end < 0 {
+		end = len(term)
+	}
+
+	for i := 0; i < end; i++ {
+		for _, operator := range cardSearchOperators {
+			if strings.HasPrefix(term[i:], operator) {
+				return term[:i], operator, term[i+len(operator):]
+			}
+		}
+	}
+
+	return term, "", ""
+}
+
+func unquoteCardSearch(value string) string {
+	return strings.ReplaceAll(value, `"`, "")
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
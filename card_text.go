@@ -0,0 +1,370 @@
+package kfnetwork
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// CardTextTokenKind - What a piece of card text stands for.
+type CardTextTokenKind int
+
+const (
+	// CardTextPlain - Prose, kept as written.
+	CardTextPlain CardTextTokenKind = iota
+	// CardTextAmber - The amber symbol, <A>, with the amount before it.
+	CardTextAmber
+	// CardTextDamage - The damage symbol, <D>, with the amount before it.
+	CardTextDamage
+	// CardTextCapture - Capturing amber, such as "Capture 2<A>". Text holds
+	// the verb as written.
+	CardTextCapture
+)
+
+// CardTextToken - A piece of card text. Amount is the number written before
+// a symbol, or zero if there is none.
+type CardTextToken struct {
+	Kind   CardTextTokenKind `json:"kind"`
+	Text   string            `json:"text,omitempty"`
+	Amount int               `json:"amount,omitempty"`
+}
+
+// CardTrigger - When a triggered ability resolves, as written before the
+// colon that starts it.
+type CardTrigger string
+
+// The triggers found on cards so far.
+const (
+	TriggerPlay        CardTrigger = "Play"
+	TriggerReap        CardTrigger = "Reap"
+	TriggerFight       CardTrigger = "Fight"
+	TriggerBeforeFight CardTrigger = "Before Fight"
+	TriggerAction      CardTrigger = "Action"
+	TriggerOmni        CardTrigger = "Omni"
+	TriggerDestroyed   CardTrigger = "Destroyed"
+	TriggerLeavesPlay  CardTrigger = "Leaves Play"
+)
+
+// CardTriggers - Every trigger the parser recognizes.
+var CardTriggers = []CardTrigger{
+	TriggerPlay, TriggerReap, TriggerFight, TriggerBeforeFight, TriggerAction,
+	TriggerOmni, TriggerDestroyed, TriggerLeavesPlay,
+}
+
+// CardKeywords - The keywords the parser recognizes at the start of a
+// paragraph, such as "Elusive." or "Hazardous 5.".
+var CardKeywords = []string{
+	"Alpha", "Assault", "Deploy", "Elusive", "Hazardous", "Invulnerable",
+	"Omega", "Poison", "Skirmish", "Taunt", "Versatile",
+}
+
+// CardTextSection - A paragraph of card text. It is a triggered ability
+// when Triggers is set, a keyword when Keyword is set, with Tokens holding
+// the keyword's reminder text, and a constant ability otherwise.
+type CardTextSection struct {
+	Triggers     []CardTrigger   `json:"triggers,omitempty"`
+	Keyword      string          `json:"keyword,omitempty"`
+	KeywordValue int             `json:"keyword_value,omitempty"`
+	Tokens       []CardTextToken `json:"tokens"`
+}
+
+// HasTrigger - Determine whether the section resolves on the trigger.
+func (s CardTextSection) HasTrigger(trigger CardTrigger) bool {
+	for _, t := range s.Triggers {
+		if t == trigger {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CardText - Card text parsed into sections. Parsed text is shared between
+// copies of a card, so it must not be changed.
+type CardText struct {
+	Raw      string            `json:"raw"`
+	Sections []CardTextSection `json:"sections"`
+}
+
+// cardTextSymbol - A symbol and its amount, or a capture of amber. The
+// trigger and keyword patterns match the start of a paragraph.
+var (
+	cardTextSymbol  = regexp.MustCompile(`(?i)\b(captures?) (\d+)<A>|(\d*)<([AD])>`)
+	cardTextTrigger = regexp.MustCompile(`^([A-Z][a-z]+(?: [A-Z][a-z]+)?(?:/[A-Z][a-z]+(?: [A-Z][a-z]+)?)*):\s*`)
+	cardTextKeyword = regexp.MustCompile(`^([A-Z][a-z]+)(?: (\d+))?\.(?:\s+|$)`)
+)
+
+// ParseCardText - Parses card text into sections, one per paragraph, or
+// more when a paragraph starts with several keywords. Paragraphs are
+// separated by vertical tabs or new lines. Malformed markup is kept as
+// prose.
+func ParseCardText(raw string) *CardText {
+	text := &CardText{Raw: raw, Sections: []CardTextSection{}}
+	paragraphs := strings.FieldsFunc(raw, func(r rune) bool {
+		return r == '\v' || r == '\n' || r == '\r'
+	})
+
+	for _, paragraph := range paragraphs {
+		paragraph = strings.TrimSpace(paragraph)
+
+		for paragraph != "" {
+			match := cardTextKeyword.FindStringSubmatch(paragraph)
+
+			if match == nil || !matchesAny(match[1], CardKeywords) {
+				break
+			}
+
+			section := CardTextSection{Keyword: match[1], Tokens: []CardTextToken{}}
+			section.KeywordValue, _ = strconv.Atoi(match[2])
+			paragraph = paragraph[len(match[0]):]
+
+			// Reminder text in brackets belongs to the keyword.
+			if strings.HasPrefix(paragraph, "(") {
+				end := strings.Index(paragraph, ")")
+
+				if end < 0 {
+					end = len(paragraph) - 1
+				}
+
+				section.Tokens = tokenizeCardText(paragraph[:end+1])
+				paragraph = strings.TrimSpace(paragraph[end+1:])
+			}
+
+			text.Sections = append(text.Sections, section)
+		}
+
+		if paragraph == "" {
+			continue
+		}
+
+		section := CardTextSection{}
+
+		if match := cardTextTrigger.FindStringSubmatch(paragraph); match != nil {
+			triggers := parseCardTriggers(match[1])
+
+			if triggers != nil {
+				section.Triggers = triggers
+				paragraph = paragraph[len(match[0]):]
+			}
+		}
+
+		section.Tokens = tokenizeCardText(paragraph)
+		text.Sections = append(text.Sections, section)
+	}
+
+	return text
+}
+
+// parseCardTriggers - Splits triggers such as "Fight/Reap", returning nil
+// unless every one of them is recognized.
+func parseCardTriggers(prefix string) []CardTrigger {
+	triggers := []CardTrigger{}
+
+	for _, name := range strings.Split(prefix, "/") {
+		found := false
+
+		for _, trigger := range CardTriggers {
+			if string(trigger) == name {
+				triggers = append(triggers, trigger)
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return nil
+		}
+	}
+
+	return triggers
+}
+
+// tokenizeCardText - Splits prose into plain text, symbols and captures.
+func tokenizeCardText(text string) []CardTextToken {
+	tokens := []CardTextToken{}
+	last := 0
+
+	for _, match := range cardTextSymbol.FindAllStringSubmatchIndex(text, -1) {
+		if match[0] > last {
+			tokens = append(tokens, CardTextToken{Kind: CardTextPlain, Text: text[last:match[0]]})
+		}
+
+		token := CardTextToken{}
+
+		if match[2] >= 0 {
+			token.Kind = CardTextCapture
+			token.Text = text[match[2]:match[3]]
+			token.Amount, _ = strconv.Atoi(text[match[4]:match[5]])
+		} else {
+			token.Kind = CardTextAmber
+
+			if text[match[8]:match[9]] == "D" {
+				token.Kind = CardTextDamage
+			}
+
+			token.Amount, _ = strconv.Atoi(text[match[6]:match[7]])
+		}
+
+		tokens = append(tokens, token)
+		last = match[1]
+	}
+
+	if last < len(text) {
+		tokens = append(tokens, CardTextToken{Kind: CardTextPlain, Text: text[last:]})
+	}
+
+	return tokens
+}
+
+// Triggered - Returns the sections which resolve on the trigger.
+func (t *CardText) Triggered(trigger CardTrigger) []CardTextSection {
+	sections := []CardTextSection{}
+
+	for _, section := range t.Sections {
+		if section.HasTrigger(trigger) {
+			sections = append(sections, section)
+		}
+	}
+
+	return sections
+}
+
+// HasKeyword - Determine whether the text gives the card a keyword,
+// ignoring case.
+func (t *CardText) HasKeyword(keyword string) bool {
+	for _, section := range t.Sections {
+		if section.Keyword != "" && strings.EqualFold(section.Keyword, keyword) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CardTextSymbols - How symbols are written when card text is rendered.
+// With Spaced set, a space separates an amount from its symbol. Emphasis
+// wraps triggers and keywords, and Color wraps a symbol and its amount,
+// typically with terminal escape codes.
+type CardTextSymbols struct {
+	Amber       string
+	Damage      string
+	Spaced      bool
+	AmberColor  [2]string
+	DamageColor [2]string
+	Emphasis    [2]string
+}
+
+// PlainCardText - Renders symbols as words, as in "Gain 2 amber".
+var PlainCardText = CardTextSymbols{Amber: "amber", Damage: "damage", Spaced: true}
+
+// TerminalCardText - Renders symbols compactly in color, with triggers and
+// keywords in bold, for terminal display.
+var TerminalCardText = CardTextSymbols{
+	Amber:       "Æ",
+	Damage:      "D",
+	AmberColor:  [2]string{"\x1b[33m", "\x1b[0m"},
+	DamageColor: [2]string{"\x1b[31m", "\x1b[0m"},
+	Emphasis:    [2]string{"\x1b[1m", "\x1b[0m"},
+}
+
+// Render - Writes the text out with the symbols substituted, one section
+// per line.
+func (t *CardText) Render(symbols CardTextSymbols) string {
+	lines := []string{}
+
+	for _, section := range t.Sections {
+		lines = append(lines, section.Render(symbols))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Render - Writes the section out with the symbols substituted.
+func (s CardTextSection) Render(symbols CardTextSymbols) string {
+	text := strings.Builder{}
+
+	switch {
+	case s.Keyword != "":
+		keyword := s.Keyword
+
+		if s.KeywordValue != 0 {
+			keyword += " " + strconv.Itoa(s.KeywordValue)
+		}
+
+		text.WriteString(symbols.Emphasis[0] + keyword + "." + symbols.Emphasis[1])
+
+		if len(s.Tokens) > 0 {
+			text.WriteString(" ")
+		}
+	case len(s.Triggers) > 0:
+		triggers := []string{}
+
+		for _, trigger := range s.Triggers {
+			triggers = append(triggers, string(trigger))
+		}
+
+		text.WriteString(symbols.Emphasis[0] + strings.Join(triggers, "/") + ":" + symbols.Emphasis[1] + " ")
+	}
+
+	for _, token := range s.Tokens {
+		switch token.Kind {
+		case CardTextPlain:
+			text.WriteString(token.Text)
+		case CardTextCapture:
+			text.WriteString(token.Text + " " + symbols.symbol(symbols.Amber, token.Amount, symbols.AmberColor))
+		case CardTextAmber:
+			text.WriteString(symbols.symbol(symbols.Amber, token.Amount, symbols.AmberColor))
+		case CardTextDamage:
+			text.WriteString(symbols.symbol(symbols.Damage, token.Amount, symbols.DamageColor))
+		}
+	}
+
+	return text.String()
+}
+
+func (s CardTextSymbols) symbol(symbol string, amount int, color [2]string) string {
+	if amount == 0 {
+		return color[0] + symbol + color[1]
+	}
+
+	separator := ""
+
+	if s.Spaced {
+		separator = " "
+	}
+
+	return color[0] + strconv.Itoa(amount) + separator + symbol + color[1]
+}
+
+// Text - Returns the card's parsed text. Cards from the card database, and
+// deck cards once their game has started, have it parsed already; for
+// other cards it is parsed on each call.
+func (c *Card) Text() *CardText {
+	if c.text != nil && c.text.Raw == c.CardText {
+		return c.text
+	}
+
+	return ParseCardText(c.CardText)
+}
+
+// parseDeckText - Returns the deck with each card's text parsed, for games
+// started without a card database.
+func parseDeckText(deck Deck) Deck {
+	cards := make([]Card, 0, len(deck.Cards))
+
+	for _, card := range deck.Cards {
+		if card.text == nil || card.text.Raw != card.CardText {
+			card.text = ParseCardText(card.CardText)
+		}
+
+		cards = append(cards, card)
+	}
+
+	deck.Cards = cards
+	return deck
+}
+
+// PlainText - Returns the card's text with the symbols written as words.
+func (c *Card) PlainText() string {
+	return c.Text().Render(PlainCardText)
+}
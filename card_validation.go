@@ -0,0 +1,223 @@
+package kfnetwork
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// CardIssueKind - The kind of problem the validator found with a card.
+type CardIssueKind string
+
+const (
+	// CardIssueDuplicateID - Another card was loaded with the same Vault ID.
+	// Only the first one is kept.
+	CardIssueDuplicateID CardIssueKind = "duplicate_id"
+	// CardIssueConflictingNumber - Another card with a different title has
+	// the same expansion and card number.
+	CardIssueConflictingNumber CardIssueKind = "conflicting_number"
+	// CardIssueUnknownHouse - The house isn't one of the expansion's houses.
+	CardIssueUnknownHouse CardIssueKind = "unknown_house"
+	// CardIssueUnknownType - The card type isn't one the game knows.
+	CardIssueUnknownType CardIssueKind = "unknown_type"
+	// CardIssueMissingPower - A creature without any power.
+	CardIssueMissingPower CardIssueKind = "missing_power"
+	// CardIssueMalformedMarkup - The card text has a symbol tag other than
+	// <A> or <D>, or an unclosed or stray angle bracket.
+	CardIssueMalformedMarkup CardIssueKind = "malformed_markup"
+)
+
+// CardTypes - The card types the game knows.
+var CardTypes = []string{"Action", "Artifact", "Creature", "Upgrade"}
+
+// cardTextSymbols - The tags the Vault uses in card text for the amber and
+// damage symbols.
+var cardTextSymbols = map[string]bool{"<A>": true, "<D>": true}
+
+// CardIssue - A problem with one card in the card data.
+type CardIssue struct {
+	Kind      CardIssueKind `json:"kind"`
+	CardID    string        `json:"card_id"`
+	CardTitle string        `json:"card_title"`
+	Expansion int           `json:"expansion"`
+	Number    int           `json:"card_number"`
+	Message   string        `json:"message"`
+}
+
+func newCardIssue(kind CardIssueKind, card Card, format string, args ...interface{}) CardIssue {
+	return CardIssue{
+		Kind:      kind,
+		CardID:    card.ID,
+		CardTitle: card.CardTitle,
+		Expansion: card.Expansion,
+		Number:    card.CardNumber,
+		Message:   fmt.Sprintf(format, args...),
+	}
+}
+
+// CardReport - The result of validating the card data, suitable for
+// writing out as JSON.
+type CardReport struct {
+	Cards  int         `json:"cards"`
+	Issues []CardIssue `json:"issues"`
+}
+
+// OK - Determine whether the card data has no problems.
+func (r CardReport) OK() bool {
+	return len(r.Issues) == 0
+}
+
+// Counts - Returns how many issues of each kind were found.
+func (r CardReport) Counts() map[CardIssueKind]int {
+	counts := make(map[CardIssueKind]int)
+
+	for _, issue := range r.Issues {
+		counts[issue.Kind]++
+	}
+
+	return counts
+}
+
+// Err - Returns an error summarizing the issues, or nil if there are none.
+func (r CardReport) Err() error {
+	if r.OK() {
+		return nil
+	}
+
+	counts := r.Counts()
+	kinds := []string{}
+
+	for kind, count := range counts {
+		kinds = append(kinds, fmt.Sprintf("%d %s", count, kind))
+	}
+
+	sort.Strings(kinds)
+	return fmt.Errorf("%d problems in %d cards: %s", len(r.Issues), r.Cards, strings.Join(kinds, ", "))
+}
+
+// WriteToFile - Saves the report as JSON.
+func (r CardReport) WriteToFile(location string) error {
+	if r.Issues == nil {
+		r.Issues = []CardIssue{}
+	}
+
+	return writeJSONFile(location, r)
+}
+
+// ValidateCards - Checks a list of cards, such as the contents of a card
+// data file, against each other and the default expansions.
+func ValidateCards(cards []Card) CardReport {
+	report := CardReport{Issues: []CardIssue{}}
+	ids := make(map[string]bool)
+	numbers := make(map[cardNumber]Card)
+
+	for _, card := range cards {
+		if ids[card.ID] {
+			report.Issues = append(report.Issues, newCardIssue(CardIssueDuplicateID, card, "%s is listed more than once", card.ID))
+			continue
+		}
+
+		ids[card.ID] = true
+		report.Cards++
+
+		key := cardNumber{expansion: card.Expansion, number: card.CardNumber}
+
+		if other, ok := numbers[key]; ok && !strings.EqualFold(other.CardTitle, card.CardTitle) {
+			report.Issues = append(report.Issues, newCardIssue(CardIssueConflictingNumber, card,
+				"%d/%d is also %q (%s)", card.Expansion, card.CardNumber, other.CardTitle, other.ID))
+		} else if !ok {
+			numbers[key] = card
+		}
+
+		report.Issues = append(report.Issues, validateCard(card)...)
+	}
+
+	return report
+}
+
+// validateCard - Checks the fields of a single card.
+func validateCard(card Card) []CardIssue {
+	issues := []CardIssue{}
+
+	if !cardHouseKnown(card) {
+		issues = append(issues, newCardIssue(CardIssueUnknownHouse, card, "%q is not a house in %s", card.House, card.ExpansionName()))
+	}
+
+	if !matchesAny(card.CardType, CardTypes) || card.CardType == "" {
+		issues = append(issues, newCardIssue(CardIssueUnknownType, card, "%q is not a card type", card.CardType))
+	}
+
+	if strings.EqualFold(card.CardType, "creature") && card.Power <= 0 {
+		issues = append(issues, newCardIssue(CardIssueMissingPower, card, "creature has %d power", card.Power))
+	}
+
+	if problem := checkCardMarkup(card.CardText); problem != "" {
+		issues = append(issues, newCardIssue(CardIssueMalformedMarkup, card, "%s", problem))
+	}
+
+	return issues
+}
+
+// cardHouseKnown - Determine whether the card's house belongs to its
+// expansion, or to any known expansion if its own isn't known.
+func cardHouseKnown(card Card) bool {
+	if card.House == "" {
+		return false
+	}
+
+	if expansion, ok := DefaultExpansions.Lookup(card.Expansion); ok {
+		return expansion.HasHouse(card.House)
+	}
+
+	for _, expansion := range DefaultExpansions.All() {
+		if expansion.HasHouse(card.House) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkCardMarkup - Returns a description of the first problem with the
+// symbol tags in card text, or an empty string if there are none.
+func checkCardMarkup(text string) string {
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '>':
+			return fmt.Sprintf("stray > at %d", i)
+		case '<':
+			end := strings.IndexAny(text[i+1:], "<>")
+
+			if end < 0 || text[i+1+end] != '>' {
+				return fmt.Sprintf("unclosed < at %d", i)
+			}
+
+			tag := text[i : i+end+2]
+
+			if !cardTextSymbols[tag] {
+				return fmt.Sprintf("unknown symbol %s at %d", tag, i)
+			}
+
+			i += end + 1
+		}
+	}
+
+	return ""
+}
+
+// Validate - Checks the card data as it was last loaded, including cards
+// dropped from it because their ID was already taken.
+func (c *CardManager) Validate() CardReport {
+	c.cardMutex.RLock()
+	cards := append([]Card(nil), c.cards...)
+	duplicates := append([]Card(nil), c.duplicates...)
+	c.cardMutex.RUnlock()
+
+	report := ValidateCards(cards)
+
+	for _, card := range duplicates {
+		report.Issues = append(report.Issues, newCardIssue(CardIssueDuplicateID, card, "%s is listed more than once", card.ID))
+	}
+
+	return report
+}
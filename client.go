@@ -1,119 +1,626 @@
 package kfnetwork
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net"
+	"strings"
+	"sync"
+	"time"
 )
 
+// Client - A connection to a server. Every request is stamped with a
+// sequence number which the server echoes back, so responses can be routed
+// to the call that asked for them. Pings from the server are answered as
+// they arrive. Other packets which don't answer a pending call (chat from
+// other players, lobby updates) are delivered on the channel returned by
+// Packets.
 type Client struct {
-	Connection net.Conn
-	Sequence   uint16
+	Connection  Connection
+	Sequence    uint16
+	Timeout     time.Duration
+	clientMutex sync.Mutex
+	packets     chan Packet
+	pending     map[uint16]chan Packet
+	err         error
+}
+
+// ServerError - Returned by blocking calls when the server answers the
+// request with an ErrorPacket.
+type ServerError struct {
+	Message string
+}
+
+func (e *ServerError) Error() string {
+	return e.Message
 }
 
 func NewClient() *Client {
 	client := new(Client)
+	client.Timeout = 10 * time.Second
+	client.pending = make(map[uint16]chan Packet)
+	client.packets = make(chan Packet)
+	close(client.packets)
 	return client
 }
 
+// Connect - Connect to a server. Addresses beginning with ws:// are dialed
+// as WebSocket connections, anything else is treated as a TCP address.
 func (c *Client) Connect(address string) error {
-	var e error
-	c.Connection, e = net.Dial("tcp", address)
+	if strings.HasPrefix(address, "ws://") {
+		connection, e := DialWebSocket(address)
+
+		if e != nil {
+			return e
+		}
+
+		c.Attach(connection)
+		return nil
+	}
+
+	connection, e := net.Dial("tcp", address)
 
 	if e != nil {
 		return e
 	}
 
+	c.Attach(NewTCPConnection(connection))
 	return nil
 }
 
+// Attach - Starts using an already established connection. Any calls still
+// waiting on a previous connection fail.
+func (c *Client) Attach(connection Connection) {
+	packets := make(chan Packet, 256)
+
+	c.clientMutex.Lock()
+	c.failPending()
+	c.Connection = connection
+	c.packets = packets
+	c.err = nil
+	c.clientMutex.Unlock()
+
+	go c.readLoop(connection, packets)
+}
+
+// Close - Closes the connection to the server.
+func (c *Client) Close() error {
+	c.clientMutex.Lock()
+	connection := c.Connection
+	c.clientMutex.Unlock()
+
+	if connection == nil {
+		return errors.New("not connected")
+	}
+
+	return connection.Close()
+}
+
+// Packets - Returns the channel unsolicited packets are delivered on. The
+// channel is closed when the connection is lost, after which Err reports
+// why. If nothing is reading from the channel and its buffer fills up,
+// further unsolicited packets are dropped.
+func (c *Client) Packets() <-chan Packet {
+	c.clientMutex.Lock()
+	defer c.clientMutex.Unlock()
+
+	return c.packets
+}
+
+// Err - Returns the error that ended the current connection, if any.
+func (c *Client) Err() error {
+	c.clientMutex.Lock()
+	defer c.clientMutex.Unlock()
+
+	return c.err
+}
+
+// NextSequence - Returns the sequence number for the next request. Zero is
+// reserved for packets the server sends unprompted, so it is skipped.
+func (c *Client) NextSequence() uint16 {
+	c.clientMutex.Lock()
+	defer c.clientMutex.Unlock()
+
+	c.Sequence++
+
+	if c.Sequence == 0 {
+		c.Sequence++
+	}
+
+	return c.Sequence
+}
+
+func (c *Client) readLoop(connection Connection, packets chan Packet) {
+	for {
+		packet, e := connection.ReadPacket()
+
+		if e != nil {
+			c.clientMutex.Lock()
+			if c.Connection == connection {
+				c.err = e
+				c.failPending()
+			}
+			c.clientMutex.Unlock()
+
+			close(packets)
+			return
+		}
+
+		if c.deliver(packet) {
+			continue
+		}
+
+		// Answer pings here rather than leaving it to whoever reads Packets,
+		// so a program using only the blocking calls isn't evicted. The pong
+		// is written separately so reading never waits on a write.
+		if ping, ok := packet.(PingPacket); ok {
+			pong := PongPacket{}
+			pong.Type = PacketTypePong
+			pong.Timestamp = ping.Timestamp
+			go connection.WritePacket(pong)
+			continue
+		}
+
+		select {
+		case packets <- packet:
+		default:
+		}
+	}
+}
+
+// deliver - Hands a packet to the call waiting on its sequence number.
+// Returns false if no call is waiting for it.
+func (c *Client) deliver(packet Packet) bool {
+	sequence := packet.GetHeader().Sequence
+
+	if sequence == 0 {
+		return false
+	}
+
+	c.clientMutex.Lock()
+	response, ok := c.pending[sequence]
+	delete(c.pending, sequence)
+	c.clientMutex.Unlock()
+
+	if ok {
+		response <- packet
+	}
+
+	return ok
+}
+
+// failPending - Wakes every waiting call. The caller must hold clientMutex.
+func (c *Client) failPending() {
+	for sequence, response := range c.pending {
+		close(response)
+		delete(c.pending, sequence)
+	}
+}
+
+// call - Sends a request and blocks until the response with the same
+// sequence number arrives, the context is done, or the connection fails.
+// If the context has no deadline the client's Timeout is applied.
+func (c *Client) call(ctx context.Context, sequence uint16, packet Packet, responseType uint16) (Packet, error) {
+	if _, ok := ctx.Deadline(); !ok && c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	response := make(chan Packet, 1)
+
+	c.clientMutex.Lock()
+	connection := c.Connection
+
+	if connection == nil {
+		c.clientMutex.Unlock()
+		return nil, errors.New("not connected")
+	}
+
+	c.pending[sequence] = response
+	c.clientMutex.Unlock()
+
+	e := connection.WritePacket(packet)
+
+	if e != nil {
+		c.forget(sequence)
+		return nil, e
+	}
+
+	select {
+	case <-ctx.Done():
+		c.forget(sequence)
+		return nil, ctx.Err()
+	case result, ok := <-response:
+		if !ok {
+			e := c.Err()
+
+			if e == nil {
+				e = errors.New("connection lost")
+			}
+
+			return nil, e
+		}
+
+		if result.GetHeader().Type == PacketTypeError {
+			return nil, &ServerError{Message: result.(ErrorPacket).Message}
+		}
+
+		if result.GetHeader().Type != responseType {
+			return nil, fmt.Errorf("unexpected response packet type %d", result.GetHeader().Type)
+		}
+
+		return result, nil
+	}
+}
+
+func (c *Client) forget(sequence uint16) {
+	c.clientMutex.Lock()
+	delete(c.pending, sequence)
+	c.clientMutex.Unlock()
+}
+
 func (c *Client) SendVersionRequest() error {
 	packet := VersionPacket{}
 	packet.Type = PacketTypeVersionRequest
+	packet.Sequence = c.NextSequence()
 	packet.Version = ProtocolVersion
 
-	e := WritePacket(c.Connection, packet)
-	c.Sequence++
+	e := c.Connection.WritePacket(packet)
 	return e
 }
 
 func (c *Client) SendExitRequest() error {
 	packet := ExitPacket{}
 	packet.Type = PacketTypeExit
+	packet.Sequence = c.NextSequence()
 
-	e := WritePacket(c.Connection, packet)
-	c.Sequence++
+	e := c.Connection.WritePacket(packet)
 	return e
 }
 
+// SendPongResponse - Answers a ping from the server. Pings are answered
+// automatically as they arrive, so this is rarely needed.
+func (c *Client) SendPongResponse(timestamp int64) error {
+	packet := PongPacket{}
+	packet.Type = PacketTypePong
+	packet.Timestamp = timestamp
+
+	return c.Connection.WritePacket(packet)
+}
+
 func (c *Client) SendLoginRequest(name string, id string, token string) error {
 	packet := LoginRequestPacket{}
 	packet.Type = PacketTypeLoginRequest
+	packet.Sequence = c.NextSequence()
 	packet.Name = name
 	packet.ID = id
 	packet.Token = token
 
-	e := WritePacket(c.Connection, packet)
-	c.Sequence++
+	e := c.Connection.WritePacket(packet)
+	return e
+}
+
+// SendResumeRequest - Asks the server to rebind a session issued at login to
+// this connection.
+func (c *Client) SendResumeRequest(session string) error {
+	packet := ResumeRequestPacket{}
+	packet.Type = PacketTypeResumeRequest
+	packet.Sequence = c.NextSequence()
+	packet.Session = session
+
+	e := c.Connection.WritePacket(packet)
 	return e
 }
 
 func (c *Client) SendCreateLobbyRequest(name string) error {
 	packet := CreateLobbyRequestPacket{}
 	packet.Type = PacketTypeCreateLobbyRequest
+	packet.Sequence = c.NextSequence()
 	packet.Name = name
 
-	e := WritePacket(c.Connection, packet)
-	c.Sequence++
+	e := c.Connection.WritePacket(packet)
 	return e
 }
 
 func (c *Client) SendGetCardPile(pile uint8) error {
 	packet := CardPileRequestPacket{}
 	packet.Type = PacketTypeCardPileRequest
+	packet.Sequence = c.NextSequence()
 	packet.Pile = pile
 
-	e := WritePacket(c.Connection, packet)
-	c.Sequence++
+	e := c.Connection.WritePacket(packet)
 	return e
 }
 
 func (c *Client) SendPlayerListRequest() error {
 	packet := PlayerListRequestPacket{}
 	packet.Type = PacketTypePlayerListRequest
+	packet.Sequence = c.NextSequence()
 
-	e := WritePacket(c.Connection, packet)
-	c.Sequence++
+	e := c.Connection.WritePacket(packet)
 	return e
 }
 
 func (c *Client) SendGlobalChatRequest(message string) error {
 	packet := GlobalChatRequestPacket{}
 	packet.Type = PacketTypeGlobalChatRequest
+	packet.Sequence = c.NextSequence()
 	packet.Message = message
 
-	e := WritePacket(c.Connection, packet)
-	c.Sequence++
+	e := c.Connection.WritePacket(packet)
 	return e
 }
 
 func (c *Client) SendLobbyListRequest() error {
 	packet := LobbyListRequestPacket{}
 	packet.Type = PacketTypeLobbyListRequest
+	packet.Sequence = c.NextSequence()
 
-	e := WritePacket(c.Connection, packet)
-	c.Sequence++
+	e := c.Connection.WritePacket(packet)
 	return e
 }
 
 func (c *Client) SendJoinLobbyRequest(query string) error {
 	packet := JoinLobbyRequestPacket{}
 	packet.Type = PacketTypeJoinLobbyRequest
+	packet.Sequence = c.NextSequence()
 	packet.Name = query
 
-	e := WritePacket(c.Connection, packet)
-	c.Sequence++
+	e := c.Connection.WritePacket(packet)
 	return e
 }
 
 func (c *Client) SendGetArchivePile() {
 	c.SendGetCardPile(CardPileArchive)
 }
+
+// Version - Exchanges protocol versions with the server.
+func (c *Client) Version(ctx context.Context) (VersionPacket, error) {
+	packet := VersionPacket{}
+	packet.Type = PacketTypeVersionRequest
+	packet.Sequence = c.NextSequence()
+	packet.Version = ProtocolVersion
+
+	response, e := c.call(ctx, packet.Sequence, packet, PacketTypeVersionResponse)
+
+	if e != nil {
+		return VersionPacket{}, e
+	}
+
+	return response.(VersionPacket), nil
+}
+
+// Login - Logs in with a Vault user ID and token. The response carries the
+// session token used to resume after a disconnect.
+func (c *Client) Login(ctx context.Context, name string, id string, token string) (LoginResponsePacket, error) {
+	packet := LoginRequestPacket{}
+	packet.Type = PacketTypeLoginRequest
+	packet.Sequence = c.NextSequence()
+	packet.Name = name
+	packet.ID = id
+	packet.Token = token
+
+	response, e := c.call(ctx, packet.Sequence, packet, PacketTypeLoginResponse)
+
+	if e != nil {
+		return LoginResponsePacket{}, e
+	}
+
+	return response.(LoginResponsePacket), nil
+}
+
+// Resume - Resumes a session on this connection. The state snapshot which
+// follows a successful resume is delivered on the Packets channel.
+func (c *Client) Resume(ctx context.Context, session string) (ResumeResponsePacket, error) {
+	packet := ResumeRequestPacket{}
+	packet.Type = PacketTypeResumeRequest
+	packet.Sequence = c.NextSequence()
+	packet.Session = session
+
+	response, e := c.call(ctx, packet.Sequence, packet, PacketTypeResumeResponse)
+
+	if e != nil {
+		return ResumeResponsePacket{}, e
+	}
+
+	return response.(ResumeResponsePacket), nil
+}
+
+// Ping - Pings the server and waits for the answering pong.
+func (c *Client) Ping(ctx context.Context) (PongPacket, error) {
+	packet := PingPacket{}
+	packet.Type = PacketTypePing
+	packet.Sequence = c.NextSequence()
+	packet.Timestamp = time.Now().UnixNano()
+
+	response, e := c.call(ctx, packet.Sequence, packet, PacketTypePong)
+
+	if e != nil {
+		return PongPacket{}, e
+	}
+
+	return response.(PongPacket), nil
+}
+
+// PlayerList - Requests the list of players online.
+func (c *Client) PlayerList(ctx context.Context) (PlayerListResponsePacket, error) {
+	packet := PlayerListRequestPacket{}
+	packet.Type = PacketTypePlayerListRequest
+	packet.Sequence = c.NextSequence()
+
+	response, e := c.call(ctx, packet.Sequence, packet, PacketTypePlayerListResponse)
+
+	if e != nil {
+		return PlayerListResponsePacket{}, e
+	}
+
+	return response.(PlayerListResponsePacket), nil
+}
+
+// LobbyList - Requests the list of open lobbies.
+func (c *Client) LobbyList(ctx context.Context) (LobbyListResponsePacket, error) {
+	packet := LobbyListRequestPacket{}
+	packet.Type = PacketTypeLobbyListRequest
+	packet.Sequence = c.NextSequence()
+
+	response, e := c.call(ctx, packet.Sequence, packet, PacketTypeLobbyListResponse)
+
+	if e != nil {
+		return LobbyListResponsePacket{}, e
+	}
+
+	return response.(LobbyListResponsePacket), nil
+}
+
+// CreateLobby - Creates a lobby with the given name.
+func (c *Client) CreateLobby(ctx context.Context, name string) (CreateLobbyResponsePacket, error) {
+	packet := CreateLobbyRequestPacket{}
+	packet.Type = PacketTypeCreateLobbyRequest
+	packet.Sequence = c.NextSequence()
+	packet.Name = name
+
+	response, e := c.call(ctx, packet.Sequence, packet, PacketTypeCreateLobbyResponse)
+
+	if e != nil {
+		return CreateLobbyResponsePacket{}, e
+	}
+
+	return response.(CreateLobbyResponsePacket), nil
+}
+
+// JoinLobby - Joins a lobby by name.
+func (c *Client) JoinLobby(ctx context.Context, name string) (JoinLobbyResponsePacket, error) {
+	packet := JoinLobbyRequestPacket{}
+	packet.Type = PacketTypeJoinLobbyRequest
+	packet.Sequence = c.NextSequence()
+	packet.Name = name
+
+	response, e := c.call(ctx, packet.Sequence, packet, PacketTypeJoinLobbyResponse)
+
+	if e != nil {
+		return JoinLobbyResponsePacket{}, e
+	}
+
+	return response.(JoinLobbyResponsePacket), nil
+}
+
+// LeaveLobby - Leaves a lobby by name.
+func (c *Client) LeaveLobby(ctx context.Context, name string) (LeaveLobbyResponsePacket, error) {
+	packet := LeaveLobbyRequestPacket{}
+	packet.Type = PacketTypeLeaveLobbyRequest
+	packet.Sequence = c.NextSequence()
+	packet.Name = name
+
+	response, e := c.call(ctx, packet.Sequence, packet, PacketTypeLeaveLobbyResponse)
+
+	if e != nil {
+		return LeaveLobbyResponsePacket{}, e
+	}
+
+	return response.(LeaveLobbyResponsePacket), nil
+}
+
+// KickPlayer - Kicks a player from the lobby. Only the lobby host may kick.
+func (c *Client) KickPlayer(ctx context.Context, target string) (LobbyKickResponsePacket, error) {
+	packet := LobbyKickRequestPacket{}
+	packet.Type = PacketTypeKickLobbyRequest
+	packet.Sequence = c.NextSequence()
+	packet.Target = target
+
+	response, e := c.call(ctx, packet.Sequence, packet, PacketTypeKickLobbyResponse)
+
+	if e != nil {
+		return LobbyKickResponsePacket{}, e
+	}
+
+	return response.(LobbyKickResponsePacket), nil
+}
+
+// GlobalChat - Sends a message to every player and waits for it to be
+// echoed back.
+func (c *Client) GlobalChat(ctx context.Context, message string) (GlobalChatResponsePacket, error) {
+	packet := GlobalChatRequestPacket{}
+	packet.Type = PacketTypeGlobalChatRequest
+	packet.Sequence = c.NextSequence()
+	packet.Message = message
+
+	response, e := c.call(ctx, packet.Sequence, packet, PacketTypeGlobalChatResponse)
+
+	if e != nil {
+		return GlobalChatResponsePacket{}, e
+	}
+
+	return response.(GlobalChatResponsePacket), nil
+}
+
+// LobbyChat - Sends a message to the players in your lobby and waits for it
+// to be echoed back.
+func (c *Client) LobbyChat(ctx context.Context, message string) (LobbyChatResponsePacket, error) {
+	packet := LobbyChatRequestPacket{}
+	packet.Type = PacketTypeLobbyChatRequest
+	packet.Sequence = c.NextSequence()
+	packet.Message = message
+
+	response, e := c.call(ctx, packet.Sequence, packet, PacketTypeLobbyChatResponse)
+
+	if e != nil {
+		return LobbyChatResponsePacket{}, e
+	}
+
+	return response.(LobbyChatResponsePacket), nil
+}
+
+// Reload - Asks the server to reload its configuration and card data. Only
+// admins may do this.
+func (c *Client) Reload(ctx context.Context) (ReloadResponsePacket, error) {
+	packet := ReloadRequestPacket{}
+	packet.Type = PacketTypeReloadRequest
+	packet.Sequence = c.NextSequence()
+
+	response, e := c.call(ctx, packet.Sequence, packet, PacketTypeReloadResponse)
+
+	if e != nil {
+		return ReloadResponsePacket{}, e
+	}
+
+	return response.(ReloadResponsePacket), nil
+}
+
+// SelectDeck - Chooses the deck, by its Vault ID, to play the next game
+// with.
+func (c *Client) SelectDeck(ctx context.Context, deckID string) (SelectDeckResponsePacket, error) {
+	packet := SelectDeckRequestPacket{}
+	packet.Type = PacketTypeSelectDeckRequest
+	packet.Sequence = c.NextSequence()
+	packet.DeckID = deckID
+
+	response, e := c.call(ctx, packet.Sequence, packet, PacketTypeSelectDeckResponse)
+
+	if e != nil {
+		return SelectDeckResponsePacket{}, e
+	}
+
+	return response.(SelectDeckResponsePacket), nil
+}
+
+// SearchCards - Looks cards up in the server's card database. See
+// CardSearchSyntax for the search syntax. Pages count from one, and the
+// server limits how many cards a page may hold.
+func (c *Client) SearchCards(ctx context.Context, query string, page int, pageSize int) (CardSearchResponsePacket, error) {
+	packet := CardSearchRequestPacket{}
+	packet.Type = PacketTypeCardSearchRequest
+	packet.Sequence = c.NextSequence()
+	packet.Query = query
+	packet.Page = page
+	packet.PageSize = pageSize
+
+	response, e := c.call(ctx, packet.Sequence, packet, PacketTypeCardSearchResponse)
+
+	if e != nil {
+		return CardSearchResponsePacket{}, e
+	}
+
+	return response.(CardSearchResponsePacket), nil
+}
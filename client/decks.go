@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	kfnetwork "github.com/team-neutron-shark/keyforge-network"
+)
+
+// deckStoreDirectory - Where the local deck library is kept, unless
+// KF_DECK_STORE says otherwise.
+const deckStoreDirectory = "decks"
+
+var decks *kfnetwork.DeckStore
+var vaultUser *kfnetwork.VaultUser
+
+func openDeckStore() {
+	directory := os.Getenv("KF_DECK_STORE")
+
+	if directory == "" {
+		directory = deckStoreDirectory
+	}
+
+	store, e := kfnetwork.NewDeckStore(directory, 24*time.Hour)
+
+	if e != nil {
+		fmt.Println("Unable to open the deck library:", e.Error())
+		return
+	}
+
+	decks = store
+}
+
+// listDecks - Lists the decks in the local library, filtered by any
+// house:<house> or tag:<tag> arguments, with the rest matched against the
+// deck names. This works without a connection.
+func listDecks(args []string) {
+	if decks == nil {
+		fmt.Println("The deck library is not available.")
+		return
+	}
+
+	query := kfnetwork.DeckStoreQuery{}
+	name := []string{}
+
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "house:"):
+			query.Houses = append(query.Houses, strings.TrimPrefix(arg, "house:"))
+		case strings.HasPrefix(arg, "tag:"):
+			query.Tag = strings.TrimPrefix(arg, "tag:")
+		default:
+			name = append(name, arg)
+		}
+	}
+
+	query.Name = strings.Join(name, " ")
+	entries := decks.Search(query)
+
+	for _, entry := range entries {
+		fmt.Printf("(%s) %s [%s]", entry.ID, entry.Name, strings.Join(entry.Houses, ", "))
+
+		if len(entry.Tags) > 0 {
+			fmt.Printf(" tags: %s", strings.Join(entry.Tags, ", "))
+		}
+
+		fmt.Println()
+	}
+
+	fmt.Println(len(entries), "decks.")
+}
+
+// deck - Manages the local deck library: deck fetch <id>, deck refresh
+// <id>, deck tag <id> <tags>, deck untag <id> <tags> and deck remove <id>.
+func deck(args []string) error {
+	if decks == nil {
+		fmt.Println("The deck library is not available.")
+		return errors.New("deck library not available")
+	}
+
+	if len(args) < 2 {
+		fmt.Println("Usage: deck fetch|refresh|tag|untag|remove <deck id> [tags]")
+		return errors.New("not enough arguments provided")
+	}
+
+	var e error
+	id := args[1]
+
+	switch args[0] {
+	case "fetch", "refresh":
+		if vaultUser == nil {
+			fmt.Println("Please login before fetching decks from the Vault.")
+			return errors.New("not logged in to the Vault")
+		}
+
+		var fetched kfnetwork.Deck
+
+		if args[0] == "fetch" {
+			fetched, e = decks.Retrieve(context.Background(), kfnetwork.DefaultVaultClient, vaultUser, id)
+		} else {
+			fetched, e = decks.Refresh(context.Background(), kfnetwork.DefaultVaultClient, vaultUser, id)
+		}
+
+		if e == nil {
+			fmt.Printf("Stored %s with %d cards.\n", fetched.Name, len(fetched.Cards))
+		}
+	case "tag":
+		e = decks.Tag(id, args[2:]...)
+	case "untag":
+		e = decks.Untag(id, args[2:]...)
+	case "remove":
+		e = decks.Remove(id)
+	default:
+		e = fmt.Errorf("unknown deck command %s", args[0])
+	}
+
+	if e != nil {
+		fmt.Println("Deck command failed:", e.Error())
+	}
+
+	return e
+}
+
+// selectDeck - Chooses the deck to play with. The deck is also stored in
+// the local library, if it isn't already, so it can be browsed offline.
+func selectDeck(args []string) {
+	if len(args) < 1 {
+		return
+	}
+
+	response, e := client.SelectDeck(context.Background(), args[0])
+
+	if e != nil {
+		fmt.Println("Unable to select deck:", e.Error())
+		return
+	}
+
+	fmt.Printf("Selected %s [%s] with %d cards.\n", response.Name, strings.Join(response.Houses, ", "), response.Cards)
+
+	if decks != nil && vaultUser != nil {
+		if _, stored := decks.Entry(response.DeckID); !stored {
+			decks.Retrieve(context.Background(), kfnetwork.DefaultVaultClient, vaultUser, response.DeckID)
+		}
+	}
+}
@@ -2,9 +2,11 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 
 	kfnetwork "github.com/team-neutron-shark/keyforge-network"
@@ -12,9 +14,11 @@ import (
 
 var client *kfnetwork.Client
 var connected bool
+var session string
 
 func main() {
 	client = kfnetwork.NewClient()
+	openDeckStore()
 
 	for {
 		input, e := prompt()
@@ -60,6 +64,18 @@ func routeCommand(command string, args []string) {
 		who()
 	case "join":
 		join(args)
+	case "resume":
+		resume(args)
+	case "reload":
+		reload()
+	case "decks":
+		listDecks(args)
+	case "deck":
+		deck(args)
+	case "select":
+		selectDeck(args)
+	case "cards":
+		searchCards(args)
 	default:
 		fmt.Println("Command not found.")
 	}
@@ -102,7 +118,7 @@ func login(args []string) error {
 	username := args[0]
 	password := args[1]
 
-	user, e := kfnetwork.Login(username, password)
+	user, e := kfnetwork.Login(context.Background(), username, password)
 
 	if e != nil {
 		return e
@@ -120,10 +136,31 @@ func login(args []string) error {
 		return e
 	}
 
+	vaultUser = &user
 	fmt.Println("Logged in as user", username)
 	return nil
 }
 
+func resume(args []string) error {
+	if len(session) == 0 {
+		fmt.Println("No session to resume, please login.")
+		return errors.New("no session to resume")
+	}
+
+	if len(args) < 1 {
+		return errors.New("not enough arguments provided")
+	}
+
+	connected = false
+	e := connect(args)
+
+	if e != nil {
+		return e
+	}
+
+	return client.SendResumeRequest(session)
+}
+
 func createLobby(args []string) {
 	if len(args) < 1 {
 		return
@@ -159,25 +196,100 @@ func join(args []string) {
 		return
 	}
 
-	client.SendJoinLobbyRequest(args[1])
+	response, e := client.JoinLobby(context.Background(), strings.Join(args, " "))
+
+	if e != nil {
+		fmt.Println("Unable to join lobby:", e.Error())
+		return
+	}
+
+	joinLobbyResponse(response)
 }
 
-func readLoop() {
-	for {
-		packet, e := kfnetwork.ReadPacket(client.Connection)
+func reload() {
+	response, e := client.Reload(context.Background())
 
-		if e != nil {
-			logEntry := fmt.Sprintf("ReadPacket: %s", e.Error())
-			fmt.Println(logEntry)
-			return
+	if e != nil {
+		fmt.Println("Unable to reload the server:", e.Error())
+		return
+	}
+
+	fmt.Printf("Server reloaded with %d cards.\n", response.Cards)
+}
+
+// searchCards - Looks cards up on the server. A page:<n> term picks the page
+// of results and "cards help" explains the search syntax.
+func searchCards(args []string) {
+	if len(args) < 1 || args[0] == "help" {
+		fmt.Println(kfnetwork.CardSearchSyntax)
+		return
+	}
+
+	page := 1
+	terms := []string{}
+
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "page:") {
+			page, _ = strconv.Atoi(strings.TrimPrefix(arg, "page:"))
+			continue
 		}
 
+		terms = append(terms, arg)
+	}
+
+	response, e := client.SearchCards(context.Background(), strings.Join(terms, " "), page, 0)
+
+	if e != nil {
+		fmt.Println("Card search failed:", e.Error())
+		return
+	}
+
+	for _, card := range response.Cards {
+		fmt.Printf("%s (%s %s, %d/%03d)", card.CardTitle, card.House, card.CardType, card.Expansion, card.CardNumber)
+
+		if strings.EqualFold(card.CardType, "creature") {
+			fmt.Printf(" power %d armor %d", card.Power, card.Armor)
+		}
+
+		if card.Amber > 0 {
+			fmt.Printf(" +%d amber", card.Amber)
+		}
+
+		fmt.Println()
+
+		if card.CardText != "" {
+			for _, line := range strings.Split(card.Text().Render(kfnetwork.TerminalCardText), "\n") {
+				fmt.Println("   ", line)
+			}
+		}
+	}
+
+	fmt.Printf("Page %d, %d cards found.\n", response.Page, response.Total)
+}
+
+func readLoop() {
+	for packet := range client.Packets() {
 		handlePacket(packet)
 	}
+
+	if e := client.Err(); e != nil {
+		logEntry := fmt.Sprintf("ReadPacket: %s", e.Error())
+		fmt.Println(logEntry)
+	}
 }
 
 func handlePacket(packet kfnetwork.Packet) {
 	switch packet.GetHeader().Type {
+	case kfnetwork.PacketTypeError:
+		errorResponse(packet.(kfnetwork.ErrorPacket))
+	case kfnetwork.PacketTypeLoginResponse:
+		loginResponse(packet.(kfnetwork.LoginResponsePacket))
+	case kfnetwork.PacketTypeResumeResponse:
+		resumeResponse(packet.(kfnetwork.ResumeResponsePacket))
+	case kfnetwork.PacketTypeStateSnapshot:
+		stateSnapshot(packet.(kfnetwork.StateSnapshotPacket))
+	case kfnetwork.PacketTypeServerShutdown:
+		serverShutdown(packet.(kfnetwork.ServerShutdownPacket))
 	case kfnetwork.PacketTypePlayerListResponse:
 		playerListResponse(packet.(kfnetwork.PlayerListResponsePacket))
 	case kfnetwork.PacketTypeGlobalChatResponse:
@@ -189,6 +301,38 @@ func handlePacket(packet kfnetwork.Packet) {
 	}
 }
 
+func errorResponse(packet kfnetwork.ErrorPacket) {
+	fmt.Println("Error:", packet.Message)
+}
+
+func loginResponse(packet kfnetwork.LoginResponsePacket) {
+	session = packet.Session
+}
+
+func resumeResponse(packet kfnetwork.ResumeResponsePacket) {
+	if !packet.Success {
+		fmt.Println("Unable to resume session, please login again.")
+		session = ""
+		return
+	}
+
+	fmt.Println("Session resumed.")
+}
+
+func stateSnapshot(packet kfnetwork.StateSnapshotPacket) {
+	if packet.Lobby != nil {
+		fmt.Printf("You are in lobby %s (%s)\n", packet.Lobby.Name, packet.Lobby.ID)
+	}
+
+	if packet.Game != nil {
+		fmt.Printf("Game in progress: round %d, %d amber, %d keys, %d cards in hand\n", packet.Game.Round, packet.Game.Amber, packet.Game.Keys, len(packet.Game.Hand))
+	}
+}
+
+func serverShutdown(packet kfnetwork.ServerShutdownPacket) {
+	fmt.Println("Server is shutting down:", packet.Message)
+}
+
 func playerListResponse(packet kfnetwork.PlayerListResponsePacket) {
 	for _, entry := range packet.Players {
 		fmt.Println("ID:", entry.ID, "Name:", entry.Name)
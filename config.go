@@ -0,0 +1,444 @@
+package kfnetwork
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// ConfigurationEnvironmentPrefix - Prefix of the environment variables which
+// override configuration settings, such as KF_ADDRESS or KF_LOGGING_LEVEL.
+const ConfigurationEnvironmentPrefix = "KF_"
+
+// ServerConfiguration - Settings used to tune a running server.
+type ServerConfiguration struct {
+	// Address - The TCP address the server listens on.
+	Address string `json:"address"`
+	// WebSocketAddress - The address WebSocket clients connect to. Leave
+	// empty to disable WebSockets.
+	WebSocketAddress string `json:"websocket_address"`
+	// CardDataPath - The JSON file card data is loaded from. Cards learned
+	// from decks are saved here.
+	CardDataPath string `json:"card_data_path"`
+	// ExtraCardData - More JSON files, or directories of them, with card
+	// data for other expansions. They are loaded after CardDataPath.
+	ExtraCardData []string `json:"extra_card_data,omitempty"`
+	// CardReportPath - Where to write the card data validation report as
+	// JSON whenever card data is loaded. Leave empty to only log problems.
+	CardReportPath string `json:"card_report_path,omitempty"`
+	// Debug - Log connection and session activity in detail.
+	Debug bool `json:"debug"`
+	// Admins - IDs of the players allowed to use admin commands such as
+	// reloading the configuration.
+	Admins []string `json:"admins,omitempty"`
+	// LobbyCapacity - How many players may sit in a single lobby.
+	LobbyCapacity int `json:"lobby_capacity"`
+	// PingInterval - How often the server pings each connection.
+	PingInterval Duration `json:"ping_interval"`
+	// ReadTimeout - How long a connection may stay silent before it is
+	// considered dead and evicted. It must be longer than PingInterval.
+	ReadTimeout Duration `json:"read_timeout"`
+	// WriteTimeout - How long a single packet write may block.
+	WriteTimeout Duration `json:"write_timeout"`
+	// SessionGracePeriod - How long a disconnected player's seat is held
+	// for them to resume their session.
+	SessionGracePeriod Duration `json:"session_grace_period"`
+	// OutboundQueueSize - How many packets may wait to be written to a
+	// single connection.
+	OutboundQueueSize int `json:"outbound_queue_size"`
+	// SlowClientPolicy - What to do when a connection's outbound queue is
+	// full, either "drop" or "disconnect".
+	SlowClientPolicy SlowClientPolicy `json:"slow_client_policy"`
+	// GameDrainTimeout - How long a shutdown waits for running games to
+	// finish before saving them.
+	GameDrainTimeout Duration `json:"game_drain_timeout"`
+	// GameSaveDirectory - Where games still running at shutdown are saved.
+	GameSaveDirectory string `json:"game_save_directory"`
+	// DeckStoreDirectory - Where decks players select are cached.
+	DeckStoreDirectory string `json:"deck_store_directory"`
+	// DeckCacheTTL - How long a cached deck is used before it is fetched
+	// from the Vault again. Zero keeps cached decks forever.
+	DeckCacheTTL Duration `json:"deck_cache_ttl"`
+	// Logging - Log levels and sinks.
+	Logging LogConfiguration `json:"logging"`
+	// Audit - Who the packet audit log records and where it is written.
+	Audit AuditConfiguration `json:"audit"`
+	// Vault - Where the KeyForge Vault is and how long to wait for it.
+	Vault VaultConfiguration `json:"vault"`
+}
+
+// Duration - A time.Duration which is read from and written to JSON as a
+// human readable string such as "15s" or "1m30s".
+type Duration time.Duration
+
+// DefaultServerConfiguration - Returns the configuration used when no other
+// settings have been provided.
+func DefaultServerConfiguration() ServerConfiguration {
+	config := ServerConfiguration{}
+	config.Address = ":8888"
+	config.WebSocketAddress = ":8889"
+	config.CardDataPath = "data/cards.json"
+	config.Debug = true
+	config.LobbyCapacity = 2
+	config.PingInterval = Duration(15 * time.Second)
+	config.ReadTimeout = Duration(45 * time.Second)
+	config.WriteTimeout = Duration(10 * time.Second)
+	config.SessionGracePeriod = Duration(2 * time.Minute)
+	config.OutboundQueueSize = 256
+	config.SlowClientPolicy = SlowClientDisconnect
+	config.GameDrainTimeout = Duration(10 * time.Second)
+	config.GameSaveDirectory = "data/saves"
+	config.DeckStoreDirectory = "data/decks"
+	config.DeckCacheTTL = Duration(24 * time.Hour)
+	config.Logging = DefaultLogConfiguration()
+	config.Audit = DefaultAuditConfiguration()
+	config.Vault = DefaultVaultConfiguration()
+	return config
+}
+
+// CardDataPaths - Returns every file and directory card data is loaded
+// from, in order.
+func (c ServerConfiguration) CardDataPaths() []string {
+	return append([]string{c.CardDataPath}, c.ExtraCardData...)
+}
+
+// Validate - Checks the configuration for settings the server cannot run
+// with, returning every problem found in a single error.
+func (c ServerConfiguration) Validate() error {
+	problems := []string{}
+
+	if c.Address == "" {
+		problems = append(problems, "address must not be empty")
+	}
+
+	if c.LobbyCapacity < 2 {
+		problems = append(problems, "lobby_capacity must be at least 2")
+	}
+
+	durations := []struct {
+		name  string
+		value Duration
+	}{
+		{"ping_interval", c.PingInterval},
+		{"read_timeout", c.ReadTimeout},
+		{"write_timeout", c.WriteTimeout},
+		{"session_grace_period", c.SessionGracePeriod},
+		{"game_drain_timeout", c.GameDrainTimeout},
+		{"deck_cache_ttl", c.DeckCacheTTL},
+	}
+
+	for _, duration := range durations {
+		if duration.value < 0 {
+			problems = append(problems, duration.name+" must not be negative")
+		}
+	}
+
+	// A connection is only heard from between pings once it answers one, so
+	// a read timeout no longer than the ping interval evicts idle clients
+	// before their pong can arrive.
+	if c.PingInterval > 0 && c.ReadTimeout > 0 && c.ReadTimeout <= c.PingInterval {
+		problem := fmt.Sprintf("read_timeout (%s) must be longer than ping_interval (%s)",
+			time.Duration(c.ReadTimeout), time.Duration(c.PingInterval))
+		problems = append(problems, problem)
+	}
+
+	if c.OutboundQueueSize < 1 {
+		problems = append(problems, "outbound_queue_size must be at least 1")
+	}
+
+	if c.SlowClientPolicy != SlowClientDrop && c.SlowClientPolicy != SlowClientDisconnect {
+		problems = append(problems, fmt.Sprintf("slow_client_policy %q must be \"drop\" or \"disconnect\"", c.SlowClientPolicy))
+	}
+
+	if c.GameSaveDirectory == "" {
+		problems = append(problems, "game_save_directory must not be empty")
+	}
+
+	if c.DeckStoreDirectory == "" {
+		problems = append(problems, "deck_store_directory must not be empty")
+	}
+
+	problems = append(problems, c.Logging.problems("logging")...)
+
+	for i, sink := range c.Audit.Sinks {
+		problems = append(problems, sink.problems(fmt.Sprintf("audit.sinks[%d]", i))...)
+	}
+
+	problems = append(problems, c.Vault.problems("vault")...)
+
+	if len(problems) > 0 {
+		return errors.New("invalid configuration: " + strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// LoadConfig - Reads a configuration file on top of the defaults. Files
+// ending in .yaml or .yml are read as YAML, anything else as JSON. Unknown
+// settings are rejected so typos don't go unnoticed.
+func LoadConfig(filename string) (ServerConfiguration, error) {
+	config := DefaultServerConfiguration()
+
+	data, e := ioutil.ReadFile(filename)
+
+	if e != nil {
+		return config, e
+	}
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		data, e = YAMLToJSONFor(data, &config)
+
+		if e != nil {
+			return config, fmt.Errorf("%s: %s", filename, e.Error())
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	e = decoder.Decode(&config)
+
+	if e != nil {
+		return config, fmt.Errorf("%s: %s", filename, e.Error())
+	}
+
+	return config, nil
+}
+
+// SaveConfig - Writes the configuration to a file as JSON.
+func SaveConfig(config ServerConfiguration, filename string) error {
+	data, e := json.MarshalIndent(config, "", "    ")
+
+	if e != nil {
+		return e
+	}
+
+	return ioutil.WriteFile(filename, append(data, '\n'), 0644)
+}
+
+// ParseConfiguration - Builds the server configuration from, in increasing
+// priority, the defaults, a configuration file, environment variables and
+// command line flags. The file is named by the -config flag or the
+// KF_CONFIG environment variable. Every setting has a flag named after its
+// path, such as -ping-interval or -logging-level, and an environment
+// variable such as KF_PING_INTERVAL or KF_LOGGING_LEVEL. Boolean flags such
+// as -debug may be given without a value. The result is validated before it
+// is returned.
+func ParseConfiguration(name string, args []string) (ServerConfiguration, error) {
+	config := DefaultServerConfiguration()
+
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	path := flags.String("config", os.Getenv(ConfigurationEnvironmentPrefix+"CONFIG"), "configuration file to load, JSON or YAML")
+	overrides := make(map[string]reflect.Value)
+
+	// The fields point into config itself, so they still refer to the right
+	// settings after the file has been loaded over it.
+	visitConfiguration(reflect.ValueOf(&config).Elem(), nil, func(path []string, field reflect.Value) {
+		flagName := strings.ReplaceAll(strings.Join(path, "-"), "_", "-")
+		usage := fmt.Sprintf("overrides %s (default %s)", strings.Join(path, "."), formatConfigurationValue(field))
+		overrides[flagName] = field
+
+		if field.Kind() == reflect.Bool {
+			flags.Bool(flagName, false, usage)
+			return
+		}
+
+		flags.String(flagName, "", usage)
+	})
+
+	e := flags.Parse(args)
+
+	if e != nil {
+		return config, e
+	}
+
+	if *path != "" {
+		config, e = LoadConfig(*path)
+
+		if e != nil {
+			return config, e
+		}
+	}
+
+	e = ApplyEnvironment(&config)
+
+	if e != nil {
+		return config, e
+	}
+
+	var flagError error
+
+	flags.Visit(func(f *flag.Flag) {
+		field, ok := overrides[f.Name]
+
+		if !ok || flagError != nil {
+			return
+		}
+
+		e := setConfigurationValue(field, f.Value.String())
+
+		if e != nil {
+			flagError = fmt.Errorf("-%s: %s", f.Name, e.Error())
+		}
+	})
+
+	if flagError != nil {
+		return config, flagError
+	}
+
+	return config, config.Validate()
+}
+
+// ApplyEnvironment - Overrides configuration settings from KF_ environment
+// variables. Lists such as audit.players are given comma separated.
+func ApplyEnvironment(config *ServerConfiguration) error {
+	var result error
+
+	visitConfiguration(reflect.ValueOf(config).Elem(), nil, func(path []string, field reflect.Value) {
+		name := ConfigurationEnvironmentPrefix + strings.ToUpper(strings.Join(path, "_"))
+		value, ok := os.LookupEnv(name)
+
+		if !ok || result != nil {
+			return
+		}
+
+		e := setConfigurationValue(field, value)
+
+		if e != nil {
+			result = fmt.Errorf("%s: %s", name, e.Error())
+		}
+	})
+
+	return result
+}
+
+// visitConfiguration - Calls visit for every setting which can be given on
+// the command line or in the environment, along with its JSON path. Maps
+// and lists of structs can only be set from a file.
+func visitConfiguration(value reflect.Value, path []string, visit func(path []string, field reflect.Value)) {
+	valueType := value.Type()
+
+	for i := 0; i < valueType.NumField(); i++ {
+		field := valueType.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+
+		if name == "" || name == "-" {
+			continue
+		}
+
+		fieldPath := append(append([]string{}, path...), name)
+		fieldValue := value.Field(i)
+
+		switch fieldValue.Kind() {
+		case reflect.Struct:
+			visitConfiguration(fieldValue, fieldPath, visit)
+		case reflect.Map:
+			continue
+		case reflect.Slice:
+			if fieldValue.Type().Elem().Kind() == reflect.String {
+				visit(fieldPath, fieldValue)
+			}
+		default:
+			visit(fieldPath, fieldValue)
+		}
+	}
+}
+
+// setConfigurationValue - Sets a single setting from its text form, reusing
+// the setting's JSON decoding so durations, levels and so on are read the
+// same way they are from a file.
+func setConfigurationValue(field reflect.Value, text string) error {
+	if field.Kind() == reflect.Slice {
+		items := reflect.MakeSlice(field.Type(), 0, 0)
+
+		for _, item := range strings.Split(text, ",") {
+			item = strings.TrimSpace(item)
+
+			if item != "" {
+				items = reflect.Append(items, reflect.ValueOf(item).Convert(field.Type().Elem()))
+			}
+		}
+
+		field.Set(items)
+		return nil
+	}
+
+	target := field.Addr().Interface()
+	quoted, _ := json.Marshal(text)
+
+	if field.Kind() == reflect.String {
+		return json.Unmarshal(quoted, target)
+	}
+
+	if text == "" || text == "null" {
+		return errors.New("a value is required")
+	}
+
+	if json.Unmarshal([]byte(text), target) == nil {
+		return nil
+	}
+
+	return json.Unmarshal(quoted, target)
+}
+
+func formatConfigurationValue(field reflect.Value) string {
+	if field.Kind() == reflect.Slice {
+		items := []string{}
+
+		for i := 0; i < field.Len(); i++ {
+			items = append(items, field.Index(i).String())
+		}
+
+		return fmt.Sprintf("%q", strings.Join(items, ","))
+	}
+
+	data, e := json.Marshal(field.Interface())
+
+	if e != nil {
+		return "?"
+	}
+
+	return string(data)
+}
+
+// MarshalJSON - Encodes the duration as a string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON - Decodes a duration string such as "30s". Plain numbers are
+// treated as a number of seconds.
+func (d *Duration) UnmarshalJSON(bytes []byte) error {
+	var value interface{}
+
+	e := json.Unmarshal(bytes, &value)
+
+	if e != nil {
+		return e
+	}
+
+	switch v := value.(type) {
+	case float64:
+		*d = Duration(v * float64(time.Second))
+		return nil
+	case string:
+		duration, e := time.ParseDuration(v)
+
+		if e != nil {
+			return e
+		}
+
+		*d = Duration(duration)
+		return nil
+	default:
+		return errors.New("invalid duration")
+	}
+}
@@ -0,0 +1,66 @@
+package kfnetwork
+
+import (
+	"net"
+	"time"
+)
+
+// Connection - Abstracts the transport a player is connected over. Both raw
+// TCP sockets and WebSocket clients satisfy this interface so the server can
+// read, handle and answer packets without caring where they came from.
+type Connection interface {
+	ReadPacket() (Packet, error)
+	WritePacket(packet Packet) error
+	RemoteAddr() net.Addr
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+	Close() error
+}
+
+// TCPConnection - Connection implementation for raw TCP sockets. Packets are
+// framed with the binary header used by ReadPacket and WritePacket.
+type TCPConnection struct {
+	conn net.Conn
+}
+
+// NewTCPConnection - Wraps a net.Conn so it can be used as a Connection.
+func NewTCPConnection(conn net.Conn) *TCPConnection {
+	connection := new(TCPConnection)
+	connection.conn = conn
+	return connection
+}
+
+// Conn - Returns the underlying network connection.
+func (t *TCPConnection) Conn() net.Conn {
+	return t.conn
+}
+
+// ReadPacket - Reads the next packet off of the socket.
+func (t *TCPConnection) ReadPacket() (Packet, error) {
+	return ReadPacket(t.conn)
+}
+
+// WritePacket - Writes a packet to the socket.
+func (t *TCPConnection) WritePacket(packet Packet) error {
+	return WritePacket(t.conn, packet)
+}
+
+// RemoteAddr - Returns the address of the remote end of the socket.
+func (t *TCPConnection) RemoteAddr() net.Addr {
+	return t.conn.RemoteAddr()
+}
+
+// SetReadDeadline - Sets the deadline for the next read on the socket.
+func (t *TCPConnection) SetReadDeadline(deadline time.Time) error {
+	return t.conn.SetReadDeadline(deadline)
+}
+
+// SetWriteDeadline - Sets the deadline for the next write on the socket.
+func (t *TCPConnection) SetWriteDeadline(deadline time.Time) error {
+	return t.conn.SetWriteDeadline(deadline)
+}
+
+// Close - Closes the socket.
+func (t *TCPConnection) Close() error {
+	return t.conn.Close()
+}
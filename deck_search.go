@@ -0,0 +1,141 @@
+package kfnetwork
+
+import (
+	"context"
+)
+
+// DeckIterator - Walks every deck matching a query, one page at a time.
+// Pages are only requested as Next needs them, so stopping early costs no
+// more requests than were used. An iterator works on its own copy of the
+// query, so the query can be changed or reused while it runs.
+//
+//	decks := NewDeckIterator(ctx, client, &user, query)
+//
+//	for decks.Next() {
+//		fmt.Println(decks.Deck().Name)
+//	}
+//
+//	if decks.Err() != nil {
+//		...
+//	}
+type DeckIterator struct {
+	ctx      context.Context
+	client   VaultClient
+	user     *VaultUser
+	query    DeckQuery
+	page     []PartialDeckJSON
+	linked   []Card
+	index    int
+	pages    int
+	count    int
+	deck     PartialDeckJSON
+	finished bool
+	e        error
+}
+
+// NewDeckIterator - Returns an iterator over the decks matching query,
+// starting from the query's page. Requests are made with client on behalf
+// of user and give up once ctx is done.
+func NewDeckIterator(ctx context.Context, client VaultClient, user *VaultUser, query DeckQuery) *DeckIterator {
+	query.Houses = append([]string(nil), query.Houses...)
+	query.Values = copyValues(query.Values)
+
+	if query.Page < 1 {
+		query.Page = 1
+	}
+
+	if query.PageSize < 1 {
+		query.PageSize = DefaultDeckPageSize
+	}
+
+	iterator := new(DeckIterator)
+	iterator.ctx = ctx
+	iterator.client = client
+	iterator.user = user
+	iterator.query = query
+	iterator.count = -1
+	return iterator
+}
+
+// Next - Moves on to the next matching deck, fetching another page when
+// the current one runs out. It returns false once there are no more decks
+// or a request fails; Err tells the two apart.
+func (i *DeckIterator) Next() bool {
+	for {
+		for i.index < len(i.page) {
+			deck := i.page[i.index]
+			i.index++
+
+			if i.query.Matches(deck, i.linked) {
+				i.deck = deck
+				return true
+			}
+		}
+
+		if i.finished || i.e != nil {
+			return false
+		}
+
+		i.fetch()
+	}
+}
+
+// fetch - Requests the next page of results.
+func (i *DeckIterator) fetch() {
+	query := i.query
+	result, e := i.client.SearchDecks(i.ctx, i.user, &query)
+
+	if e != nil {
+		i.e = e
+		return
+	}
+
+	i.page = result.Decks
+	i.linked = result.Linked.Cards
+	i.index = 0
+	i.count = result.Count
+	i.pages++
+	i.query.Page++
+
+	// The Vault reports the total number of matches, but a short or empty
+	// page also means the end in case it changed while we were reading.
+	seen := (i.query.Page - 1) * i.query.PageSize
+
+	if len(result.Decks) < i.query.PageSize || seen >= result.Count {
+		i.finished = true
+	}
+}
+
+// Deck - Returns the deck Next moved on to.
+func (i *DeckIterator) Deck() PartialDeckJSON {
+	return i.deck
+}
+
+// Err - Returns the error which stopped the iterator, if any.
+func (i *DeckIterator) Err() error {
+	return i.e
+}
+
+// Count - Returns the number of decks the Vault says match the query,
+// before any filtering done by the client, or -1 before the first page has
+// been fetched.
+func (i *DeckIterator) Count() int {
+	return i.count
+}
+
+// Pages - Returns how many pages have been fetched so far.
+func (i *DeckIterator) Pages() int {
+	return i.pages
+}
+
+// SearchAllDecks - Returns every deck matching the query, across all pages.
+func SearchAllDecks(ctx context.Context, client VaultClient, user *VaultUser, query DeckQuery) ([]PartialDeckJSON, error) {
+	decks := []PartialDeckJSON{}
+	iterator := NewDeckIterator(ctx, client, user, query)
+
+	for iterator.Next() {
+		decks = append(decks, iterator.Deck())
+	}
+
+	return decks, iterator.Err()
+}
@@ -0,0 +1,420 @@
+package kfnetwork
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrDeckNotStored - Returned when a deck isn't in the deck store.
+var ErrDeckNotStored = errors.New("deck not in the deck store")
+
+// deckStoreIndex - The name of the index file kept alongside the decks.
+const deckStoreIndex = "index.json"
+
+// DeckStoreEntry - What the deck store's index knows about a deck, enough to
+// list and search decks without reading each one from disk.
+type DeckStoreEntry struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Expansion   int       `json:"expansion"`
+	Houses      []string  `json:"houses"`
+	Tags        []string  `json:"tags,omitempty"`
+	RetrievedAt time.Time `json:"retrieved_at"`
+}
+
+// HasTag - Determine whether the deck carries a tag, ignoring case.
+func (d DeckStoreEntry) HasTag(tag string) bool {
+	for _, t := range d.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DeckStoreQuery - Filters for searching the deck store. Empty fields match
+// every deck.
+type DeckStoreQuery struct {
+	// Name - Part of the deck's name, ignoring case.
+	Name string
+	// Houses - Houses the deck must all have.
+	Houses []string
+	// Tag - A tag the deck must carry.
+	Tag string
+}
+
+// Matches - Determine whether an entry passes the query's filters.
+func (q DeckStoreQuery) Matches(entry DeckStoreEntry) bool {
+	if !strings.Contains(strings.ToLower(entry.Name), strings.ToLower(q.Name)) {
+		return false
+	}
+
+	if q.Tag != "" && !entry.HasTag(q.Tag) {
+		return false
+	}
+
+	for _, want := range q.Houses {
+		found := false
+
+		for _, house := range entry.Houses {
+			if strings.EqualFold(house, want) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// DeckStore - A local library of decks, kept as one JSON file per deck in a
+// directory along with an index. Decks retrieved from the Vault through the
+// store are cached by their Vault ID and only fetched again once they are
+// older than the TTL, or when refreshed by hand. If the Vault can't be
+// reached the cached copy is used however old it is, so decks which have
+// been seen once keep working offline.
+type DeckStore struct {
+	storeMutex sync.RWMutex
+	directory  string
+	ttl        time.Duration
+	entries    map[string]DeckStoreEntry
+}
+
+// NewDeckStore - Returns a deck store kept in directory, reading its index
+// if there is one. The directory is created when the first deck is stored.
+// Decks are refetched from the Vault after ttl; a ttl of zero keeps them
+// forever.
+func NewDeckStore(directory string, ttl time.Duration) (*DeckStore, error) {
+	store := new(DeckStore)
+	store.directory = directory
+	store.ttl = ttl
+	store.entries = make(map[string]DeckStoreEntry)
+
+	data, e := ioutil.ReadFile(filepath.Join(directory, deckStoreIndex))
+
+	if os.IsNotExist(e) {
+		return store, nil
+	}
+
+	if e != nil {
+		return nil, e
+	}
+
+	entries := []DeckStoreEntry{}
+	e = json.Unmarshal(data, &entries)
+
+	if e != nil {
+		return nil, fmt.Errorf("%s: %s", filepath.Join(directory, deckStoreIndex), e.Error())
+	}
+
+	for _, entry := range entries {
+		store.entries[entry.ID] = entry
+	}
+
+	return store, nil
+}
+
+// Directory - Returns the directory the store is kept in.
+func (d *DeckStore) Directory() string {
+	return d.directory
+}
+
+// SetTTL - Changes how long decks are kept before being refetched.
+func (d *DeckStore) SetTTL(ttl time.Duration) {
+	d.storeMutex.Lock()
+	defer d.storeMutex.Unlock()
+
+	d.ttl = ttl
+}
+
+// Put - Stores a deck, replacing any earlier copy but keeping its tags.
+func (d *DeckStore) Put(deck Deck) error {
+	if deck.ID == "" {
+		return errors.New("deck has no ID")
+	}
+
+	d.storeMutex.Lock()
+	defer d.storeMutex.Unlock()
+
+	e := os.MkdirAll(d.directory, 0755)
+
+	if e != nil {
+		return e
+	}
+
+	e = writeJSONFile(d.deckPath(deck.ID), deck)
+
+	if e != nil {
+		return e
+	}
+
+	entry := DeckStoreEntry{
+		ID:          deck.ID,
+		Name:        deck.Name,
+		Expansion:   deck.Expansion,
+		Houses:      deck.Houses,
+		Tags:        d.entries[deck.ID].Tags,
+		RetrievedAt: time.Now(),
+	}
+
+	d.entries[deck.ID] = entry
+	return d.writeIndex()
+}
+
+// Get - Returns a stored deck, however old it is.
+func (d *DeckStore) Get(id string) (Deck, error) {
+	d.storeMutex.RLock()
+	defer d.storeMutex.RUnlock()
+
+	if _, ok := d.entries[id]; !ok {
+		return Deck{}, ErrDeckNotStored
+	}
+
+	return LoadDeckFromFile(d.deckPath(id))
+}
+
+// Entry - Returns the index entry for a stored deck.
+func (d *DeckStore) Entry(id string) (DeckStoreEntry, bool) {
+	d.storeMutex.RLock()
+	defer d.storeMutex.RUnlock()
+
+	entry, ok := d.entries[id]
+	return entry, ok
+}
+
+// Expired - Determine whether a deck is missing or older than the TTL.
+func (d *DeckStore) Expired(id string) bool {
+	d.storeMutex.RLock()
+	defer d.storeMutex.RUnlock()
+
+	entry, ok := d.entries[id]
+
+	if !ok {
+		return true
+	}
+
+	return d.ttl > 0 && time.Since(entry.RetrievedAt) > d.ttl
+}
+
+// Retrieve - Returns a deck from the store, fetching it from the Vault with
+// client first if it isn't stored or has expired. If the Vault can't be
+// reached but an older copy is stored, that copy is returned instead. Other
+// failures, such as a revoked token or a deck deleted from the Vault, are
+// returned even when the deck is stored.
+func (d *DeckStore) Retrieve(ctx context.Context, client VaultClient, user *VaultUser, id string) (Deck, error) {
+	if !d.Expired(id) {
+		return d.Get(id)
+	}
+
+	deck, e := d.Refresh(ctx, client, user, id)
+
+	if e != nil {
+		if !vaultUnreachable(e) {
+			return Deck{}, e
+		}
+
+		if stored, storedError := d.Get(id); storedError == nil {
+			return stored, nil
+		}
+
+		return Deck{}, e
+	}
+
+	return deck, nil
+}
+
+// vaultUnreachable - Determine whether an error means the Vault couldn't
+// answer, rather than that it turned the request down.
+func vaultUnreachable(e error) bool {
+	var netError net.Error
+
+	switch {
+	case errors.Is(e, ErrVaultUnavailable), errors.Is(e, ErrRateLimited):
+		return true
+	case errors.Is(e, context.DeadlineExceeded), errors.Is(e, context.Canceled):
+		return true
+	}
+
+	return errors.As(e, &netError)
+}
+
+// Refresh - Fetches a deck from the Vault and stores it, whether or not it
+// has expired.
+func (d *DeckStore) Refresh(ctx context.Context, client VaultClient, user *VaultUser, id string) (Deck, error) {
+	deck, e := client.RetrieveDeck(ctx, user, id)
+
+	if e != nil {
+		return Deck{}, e
+	}
+
+	e = d.Put(deck)
+
+	if e != nil {
+		return Deck{}, e
+	}
+
+	return deck, nil
+}
+
+// Remove - Deletes a deck from the store.
+func (d *DeckStore) Remove(id string) error {
+	d.storeMutex.Lock()
+	defer d.storeMutex.Unlock()
+
+	if _, ok := d.entries[id]; !ok {
+		return ErrDeckNotStored
+	}
+
+	delete(d.entries, id)
+	e := os.Remove(d.deckPath(id))
+
+	if e != nil && !os.IsNotExist(e) {
+		return e
+	}
+
+	return d.writeIndex()
+}
+
+// List - Returns every stored deck, sorted by name.
+func (d *DeckStore) List() []DeckStoreEntry {
+	return d.Search(DeckStoreQuery{})
+}
+
+// Search - Returns the stored decks matching the query, sorted by name.
+func (d *DeckStore) Search(query DeckStoreQuery) []DeckStoreEntry {
+	d.storeMutex.RLock()
+	defer d.storeMutex.RUnlock()
+
+	entries := []DeckStoreEntry{}
+
+	for _, entry := range d.entries {
+		if query.Matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Name != entries[j].Name {
+			return entries[i].Name < entries[j].Name
+		}
+
+		return entries[i].ID < entries[j].ID
+	})
+
+	return entries
+}
+
+// Tag - Adds tags to a stored deck.
+func (d *DeckStore) Tag(id string, tags ...string) error {
+	d.storeMutex.Lock()
+	defer d.storeMutex.Unlock()
+
+	entry, ok := d.entries[id]
+
+	if !ok {
+		return ErrDeckNotStored
+	}
+
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+
+		if tag != "" && !entry.HasTag(tag) {
+			entry.Tags = append(entry.Tags, tag)
+		}
+	}
+
+	d.entries[id] = entry
+	return d.writeIndex()
+}
+
+// Untag - Removes tags from a stored deck.
+func (d *DeckStore) Untag(id string, tags ...string) error {
+	d.storeMutex.Lock()
+	defer d.storeMutex.Unlock()
+
+	entry, ok := d.entries[id]
+
+	if !ok {
+		return ErrDeckNotStored
+	}
+
+	kept := []string{}
+
+	for _, existing := range entry.Tags {
+		remove := false
+
+		for _, tag := range tags {
+			remove = remove || strings.EqualFold(existing, tag)
+		}
+
+		if !remove {
+			kept = append(kept, existing)
+		}
+	}
+
+	entry.Tags = kept
+	d.entries[id] = entry
+	return d.writeIndex()
+}
+
+func (d *DeckStore) deckPath(id string) string {
+	// Vault IDs are UUIDs, but make sure an ID can't point outside the
+	// store.
+	name := strings.NewReplacer("/", "_", "\\", "_", "..", "_").Replace(id)
+	return filepath.Join(d.directory, name+".json")
+}
+
+// writeIndex - Saves the index. The caller must hold the store lock.
+func (d *DeckStore) writeIndex() error {
+	entries := []DeckStoreEntry{}
+
+	for _, entry := range d.entries {
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID < entries[j].ID
+	})
+
+	e := os.MkdirAll(d.directory, 0755)
+
+	if e != nil {
+		return e
+	}
+
+	return writeJSONFile(filepath.Join(d.directory, deckStoreIndex), entries)
+}
+
+// writeJSONFile - Writes a value as indented JSON, through a temporary file
+// so a crash never leaves a half written file behind.
+func writeJSONFile(path string, value interface{}) error {
+	data, e := json.MarshalIndent(value, "", "    ")
+
+	if e != nil {
+		return e
+	}
+
+	temporary := path + ".tmp"
+	e = ioutil.WriteFile(temporary, data, 0644)
+
+	if e != nil {
+		return e
+	}
+
+	return os.Rename(temporary, path)
+}
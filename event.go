@@ -1,10 +1,106 @@
 package kfnetwork
 
-import "net"
+// EventTopic - Names a kind of event so observers can subscribe to just the
+// events they care about.
+type EventTopic string
 
-type Event interface{}
+const (
+	TopicNetwork        EventTopic = "network"
+	TopicPlayerLoggedIn EventTopic = "player.logged_in"
+	TopicLobbyCreated   EventTopic = "lobby.created"
+	TopicCardPlayed     EventTopic = "game.card_played"
+	TopicKeyForged      EventTopic = "game.key_forged"
+	TopicGameEnded      EventTopic = "game.ended"
+	TopicServerReloaded EventTopic = "server.reloaded"
+)
 
+// Event - Something which happened on the server that observers may want to
+// know about.
+type Event interface {
+	Topic() EventTopic
+}
+
+// NetworkEvent - A packet arrived on a connection.
 type NetworkEvent struct {
-	connection *net.Conn
+	connection Connection
 	packet     *Packet
 }
+
+func (e NetworkEvent) Topic() EventTopic {
+	return TopicNetwork
+}
+
+// Connection - Returns the connection the packet arrived on.
+func (e NetworkEvent) Connection() Connection {
+	return e.connection
+}
+
+// Packet - Returns the packet which arrived.
+func (e NetworkEvent) Packet() Packet {
+	return *e.packet
+}
+
+// PlayerLoggedInEvent - A player finished logging in.
+type PlayerLoggedInEvent struct {
+	Player *Player
+}
+
+func (e PlayerLoggedInEvent) Topic() EventTopic {
+	return TopicPlayerLoggedIn
+}
+
+// LobbyCreatedEvent - A player created a new lobby.
+type LobbyCreatedEvent struct {
+	Lobby *Lobby
+	Host  *Player
+}
+
+func (e LobbyCreatedEvent) Topic() EventTopic {
+	return TopicLobbyCreated
+}
+
+// CardPlayedEvent - A player played a card from their hand.
+type CardPlayedEvent struct {
+	Game   *Game
+	Player *Player
+	Card   Card
+}
+
+func (e CardPlayedEvent) Topic() EventTopic {
+	return TopicCardPlayed
+}
+
+// KeyForgedEvent - A player forged a key.
+type KeyForgedEvent struct {
+	Game   *Game
+	Player *Player
+	Keys   int
+}
+
+func (e KeyForgedEvent) Topic() EventTopic {
+	return TopicKeyForged
+}
+
+// GameEndedEvent - A game finished. Winner is nil if the game was abandoned
+// without one.
+type GameEndedEvent struct {
+	Game   *Game
+	Winner *Player
+	Reason string
+}
+
+func (e GameEndedEvent) Topic() EventTopic {
+	return TopicGameEnded
+}
+
+// ServerReloadedEvent - The server reloaded its configuration and card
+// data. Config is the configuration now in effect and Cards the card
+// database new games will use.
+type ServerReloadedEvent struct {
+	Config ServerConfiguration
+	Cards  *CardManager
+}
+
+func (e ServerReloadedEvent) Topic() EventTopic {
+	return TopicServerReloaded
+}
@@ -1,55 +1,231 @@
 package kfnetwork
 
-import "sync"
-
-var eventManagerOnce sync.Once
-var eventManagerSingleton *EventManager
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
 
+// EventManager - Delivers events to the observers subscribed to them.
+// Observers can subscribe to every event or to a set of topics, and can ask
+// for delivery on their own goroutine so that a slow observer never holds
+// up whoever published the event.
 type EventManager struct {
-	observers []Observer
+	logger        *LogManager
+	eventMutex    sync.RWMutex
+	subscriptions []*Subscription
 }
 
-func Events() *EventManager {
-	eventManagerOnce.Do(func() {
-		eventManagerSingleton = new(EventManager)
-		eventManagerSingleton.AddObserver(Logger())
-	})
+// Subscription - An observer's registration with an event manager.
+type Subscription struct {
+	observer  Observer
+	topics    map[EventTopic]bool
+	queue     chan Event
+	done      chan struct{}
+	dropped   uint64
+	closeOnce sync.Once
+}
+
+// NewEventManager - Returns a pointer to a new event manager with the given
+// logger subscribed to network events asynchronously.
+func NewEventManager(logger *LogManager) *EventManager {
+	eventManager := new(EventManager)
+	eventManager.logger = logger
+	eventManager.SubscribeAsync(logger, 1024, TopicNetwork)
+	return eventManager
+}
+
+// Subscribe - Delivers events on the given topics, or every event if no
+// topics are given, by calling the observer directly from Publish.
+func (e *EventManager) Subscribe(observer Observer, topics ...EventTopic) *Subscription {
+	subscription := newSubscription(observer, topics)
+
+	e.eventMutex.Lock()
+	e.subscriptions = append(e.subscriptions, subscription)
+	e.eventMutex.Unlock()
+
+	return subscription
+}
+
+// SubscribeAsync - Like Subscribe, but events are queued on a buffered
+// channel of the given size and delivered on a goroutine of their own. If
+// the observer falls so far behind that the buffer fills, further events
+// are dropped and counted rather than blocking the publisher.
+func (e *EventManager) SubscribeAsync(observer Observer, buffer int, topics ...EventTopic) *Subscription {
+	if buffer < 1 {
+		buffer = 1
+	}
+
+	subscription := newSubscription(observer, topics)
+	subscription.queue = make(chan Event, buffer)
+	subscription.done = make(chan struct{})
+
+	go func() {
+		defer close(subscription.done)
+
+		for event := range subscription.queue {
+			e.deliver(subscription, event)
+		}
+	}()
+
+	e.eventMutex.Lock()
+	e.subscriptions = append(e.subscriptions, subscription)
+	e.eventMutex.Unlock()
+
+	return subscription
+}
+
+// Unsubscribe - Stops delivering events to a subscription. Events already
+// queued for an asynchronous subscription are still delivered.
+func (e *EventManager) Unsubscribe(subscription *Subscription) {
+	e.eventMutex.Lock()
+	defer e.eventMutex.Unlock()
+
+	subscriptions := []*Subscription{}
+
+	for _, s := range e.subscriptions {
+		if s != subscription {
+			subscriptions = append(subscriptions, s)
+		}
+	}
+
+	e.subscriptions = subscriptions
+	subscription.close()
+}
+
+// Publish - Hands an event to every subscription interested in its topic.
+// Synchronous observers have run by the time Publish returns.
+func (e *EventManager) Publish(event Event) {
+	synchronous := []*Subscription{}
+
+	// Queue sends happen under the lock so Unsubscribe can't close a queue
+	// out from under us. Direct calls wait until it is released, leaving
+	// observers free to publish or subscribe themselves.
+	e.eventMutex.RLock()
+
+	for _, subscription := range e.subscriptions {
+		if !subscription.Wants(event.Topic()) {
+			continue
+		}
+
+		if subscription.queue == nil {
+			synchronous = append(synchronous, subscription)
+			continue
+		}
 
-	return eventManagerSingleton
+		select {
+		case subscription.queue <- event:
+		default:
+			atomic.AddUint64(&subscription.dropped, 1)
+		}
+	}
+
+	e.eventMutex.RUnlock()
+
+	for _, subscription := range synchronous {
+		e.deliver(subscription, event)
+	}
+}
+
+// Close - Unsubscribes everyone and waits for asynchronous observers to
+// work through the events already queued for them.
+func (e *EventManager) Close() {
+	e.eventMutex.Lock()
+	subscriptions := e.subscriptions
+	e.subscriptions = nil
+	e.eventMutex.Unlock()
+
+	for _, subscription := range subscriptions {
+		subscription.close()
+		subscription.Wait()
+	}
 }
 
-// AddObserver - Adds an observer to the list of observers. Observers would be
+// AddObserver - Subscribes an observer to every event. Observers would be
 // types such as loggers, packet responders, and other "classes" that need to
 // concern themselves with incoming packet events.
 func (e *EventManager) AddObserver(observer Observer) {
-	e.observers = append(e.observers, observer)
+	e.Subscribe(observer)
 }
 
-// RemoveObserver - Removes an observer from the list of observers. Generally
-// one wouldn't want to do this in practice, but it's there if we need it.
+// RemoveObserver - Removes every subscription belonging to an observer.
 func (e *EventManager) RemoveObserver(observer Observer) {
-	observers := []Observer{}
+	e.eventMutex.RLock()
+	matches := []*Subscription{}
 
-	for _, o := range e.observers {
-		if o != observer {
-			observers = append(observers, o)
+	for _, subscription := range e.subscriptions {
+		if subscription.observer == observer {
+			matches = append(matches, subscription)
 		}
 	}
 
-	e.observers = observers
+	e.eventMutex.RUnlock()
+
+	for _, subscription := range matches {
+		e.Unsubscribe(subscription)
+	}
 }
 
-// NotifyObservers - Notifies observers that a network event has occured.
+// NotifyObservers - Notifies observers that an event has occured.
 func (e *EventManager) NotifyObservers(event Event) {
-	for _, observer := range e.observers {
-		observer.Notify(event)
-	}
+	e.Publish(event)
 }
 
+// Notify - Lets the event manager itself observe a subject, such as the
+// server, and pass what it sees on to its own subscribers.
 func (e *EventManager) Notify(event Event) {
-	switch event.(type) {
-	case NetworkEvent:
-		Logger().Log("eventmanager: network event received")
-		e.NotifyObservers(event)
+	e.Publish(event)
+}
+
+// deliver - Calls an observer, recovering from any panic so one broken
+// observer can't take down the caller or the other observers.
+func (e *EventManager) deliver(subscription *Subscription, event Event) {
+	defer func() {
+		if r := recover(); r != nil && e.logger != nil {
+			logEntry := fmt.Sprintf("Observer panicked handling %s event: %v", event.Topic(), r)
+			e.logger.Error(logEntry)
+		}
+	}()
+
+	subscription.observer.Notify(event)
+}
+
+func newSubscription(observer Observer, topics []EventTopic) *Subscription {
+	subscription := new(Subscription)
+	subscription.observer = observer
+	subscription.topics = make(map[EventTopic]bool)
+
+	for _, topic := range topics {
+		subscription.topics[topic] = true
 	}
+
+	return subscription
+}
+
+// Wants - Determine whether the subscription is interested in a topic.
+func (s *Subscription) Wants(topic EventTopic) bool {
+	return len(s.topics) == 0 || s.topics[topic]
+}
+
+// Dropped - Returns how many events were dropped because the subscription's
+// buffer was full.
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Wait - Blocks until an asynchronous subscription has been closed and has
+// delivered everything it had queued. Returns immediately for synchronous
+// subscriptions.
+func (s *Subscription) Wait() {
+	if s.done != nil {
+		<-s.done
+	}
+}
+
+func (s *Subscription) close() {
+	s.closeOnce.Do(func() {
+		if s.queue != nil {
+			close(s.queue)
+		}
+	})
 }
@@ -0,0 +1,171 @@
+package kfnetwork
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Expansion - A KeyForge set. ID is the number the Vault uses in
+// Card.Expansion, Code the short name players use, and Order the position
+// in the release order, counting from one.
+type Expansion struct {
+	ID     int      `json:"id"`
+	Code   string   `json:"code"`
+	Name   string   `json:"name"`
+	Order  int      `json:"order"`
+	Houses []string `json:"houses"`
+}
+
+// HasHouse - Determine whether the house is in the expansion's roster.
+func (e Expansion) HasHouse(house string) bool {
+	for _, h := range e.Houses {
+		if strings.EqualFold(h, house) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ExpansionRegistry - The known expansions, looked up by ID or code.
+type ExpansionRegistry struct {
+	registryMutex sync.RWMutex
+	expansions    map[int]Expansion
+}
+
+// NewExpansionRegistry - Returns a pointer to a new, empty registry.
+func NewExpansionRegistry() *ExpansionRegistry {
+	registry := new(ExpansionRegistry)
+	registry.expansions = make(map[int]Expansion)
+	return registry
+}
+
+// NewDefaultExpansionRegistry - Returns a registry holding the expansions
+// the server knows about out of the box.
+func NewDefaultExpansionRegistry() *ExpansionRegistry {
+	registry := NewExpansionRegistry()
+
+	registry.Register(Expansion{ID: 341, Code: "CotA", Name: "Call of the Archons", Order: 1,
+		Houses: []string{"Brobnar", "Dis", "Logos", "Mars", "Sanctum", "Shadows", "Untamed"}})
+	registry.Register(Expansion{ID: 435, Code: "AoA", Name: "Age of Ascension", Order: 2,
+		Houses: []string{"Brobnar", "Dis", "Logos", "Mars", "Sanctum", "Shadows", "Untamed"}})
+	registry.Register(Expansion{ID: 452, Code: "WC", Name: "Worlds Collide", Order: 3,
+		Houses: []string{"Brobnar", "Dis", "Logos", "Mars", "Saurian", "Star Alliance", "Untamed"}})
+	registry.Register(Expansion{ID: 479, Code: "MM", Name: "Mass Mutation", Order: 4,
+		Houses: []string{"Dis", "Logos", "Sanctum", "Saurian", "Shadows", "Star Alliance", "Untamed"}})
+
+	return registry
+}
+
+// DefaultExpansions - The registry used by the card database, card sorting
+// and card searches.
+var DefaultExpansions = NewDefaultExpansionRegistry()
+
+// Register - Adds an expansion, replacing any with the same ID.
+func (r *ExpansionRegistry) Register(expansion Expansion) {
+	r.registryMutex.Lock()
+	defer r.registryMutex.Unlock()
+
+	r.expansions[expansion.ID] = expansion
+}
+
+// LoadFromFile - Registers every expansion in a JSON file holding a list of
+// them, so new sets can be added without a new release.
+func (r *ExpansionRegistry) LoadFromFile(location string) error {
+	data, e := ioutil.ReadFile(location)
+
+	if e != nil {
+		return e
+	}
+
+	expansions := []Expansion{}
+	e = json.Unmarshal(data, &expansions)
+
+	if e != nil {
+		return fmt.Errorf("%s: %s", location, e.Error())
+	}
+
+	for _, expansion := range expansions {
+		r.Register(expansion)
+	}
+
+	return nil
+}
+
+// Lookup - Returns the expansion with the given Vault ID.
+func (r *ExpansionRegistry) Lookup(id int) (Expansion, bool) {
+	r.registryMutex.RLock()
+	defer r.registryMutex.RUnlock()
+
+	expansion, ok := r.expansions[id]
+	return expansion, ok
+}
+
+// Resolve - Finds an expansion by its ID, code or name, ignoring case.
+func (r *ExpansionRegistry) Resolve(name string) (Expansion, error) {
+	if id, e := strconv.Atoi(name); e == nil {
+		if expansion, ok := r.Lookup(id); ok {
+			return expansion, nil
+		}
+
+		return Expansion{}, fmt.Errorf("unknown expansion %d", id)
+	}
+
+	for _, expansion := range r.All() {
+		if strings.EqualFold(expansion.Code, name) || strings.EqualFold(expansion.Name, name) {
+			return expansion, nil
+		}
+	}
+
+	return Expansion{}, fmt.Errorf("unknown expansion %q", name)
+}
+
+// All - Returns every expansion in release order.
+func (r *ExpansionRegistry) All() []Expansion {
+	r.registryMutex.RLock()
+	expansions := []Expansion{}
+
+	for _, expansion := range r.expansions {
+		expansions = append(expansions, expansion)
+	}
+
+	r.registryMutex.RUnlock()
+
+	sort.Slice(expansions, func(i, j int) bool {
+		return r.Less(expansions[i].ID, expansions[j].ID)
+	})
+
+	return expansions
+}
+
+// Less - Determine whether the expansion with Vault ID a was released
+// before the one with ID b. Unknown expansions come after known ones, in
+// order of ID.
+func (r *ExpansionRegistry) Less(a, b int) bool {
+	first, firstKnown := r.Lookup(a)
+	second, secondKnown := r.Lookup(b)
+
+	switch {
+	case firstKnown && secondKnown && first.Order != second.Order:
+		return first.Order < second.Order
+	case firstKnown != secondKnown:
+		return firstKnown
+	}
+
+	return a < b
+}
+
+// ExpansionName - Returns the name of the card's expansion, or its Vault ID
+// if the expansion isn't known.
+func (c *Card) ExpansionName() string {
+	if expansion, ok := DefaultExpansions.Lookup(c.Expansion); ok {
+		return expansion.Name
+	}
+
+	return strconv.Itoa(c.Expansion)
+}
@@ -1,7 +1,11 @@
 package kfnetwork
 
 import (
+	"encoding/json"
 	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 )
 
 const (
@@ -81,23 +85,199 @@ type LobbyList struct {
 	Lobbies []LobbyListEntry
 }
 
+// LobbySnapshot - Summary of a lobby sent to a player resuming a session.
+type LobbySnapshot struct {
+	ID      string            `json:"id"`
+	Name    string            `json:"name"`
+	Host    string            `json:"host"`
+	Players []PlayerListEntry `json:"players"`
+}
+
+// GameSnapshot - The state of a game from one player's point of view, sent
+// to a player resuming a session.
+type GameSnapshot struct {
+	Running      bool   `json:"running"`
+	Turn         int    `json:"turn"`
+	Round        int    `json:"round"`
+	Active       bool   `json:"active"`
+	Amber        int    `json:"amber"`
+	Keys         int    `json:"keys"`
+	Chains       int    `json:"chains"`
+	Hand         []Card `json:"hand"`
+	Creatures    []Card `json:"creatures"`
+	Artifacts    []Card `json:"artifacts"`
+	DrawCount    int    `json:"draw_count"`
+	DiscardCount int    `json:"discard_count"`
+	ArchiveCount int    `json:"archive_count"`
+}
+
+// Game - A game between the players of a lobby. Cards is the card database
+// the game was started with; it is kept for the life of the game even if the
+// server reloads its card data.
 type Game struct {
+	ID      string
 	Seed    int64
 	Turn    int
 	Round   int
 	Running bool
 	Players []*Player
+	Events  *EventManager
+	Cards   *CardManager
 }
 
 func NewGame() *Game {
 	game := new(Game)
+	game.ID = GenerateUUID()
 	return game
 }
 
+// SavedPlayer - The part of a player's state written out with a saved game.
+type SavedPlayer struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Active      bool   `json:"active"`
+	FirstTurn   bool   `json:"first_turn"`
+	Amber       int    `json:"amber"`
+	Keys        int    `json:"keys"`
+	Chains      int    `json:"chains"`
+	Deck        Deck   `json:"deck"`
+	HandPile    []Card `json:"hand"`
+	DrawPile    []Card `json:"draw"`
+	DiscardPile []Card `json:"discard"`
+	ArchivePile []Card `json:"archive"`
+	PurgePile   []Card `json:"purge"`
+	Artifacts   []Card `json:"artifacts"`
+	Creatures   []Card `json:"creatures"`
+}
+
+// SavedGame - A game written to disk so it can be picked up again later.
+type SavedGame struct {
+	ID      string        `json:"id"`
+	Seed    int64         `json:"seed"`
+	Turn    int           `json:"turn"`
+	Round   int           `json:"round"`
+	Players []SavedPlayer `json:"players"`
+}
+
+// Snapshot - Returns the saveable state of the game.
+func (g *Game) Snapshot() SavedGame {
+	saved := SavedGame{}
+	saved.ID = g.ID
+	saved.Seed = g.Seed
+	saved.Turn = g.Turn
+	saved.Round = g.Round
+	saved.Players = []SavedPlayer{}
+
+	for _, player := range g.Players {
+		player.Lock()
+		entry := SavedPlayer{}
+		entry.ID = player.ID
+		entry.Name = player.Name
+		entry.Active = player.Active
+		entry.FirstTurn = player.FirstTurn
+		entry.Amber = player.Amber
+		entry.Keys = player.Keys
+		entry.Chains = player.Chains
+		entry.Deck = player.PlayerDeck
+		entry.HandPile = player.HandPile
+		entry.DrawPile = player.DrawPile
+		entry.DiscardPile = player.DiscardPile
+		entry.ArchivePile = player.ArchivePile
+		entry.PurgePile = player.PurgePile
+		entry.Artifacts = player.Artifacts
+		entry.Creatures = player.Creatures
+		player.Unlock()
+
+		saved.Players = append(saved.Players, entry)
+	}
+
+	return saved
+}
+
+// Save - Writes the game to <directory>/<id>.json and returns the path.
+func (g *Game) Save(directory string) (string, error) {
+	e := os.MkdirAll(directory, 0755)
+
+	if e != nil {
+		return "", e
+	}
+
+	bytes, e := json.MarshalIndent(g.Snapshot(), "", "  ")
+
+	if e != nil {
+		return "", e
+	}
+
+	filename := filepath.Join(directory, g.ID+".json")
+	return filename, ioutil.WriteFile(filename, bytes, 0644)
+}
+
 func (g *Game) Start() {
 
 }
 
+// RemovePlayer - Removes a player from the game. A running game which is left
+// with fewer than two players can't continue and is stopped.
+func (g *Game) RemovePlayer(player *Player) {
+	players := []*Player{}
+
+	for _, p := range g.Players {
+		if p != player {
+			players = append(players, p)
+		}
+	}
+
+	g.Players = players
+
+	if g.Running && len(g.Players) < 2 {
+		var winner *Player
+
+		if len(g.Players) == 1 {
+			winner = g.Players[0]
+		}
+
+		g.End(winner, "opponent left the game")
+	}
+}
+
+// PlayCard - Has a player play a card from their hand.
+func (g *Game) PlayCard(player *Player, card Card) {
+	player.PlayCard(card)
+	g.publish(CardPlayedEvent{Game: g, Player: player, Card: card})
+}
+
+// ForgeKey - Has a player attempt to forge a key. The first player to forge
+// three keys wins the game.
+func (g *Game) ForgeKey(player *Player) bool {
+	if !player.ForgeKey() {
+		return false
+	}
+
+	g.publish(KeyForgedEvent{Game: g, Player: player, Keys: player.Keys})
+
+	if player.Keys >= 3 {
+		g.End(player, "forged three keys")
+	}
+
+	return true
+}
+
+// End - Stops the game, naming the winner if there is one.
+func (g *Game) End(winner *Player, reason string) {
+	if !g.Running {
+		return
+	}
+
+	g.Running = false
+	g.publish(GameEndedEvent{Game: g, Winner: winner, Reason: reason})
+}
+
+func (g *Game) publish(event Event) {
+	if g.Events != nil {
+		g.Events.Publish(event)
+	}
+}
+
 func (g *Game) FindActivePlayer() (*Player, error) {
 	for _, player := range g.Players {
 		if player.Active {
@@ -0,0 +1,186 @@
+package kfnetwork
+
+import (
+	"errors"
+	"sync"
+)
+
+// PacketHandler - Handles one type of packet arriving on a connection. A
+// returned error is sent back to the client in an ErrorPacket.
+type PacketHandler func(client Connection, packet Packet) error
+
+// Middleware - Wraps a packet handler to run code before and after it. A
+// middleware rejects a packet by returning an error without calling next.
+type Middleware func(next PacketHandler) PacketHandler
+
+// HandlerRegistry - Maps packet types to the handlers which process them,
+// along with the middleware every packet passes through on the way. The
+// server's own handlers are registered here too, so any of them can be
+// replaced or wrapped.
+type HandlerRegistry struct {
+	handlerMutex sync.RWMutex
+	handlers     map[uint16]PacketHandler
+	middleware   []Middleware
+}
+
+// NewHandlerRegistry - Returns a pointer to a new, empty handler registry.
+func NewHandlerRegistry() *HandlerRegistry {
+	registry := new(HandlerRegistry)
+	registry.handlers = make(map[uint16]PacketHandler)
+	return registry
+}
+
+// Handle - Registers the handler for a packet type, replacing any handler
+// already registered for it.
+func (r *HandlerRegistry) Handle(packetType uint16, handler PacketHandler) {
+	r.handlerMutex.Lock()
+	defer r.handlerMutex.Unlock()
+
+	r.handlers[packetType] = handler
+}
+
+// Remove - Unregisters the handler for a packet type. Packets of that type
+// are ignored from then on.
+func (r *HandlerRegistry) Remove(packetType uint16) {
+	r.handlerMutex.Lock()
+	defer r.handlerMutex.Unlock()
+
+	delete(r.handlers, packetType)
+}
+
+// Handler - Returns the handler registered for a packet type, if any.
+func (r *HandlerRegistry) Handler(packetType uint16) (PacketHandler, bool) {
+	r.handlerMutex.RLock()
+	defer r.handlerMutex.RUnlock()
+
+	handler, ok := r.handlers[packetType]
+	return handler, ok
+}
+
+// Use - Adds middleware. Middleware runs in the order it was added, the
+// first added being the outermost.
+func (r *HandlerRegistry) Use(middleware ...Middleware) {
+	r.handlerMutex.Lock()
+	defer r.handlerMutex.Unlock()
+
+	r.middleware = append(r.middleware, middleware...)
+}
+
+// Before - Adds a hook which runs before every handler. If the hook returns
+// an error the packet is rejected and the handler never runs.
+func (r *HandlerRegistry) Before(hook func(client Connection, packet Packet) error) {
+	r.Use(func(next PacketHandler) PacketHandler {
+		return func(client Connection, packet Packet) error {
+			e := hook(client, packet)
+
+			if e != nil {
+				return e
+			}
+
+			return next(client, packet)
+		}
+	})
+}
+
+// After - Adds a hook which runs after every handler with the handler's
+// result.
+func (r *HandlerRegistry) After(hook func(client Connection, packet Packet, e error)) {
+	r.Use(func(next PacketHandler) PacketHandler {
+		return func(client Connection, packet Packet) error {
+			e := next(client, packet)
+			hook(client, packet, e)
+			return e
+		}
+	})
+}
+
+// Dispatch - Runs a packet through the middleware and on to its handler.
+// Packets with no registered handler are ignored.
+func (r *HandlerRegistry) Dispatch(client Connection, packet Packet) error {
+	r.handlerMutex.RLock()
+	handler, ok := r.handlers[packet.GetHeader().Type]
+	middleware := r.middleware
+	r.handlerMutex.RUnlock()
+
+	if !ok {
+		return nil
+	}
+
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+
+	return handler(client, packet)
+}
+
+// ErrPacketTypeReserved - Returned when registering a custom packet type
+// which falls inside the range used by the protocol itself.
+var ErrPacketTypeReserved = errors.New("packet types below PacketTypeUserDefined are reserved")
+
+// ErrPacketTypeRegistered - Returned when registering a custom packet type
+// which is already registered with a different struct.
+var ErrPacketTypeRegistered = errors.New("packet type already registered")
+
+// registerBuiltinHandlers - Registers the server's own handlers.
+func (s *Server) registerBuiltinHandlers() {
+	s.Handle(PacketTypeExit, func(client Connection, packet Packet) error {
+		return s.HandleExitRequest(client, packet.(ExitPacket))
+	})
+	s.Handle(PacketTypePing, func(client Connection, packet Packet) error {
+		return s.HandlePingRequest(client, packet.(PingPacket))
+	})
+	s.Handle(PacketTypeVersionRequest, func(client Connection, packet Packet) error {
+		return s.HandleVersionRequest(client, packet.(VersionPacket))
+	})
+	s.Handle(PacketTypeLoginRequest, func(client Connection, packet Packet) error {
+		return s.HandleLoginRequest(client, packet.(LoginRequestPacket))
+	})
+	s.Handle(PacketTypeResumeRequest, func(client Connection, packet Packet) error {
+		return s.HandleResumeRequest(client, packet.(ResumeRequestPacket))
+	})
+	s.Handle(PacketTypeGlobalChatRequest, func(client Connection, packet Packet) error {
+		return s.HandleGlobalChatRequest(client, packet.(GlobalChatRequestPacket))
+	})
+	s.Handle(PacketTypePlayerListRequest, func(client Connection, packet Packet) error {
+		return s.HandlePlayerListRequest(client, packet.(PlayerListRequestPacket))
+	})
+	s.Handle(PacketTypeCreateLobbyRequest, func(client Connection, packet Packet) error {
+		return s.HandleCreateLobbyRequest(client, packet.(CreateLobbyRequestPacket))
+	})
+	s.Handle(PacketTypeLobbyListRequest, func(client Connection, packet Packet) error {
+		return s.HandleLobbyListRequest(client, packet.(LobbyListRequestPacket))
+	})
+	s.Handle(PacketTypeJoinLobbyRequest, func(client Connection, packet Packet) error {
+		return s.HandleJoinLobbyRequest(client, packet.(JoinLobbyRequestPacket))
+	})
+	s.Handle(PacketTypeLeaveLobbyRequest, func(client Connection, packet Packet) error {
+		return s.HandleLeaveLobbyRequest(client, packet.(LeaveLobbyRequestPacket))
+	})
+	s.Handle(PacketTypeKickLobbyRequest, func(client Connection, packet Packet) error {
+		return s.HandleLobbyKickRequest(client, packet.(LobbyKickRequestPacket))
+	})
+	s.Handle(PacketTypeLobbyChatRequest, func(client Connection, packet Packet) error {
+		return s.HandleLobbyChatRequest(client, packet.(LobbyChatRequestPacket))
+	})
+	s.Handle(PacketTypeReloadRequest, func(client Connection, packet Packet) error {
+		return s.HandleReloadRequest(client, packet.(ReloadRequestPacket))
+	})
+	s.Handle(PacketTypeSelectDeckRequest, func(client Connection, packet Packet) error {
+		return s.HandleSelectDeckRequest(client, packet.(SelectDeckRequestPacket))
+	})
+	s.Handle(PacketTypeCardSearchRequest, func(client Connection, packet Packet) error {
+		return s.HandleCardSearchRequest(client, packet.(CardSearchRequestPacket))
+	})
+}
+
+// Handle - Registers a handler for a packet type on this server, replacing
+// the built in handler if there is one.
+func (s *Server) Handle(packetType uint16, handler PacketHandler) {
+	s.Handlers.Handle(packetType, handler)
+}
+
+// Use - Adds middleware which every packet passes through before reaching
+// its handler.
+func (s *Server) Use(middleware ...Middleware) {
+	s.Handlers.Use(middleware...)
+}
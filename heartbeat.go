@@ -0,0 +1,71 @@
+package kfnetwork
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// HeartbeatLoop - Pings a connection on the configured interval until the
+// done channel is closed. If a ping can't be written the connection is closed,
+// which in turn fails the read loop and evicts the player. A ping dropped
+// because the outbound queue is full is left to the slow client policy, so
+// under the drop policy the connection stays open.
+func (s *Server) HeartbeatLoop(client Connection, done chan struct{}) {
+	ticker := time.NewTicker(time.Duration(s.Configuration().PingInterval))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			e := s.SendPingRequest(client)
+
+			if errors.Is(e, ErrOutboundQueueFull) {
+				logEntry := fmt.Sprintf("Ping to %s dropped, outbound queue full.", client.RemoteAddr())
+				s.Logger.Subsystem("network").Debug(logEntry, RemoteFields(client))
+				continue
+			}
+
+			if e != nil {
+				logEntry := fmt.Sprintf("Unable to ping %s: %s", client.RemoteAddr(), e.Error())
+				s.Logger.Subsystem("network").Warn(logEntry, RemoteFields(client))
+				client.Close()
+				return
+			}
+		}
+	}
+}
+
+func (s *Server) SendPingRequest(client Connection) error {
+	packet := PingPacket{}
+	packet.Type = PacketTypePing
+	packet.Timestamp = time.Now().UnixNano()
+
+	e := s.WritePacket(client, packet)
+	return e
+}
+
+func (s *Server) SendPongResponse(client Connection, sequence uint16, timestamp int64) error {
+	packet := PongPacket{}
+	packet.Type = PacketTypePong
+	packet.Sequence = sequence
+	packet.Timestamp = timestamp
+
+	e := s.WritePacket(client, packet)
+	return e
+}
+
+// HandlePingRequest - Answers a ping sent by the client. Receiving the ping
+// has already pushed back the connection's read deadline.
+func (s *Server) HandlePingRequest(client Connection, packet PingPacket) error {
+	return s.SendPongResponse(client, packet.Sequence, packet.Timestamp)
+}
+
+// IsTimeout - Determine whether an error was caused by a deadline expiring.
+func IsTimeout(e error) bool {
+	netError, ok := e.(net.Error)
+	return ok && netError.Timeout()
+}
@@ -1,29 +1,221 @@
 package kfnetwork
 
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// ErrLobbyClosed - Returned when a command is sent to a lobby which has
+// already been shut down.
+var ErrLobbyClosed = errors.New("lobby closed")
+
+// ErrLobbyCommandPanicked - Returned by Execute when the command panicked.
+// The panic and its stack are logged through the lobby's logger.
+var ErrLobbyCommandPanicked = errors.New("lobby command failed")
+
+// LobbyCommand - A unit of work run on a lobby's own goroutine. Commands are
+// executed one at a time in the order they arrive, so Execute may read and
+// change the lobby and its game without any further locking. Results are
+// written back into the command itself for the sender to read once
+// Lobby.Execute returns.
+type LobbyCommand interface {
+	Execute(lobby *Lobby)
+}
+
+// Lobby - A group of players waiting for, or playing, a game. Each lobby runs
+// a goroutine which owns the lobby and its game; everything which changes
+// either should be sent to it as a LobbyCommand. The accessors are safe to
+// call from anywhere, but must not be used to make decisions which a
+// command could invalidate in the meantime.
 type Lobby struct {
-	id      string
-	host    *Player
-	players []*Player
-	game    *Game
-	name    string
+	id         string
+	lobbyMutex sync.RWMutex
+	host       *Player
+	players    []*Player
+	game       *Game
+	name       string
+	capacity   int
+	logger     *LogManager
+	manager    *LobbyManager
+	removed    bool
+	inbox      chan lobbyEnvelope
+	quit       chan struct{}
+	stopped    chan struct{}
+	closeOnce  sync.Once
+	timers     map[*time.Timer]struct{}
 }
 
+type lobbyEnvelope struct {
+	command LobbyCommand
+	done    chan error
+}
+
+// DefaultLobbyCapacity - How many players a lobby holds unless configured
+// otherwise.
+const DefaultLobbyCapacity = 2
+
+// NewLobby - Returns a pointer to a new lobby with its goroutine running.
+// Call Close once the lobby is no longer needed.
 func NewLobby() *Lobby {
 	lobby := new(Lobby)
+	lobby.capacity = DefaultLobbyCapacity
+	lobby.inbox = make(chan lobbyEnvelope, 64)
+	lobby.quit = make(chan struct{})
+	lobby.stopped = make(chan struct{})
+	lobby.timers = make(map[*time.Timer]struct{})
+
+	go lobby.run()
+
 	return lobby
 }
 
+func (l *Lobby) run() {
+	defer close(l.stopped)
+
+	for {
+		select {
+		case envelope := <-l.inbox:
+			l.execute(envelope)
+		case <-l.quit:
+			return
+		}
+	}
+}
+
+func (l *Lobby) execute(envelope lobbyEnvelope) {
+	var e error
+
+	if envelope.done != nil {
+		defer func() {
+			envelope.done <- e
+		}()
+	}
+
+	// A misbehaving command mustn't take the whole lobby down with it, but
+	// it is logged and reported to whoever sent it.
+	defer func() {
+		r := recover()
+
+		if r == nil {
+			return
+		}
+
+		e = ErrLobbyCommandPanicked
+
+		if logger := l.Logger(); logger != nil {
+			logEntry := fmt.Sprintf("Lobby command %T panicked: %v", envelope.command, r)
+			logger.Error(logEntry, Fields{"lobby_id": l.ID(), "stack": string(debug.Stack())})
+		}
+	}()
+
+	envelope.command.Execute(l)
+}
+
+// Execute - Runs a command on the lobby's goroutine and waits for it to
+// finish. ErrLobbyCommandPanicked is returned if the command panicked, in
+// which case the lobby may have been left part way through the change.
+// Must not be called from inside another command, since the lobby would be
+// waiting on itself.
+func (l *Lobby) Execute(command LobbyCommand) error {
+	done := make(chan error, 1)
+
+	select {
+	case l.inbox <- lobbyEnvelope{command: command, done: done}:
+	case <-l.stopped:
+		return ErrLobbyClosed
+	}
+
+	select {
+	case e := <-done:
+		return e
+	case <-l.stopped:
+		return ErrLobbyClosed
+	}
+}
+
+// Post - Queues a command without waiting for it to run.
+func (l *Lobby) Post(command LobbyCommand) error {
+	select {
+	case <-l.stopped:
+		return ErrLobbyClosed
+	default:
+	}
+
+	select {
+	case l.inbox <- lobbyEnvelope{command: command}:
+		return nil
+	case <-l.stopped:
+		return ErrLobbyClosed
+	}
+}
+
+// AfterFunc - Posts a command to the lobby once the duration has passed,
+// for things like turn clocks and ready timeouts. The returned timer can be
+// stopped to cancel it, and every pending timer is stopped when the lobby
+// closes.
+func (l *Lobby) AfterFunc(duration time.Duration, command LobbyCommand) *time.Timer {
+	var timer *time.Timer
+
+	l.lobbyMutex.Lock()
+	defer l.lobbyMutex.Unlock()
+
+	timer = time.AfterFunc(duration, func() {
+		l.lobbyMutex.Lock()
+		delete(l.timers, timer)
+		l.lobbyMutex.Unlock()
+
+		l.Post(command)
+	})
+
+	l.timers[timer] = struct{}{}
+	return timer
+}
+
+// Close - Stops the lobby's goroutine and any pending timers. Commands which
+// haven't run yet are discarded.
+func (l *Lobby) Close() {
+	l.closeOnce.Do(func() {
+		l.lobbyMutex.Lock()
+		for timer := range l.timers {
+			timer.Stop()
+		}
+		l.timers = make(map[*time.Timer]struct{})
+		l.lobbyMutex.Unlock()
+
+		close(l.quit)
+		<-l.stopped
+	})
+}
+
+// Players - Returns a copy of the lobby's player list.
 func (l *Lobby) Players() []*Player {
-	return l.players
+	l.lobbyMutex.RLock()
+	defer l.lobbyMutex.RUnlock()
+
+	players := make([]*Player, len(l.players))
+	copy(players, l.players)
+	return players
 }
 
+// AddPlayer - Seats a player if there is room. Only call this from a command
+// or before the lobby is shared.
 func (l *Lobby) AddPlayer(player *Player) {
-	if len(l.players) < 2 && !l.PlayerExists(player) {
+	l.lobbyMutex.Lock()
+	defer l.lobbyMutex.Unlock()
+
+	if len(l.players) < l.capacity && !l.hasPlayer(player) {
 		l.players = append(l.players, player)
 	}
 }
 
+// RemovePlayer - Removes a player. Only call this from a command.
 func (l *Lobby) RemovePlayer(player *Player) {
+	l.lobbyMutex.Lock()
+	defer l.lobbyMutex.Unlock()
+
 	players := []*Player{}
 
 	for _, p := range l.players {
@@ -36,6 +228,13 @@ func (l *Lobby) RemovePlayer(player *Player) {
 }
 
 func (l *Lobby) PlayerExists(player *Player) bool {
+	l.lobbyMutex.RLock()
+	defer l.lobbyMutex.RUnlock()
+
+	return l.hasPlayer(player)
+}
+
+func (l *Lobby) hasPlayer(player *Player) bool {
 	for _, p := range l.players {
 		if p == player {
 			return true
@@ -57,14 +256,243 @@ func (l *Lobby) SetName(name string) {
 	l.name = name
 }
 
+// Capacity - Returns how many players the lobby may hold.
+func (l *Lobby) Capacity() int {
+	l.lobbyMutex.RLock()
+	defer l.lobbyMutex.RUnlock()
+
+	return l.capacity
+}
+
+// SetCapacity - Sets how many players the lobby may hold.
+func (l *Lobby) SetCapacity(capacity int) {
+	l.lobbyMutex.Lock()
+	defer l.lobbyMutex.Unlock()
+
+	l.capacity = capacity
+}
+
+// Logger - Returns the logger the lobby reports failed commands to, or nil.
+func (l *Lobby) Logger() *LogManager {
+	l.lobbyMutex.RLock()
+	defer l.lobbyMutex.RUnlock()
+
+	return l.logger
+}
+
+// SetLogger - Sets the logger the lobby reports failed commands to.
+func (l *Lobby) SetLogger(logger *LogManager) {
+	l.lobbyMutex.Lock()
+	defer l.lobbyMutex.Unlock()
+
+	l.logger = logger
+}
+
 func (l *Lobby) SetID(id string) {
 	l.id = id
 }
 
 func (l *Lobby) Host() *Player {
+	l.lobbyMutex.RLock()
+	defer l.lobbyMutex.RUnlock()
+
 	return l.host
 }
 
+// SetHost - Hands the host role to a player. Only call this from a command
+// or before the lobby is shared.
 func (l *Lobby) SetHost(player *Player) {
+	l.lobbyMutex.Lock()
+	defer l.lobbyMutex.Unlock()
+
 	l.host = player
 }
+
+// Game - Returns the lobby's game, or nil if one hasn't been started.
+func (l *Lobby) Game() *Game {
+	l.lobbyMutex.RLock()
+	defer l.lobbyMutex.RUnlock()
+
+	return l.game
+}
+
+// remove - Marks the lobby as removed, so no one else can join it, and
+// drops it from its manager's indexes. Only call this from a command.
+func (l *Lobby) remove() {
+	l.removed = true
+
+	if l.manager != nil {
+		l.manager.unregister(l)
+	}
+}
+
+// JoinLobbyCommand - Seats a player in the lobby. Joined reports whether
+// there was room for them; a lobby which has been removed has none.
+type JoinLobbyCommand struct {
+	Player *Player
+	Joined bool
+}
+
+func (c *JoinLobbyCommand) Execute(lobby *Lobby) {
+	if lobby.removed {
+		return
+	}
+
+	lobby.AddPlayer(c.Player)
+	c.Joined = lobby.PlayerExists(c.Player)
+
+	if c.Joined && lobby.manager != nil {
+		lobby.manager.indexPlayer(lobby, c.Player)
+	}
+}
+
+// LeaveLobbyCommand - Removes a player from the lobby and its game. If they
+// were the host the role passes to the next player. Remaining lists who is
+// left behind. Removed reports whether they were the last player out, in
+// which case the lobby was removed from its manager.
+type LeaveLobbyCommand struct {
+	Player    *Player
+	Remaining []*Player
+	Removed   bool
+}
+
+func (c *LeaveLobbyCommand) Execute(lobby *Lobby) {
+	removePlayerFromLobbyGame(lobby, c.Player)
+	lobby.RemovePlayer(c.Player)
+	c.Remaining = lobby.Players()
+
+	if lobby.manager != nil {
+		lobby.manager.unindexPlayer(lobby, c.Player)
+	}
+
+	if lobby.Host() == c.Player && len(c.Remaining) > 0 {
+		lobby.SetHost(c.Remaining[0])
+	}
+
+	// An empty lobby would otherwise keep its goroutine forever.
+	if len(c.Remaining) == 0 && lobby.manager != nil && !lobby.removed {
+		lobby.remove()
+		c.Removed = true
+	}
+}
+
+// KickPlayerCommand - Removes the target from the lobby on behalf of the
+// requester, who must be the host.
+type KickPlayerCommand struct {
+	Requester *Player
+	Target    *Player
+	Err       error
+}
+
+func (c *KickPlayerCommand) Execute(lobby *Lobby) {
+	if lobby.Host() != c.Requester {
+		c.Err = errors.New("insufficient privileges; must be lobby host to kick users")
+		return
+	}
+
+	if !lobby.PlayerExists(c.Target) {
+		c.Err = errors.New("player is not in this lobby")
+		return
+	}
+
+	removePlayerFromLobbyGame(lobby, c.Target)
+	lobby.RemovePlayer(c.Target)
+
+	if lobby.manager != nil {
+		lobby.manager.unindexPlayer(lobby, c.Target)
+	}
+}
+
+// removeLobbyCommand - Removes the lobby from its manager, so no one else
+// can join it.
+type removeLobbyCommand struct{}
+
+func (c *removeLobbyCommand) Execute(lobby *Lobby) {
+	lobby.remove()
+}
+
+// StartGameCommand - Starts a game between the lobby's players, publishing
+// its events to Events if set and playing with the card database in Cards.
+// Game is set to the new game, or Err explains why one couldn't be started.
+type StartGameCommand struct {
+	Events *EventManager
+	Cards  *CardManager
+	Game   *Game
+	Err    error
+}
+
+func (c *StartGameCommand) Execute(lobby *Lobby) {
+	if game := lobby.Game(); game != nil && game.Running {
+		c.Err = errors.New("a game is already running in this lobby")
+		return
+	}
+
+	players := lobby.Players()
+
+	if len(players) < 2 {
+		c.Err = errors.New("a game needs two players")
+		return
+	}
+
+	game := NewGame()
+	game.Players = players
+	game.Events = c.Events
+	game.Cards = c.Cards
+
+	for _, player := range players {
+		// Players are shared with their connection's handlers, such as deck
+		// selection, so they are only changed under their lock.
+		player.Lock()
+		player.Game = game
+
+		// Fill in cards the deck lacks rules for, such as reprints from
+		// sets the deck's source had no data for, and parse the card text
+		// once for the rest of the game.
+		if len(player.PlayerDeck.Cards) > 0 {
+			var deck Deck
+
+			if c.Cards != nil {
+				deck, _ = c.Cards.ResolveDeck(player.PlayerDeck)
+			} else {
+				deck = parseDeckText(player.PlayerDeck)
+			}
+
+			player.SetDeck(deck)
+		}
+
+		player.Unlock()
+	}
+
+	game.Running = true
+	game.Start()
+
+	lobby.lobbyMutex.Lock()
+	lobby.game = game
+	lobby.lobbyMutex.Unlock()
+
+	c.Game = game
+}
+
+// LeaveGameCommand - Removes a player from the lobby's game without removing
+// them from the lobby.
+type LeaveGameCommand struct {
+	Player *Player
+}
+
+func (c *LeaveGameCommand) Execute(lobby *Lobby) {
+	removePlayerFromLobbyGame(lobby, c.Player)
+}
+
+func removePlayerFromLobbyGame(lobby *Lobby, player *Player) {
+	game := lobby.Game()
+
+	if game == nil || player.Game != game {
+		return
+	}
+
+	game.RemovePlayer(player)
+
+	player.Lock()
+	player.Game = nil
+	player.Unlock()
+}
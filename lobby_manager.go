@@ -2,79 +2,222 @@ package kfnetwork
 
 import (
 	"errors"
+	"sort"
 	"sync"
 )
 
-var lobbyManagerOnce sync.Once
-var lobbyManagerSingleton *LobbyManager
-
+// LobbyManager - Keeps track of a server's lobbies. Lobbies are indexed by
+// ID, name and member so every lookup is a single map access. Membership
+// changes should go through JoinLobby and LeaveLobby, whose commands update
+// the member index on the lobby's goroutine so it can't fall out of step
+// with the lobby being removed.
 type LobbyManager struct {
-	lobbies []*Lobby
+	lobbyMutex sync.RWMutex
+	byID       map[string]*Lobby
+	byName     map[string]*Lobby
+	byPlayer   map[*Player]*Lobby
+	capacity   int
+	logger     *LogManager
 }
 
-// Logger - Function used to access the LogManager singleton pointer.
-func Lobbies() *LobbyManager {
-	lobbyManagerOnce.Do(func() {
-		lobbyManagerSingleton = new(LobbyManager)
-	})
+// NewLobbyManager - Returns a pointer to a new lobby manager.
+func NewLobbyManager() *LobbyManager {
+	lobbyManager := new(LobbyManager)
+	lobbyManager.byID = make(map[string]*Lobby)
+	lobbyManager.byName = make(map[string]*Lobby)
+	lobbyManager.byPlayer = make(map[*Player]*Lobby)
+	lobbyManager.capacity = DefaultLobbyCapacity
+	return lobbyManager
+}
+
+// SetCapacity - Sets how many players lobbies created from now on may hold.
+func (l *LobbyManager) SetCapacity(capacity int) {
+	l.lobbyMutex.Lock()
+	defer l.lobbyMutex.Unlock()
 
-	return lobbyManagerSingleton
+	l.capacity = capacity
 }
 
+// SetLogger - Sets the logger lobbies created from now on report failed
+// commands to.
+func (l *LobbyManager) SetLogger(logger *LogManager) {
+	l.lobbyMutex.Lock()
+	defer l.lobbyMutex.Unlock()
+
+	l.logger = logger
+}
+
+// AddLobby - Creates a lobby hosted by the given player. A player can only
+// be in one lobby, so the creator leaves the lobby they were in first.
 func (l *LobbyManager) AddLobby(creator *Player, name string) *Lobby {
+	if previous, e := l.FindLobbyByPlayer(creator); e == nil {
+		l.LeaveLobby(previous, creator)
+	}
+
+	l.lobbyMutex.Lock()
+	defer l.lobbyMutex.Unlock()
+
 	lobby := NewLobby()
+	lobby.SetCapacity(l.capacity)
+	lobby.SetLogger(l.logger)
 	lobby.SetID(GenerateUUID())
 	lobby.AddPlayer(creator)
 	lobby.SetHost(creator)
 	lobby.SetName(name)
+	lobby.manager = l
 
-	l.lobbies = append(l.lobbies, lobby)
+	l.byID[lobby.ID()] = lobby
+	l.byName[name] = lobby
+	l.byPlayer[creator] = lobby
 
 	return lobby
 }
 
+// RemoveLobby - Removes a lobby along with its members' index entries and
+// stops the lobby's goroutine. Anyone trying to join it afterwards is
+// turned away.
 func (l *LobbyManager) RemoveLobby(lobby *Lobby) {
-	lobbies := []*Lobby{}
+	defer lobby.Close()
 
-	for _, l := range l.lobbies {
-		if l != lobby {
-			lobbies = append(lobbies, l)
-		}
+	if lobby.Execute(&removeLobbyCommand{}) != nil {
+		// The lobby has already stopped, so nothing else can change it.
+		l.unregister(lobby)
+	}
+}
+
+// JoinLobby - Seats a player in a lobby. Returns false if the lobby was
+// full or has been removed. Once seated the player leaves the lobby they
+// were in before, if any, since a player can only be in one lobby.
+func (l *LobbyManager) JoinLobby(lobby *Lobby, player *Player) bool {
+	previous, e := l.FindLobbyByPlayer(player)
+	command := &JoinLobbyCommand{Player: player}
+
+	if lobby.Execute(command) != nil || !command.Joined {
+		return false
 	}
 
-	l.lobbies = lobbies
+	if e == nil && previous != lobby {
+		l.LeaveLobby(previous, player)
+	}
+
+	return true
 }
 
-func (l *LobbyManager) FindLobbyByID(id string) (*Lobby, error) {
-	for _, lobby := range l.lobbies {
-		if lobby.ID() == id {
-			return lobby, nil
+// LeaveLobby - Removes a player from a lobby, returning the completed
+// command so the caller can see who was left behind. The last player out
+// removes the lobby.
+func (l *LobbyManager) LeaveLobby(lobby *Lobby, player *Player) *LeaveLobbyCommand {
+	command := &LeaveLobbyCommand{Player: player}
+	lobby.Execute(command)
+
+	if command.Removed {
+		lobby.Close()
+	}
+
+	return command
+}
+
+// KickPlayer - Removes the target from a lobby on behalf of the requester,
+// who must be the lobby's host.
+func (l *LobbyManager) KickPlayer(lobby *Lobby, requester *Player, target *Player) error {
+	command := &KickPlayerCommand{Requester: requester, Target: target}
+	e := lobby.Execute(command)
+
+	if e != nil {
+		return e
+	}
+
+	return command.Err
+}
+
+// indexPlayer - Records a player as a member of the lobby. Called from the
+// lobby's commands.
+func (l *LobbyManager) indexPlayer(lobby *Lobby, player *Player) {
+	l.lobbyMutex.Lock()
+	defer l.lobbyMutex.Unlock()
+
+	l.byPlayer[player] = lobby
+}
+
+// unindexPlayer - Forgets a player's membership of the lobby. Called from
+// the lobby's commands.
+func (l *LobbyManager) unindexPlayer(lobby *Lobby, player *Player) {
+	l.lobbyMutex.Lock()
+	defer l.lobbyMutex.Unlock()
+
+	if l.byPlayer[player] == lobby {
+		delete(l.byPlayer, player)
+	}
+}
+
+// unregister - Drops a lobby and its members from every index.
+func (l *LobbyManager) unregister(lobby *Lobby) {
+	l.lobbyMutex.Lock()
+	defer l.lobbyMutex.Unlock()
+
+	if l.byID[lobby.ID()] == lobby {
+		delete(l.byID, lobby.ID())
+	}
+
+	if l.byName[lobby.Name()] == lobby {
+		delete(l.byName, lobby.Name())
+	}
+
+	for _, player := range lobby.Players() {
+		if l.byPlayer[player] == lobby {
+			delete(l.byPlayer, player)
 		}
 	}
+}
+
+func (l *LobbyManager) FindLobbyByID(id string) (*Lobby, error) {
+	l.lobbyMutex.RLock()
+	defer l.lobbyMutex.RUnlock()
+
+	if lobby, ok := l.byID[id]; ok {
+		return lobby, nil
+	}
 
 	return &Lobby{}, errors.New("no lobby found with the given ID")
 }
 
 func (l *LobbyManager) FindLobbyByName(name string) (*Lobby, error) {
-	for _, lobby := range l.lobbies {
-		if lobby.name == name {
-			return lobby, nil
-		}
+	l.lobbyMutex.RLock()
+	defer l.lobbyMutex.RUnlock()
+
+	if lobby, ok := l.byName[name]; ok {
+		return lobby, nil
 	}
 
-	return &Lobby{}, errors.New("no lobby found with the given ID")
+	return &Lobby{}, errors.New("no lobby found with the given name")
 }
 
 func (l *LobbyManager) FindLobbyByPlayer(player *Player) (*Lobby, error) {
-	for _, lobby := range l.lobbies {
-		if lobby.PlayerExists(player) {
-			return lobby, nil
-		}
+	l.lobbyMutex.RLock()
+	defer l.lobbyMutex.RUnlock()
+
+	if lobby, ok := l.byPlayer[player]; ok {
+		return lobby, nil
 	}
 
 	return &Lobby{}, errors.New("no lobby found with the given player")
 }
 
+// GetLobbies - Returns a copy of the lobby list sorted by name.
 func (l *LobbyManager) GetLobbies() []*Lobby {
-	return l.lobbies
+	l.lobbyMutex.RLock()
+
+	lobbies := make([]*Lobby, 0, len(l.byID))
+
+	for _, lobby := range l.byID {
+		lobbies = append(lobbies, lobby)
+	}
+
+	l.lobbyMutex.RUnlock()
+
+	sort.Slice(lobbies, func(i, j int) bool {
+		return lobbies[i].Name() < lobbies[j].Name()
+	})
+
+	return lobbies
 }
@@ -0,0 +1,374 @@
+package kfnetwork
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LogSink - Somewhere log entries are written. Sinks are only ever called
+// from the logger's writer goroutine, one entry at a time.
+type LogSink interface {
+	Write(entry LogEntry) error
+	Close() error
+}
+
+// LogFormat - How a sink renders entries, either "text" or "json".
+type LogFormat string
+
+const (
+	// LogFormatText - One human readable line per entry.
+	LogFormatText LogFormat = "text"
+	// LogFormatJSON - One JSON object per line.
+	LogFormatJSON LogFormat = "json"
+)
+
+// FormatLogEntry - Renders an entry as a single line in the given format.
+func FormatLogEntry(entry LogEntry, format LogFormat) []byte {
+	if format == LogFormatJSON {
+		return formatJSONEntry(entry)
+	}
+
+	return formatTextEntry(entry)
+}
+
+func formatTextEntry(entry LogEntry) []byte {
+	var buffer bytes.Buffer
+
+	buffer.WriteString(entry.Time.Format(time.RFC3339))
+	buffer.WriteString(" ")
+	buffer.WriteString(levelTag(entry.Level))
+
+	if entry.Subsystem != "" {
+		buffer.WriteString(" [" + entry.Subsystem + "]")
+	}
+
+	buffer.WriteString(" " + entry.Message)
+
+	for _, key := range sortedKeys(entry.Fields) {
+		buffer.WriteString(fmt.Sprintf(" %s=%v", key, entry.Fields[key]))
+	}
+
+	buffer.WriteString("\n")
+	return buffer.Bytes()
+}
+
+func formatJSONEntry(entry LogEntry) []byte {
+	object := make(map[string]interface{}, len(entry.Fields)+4)
+
+	for key, value := range entry.Fields {
+		object[key] = value
+	}
+
+	object["time"] = entry.Time.Format(time.RFC3339Nano)
+	object["level"] = entry.Level.String()
+	object["message"] = entry.Message
+
+	if entry.Subsystem != "" {
+		object["subsystem"] = entry.Subsystem
+	}
+
+	line, e := json.Marshal(object)
+
+	if e != nil {
+		line, _ = json.Marshal(map[string]string{
+			"time":    entry.Time.Format(time.RFC3339Nano),
+			"level":   entry.Level.String(),
+			"message": entry.Message,
+			"error":   e.Error(),
+		})
+	}
+
+	return append(line, '\n')
+}
+
+func levelTag(level LogLevel) string {
+	switch level {
+	case LogLevelDebug:
+		return "[  DEBUG  ]"
+	case LogLevelInfo:
+		return "[   LOG   ]"
+	case LogLevelWarn:
+		return "[ WARNING ]"
+	case LogLevelError:
+		return "[  ERROR  ]"
+	default:
+		return "[    ?    ]"
+	}
+}
+
+func sortedKeys(fields Fields) []string {
+	keys := make([]string, 0, len(fields))
+
+	for key := range fields {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// WriterSink - Writes entries to an io.Writer such as stderr.
+type WriterSink struct {
+	writer io.Writer
+	format LogFormat
+}
+
+// NewWriterSink - Returns a sink writing entries to w in the given format.
+func NewWriterSink(w io.Writer, format LogFormat) *WriterSink {
+	sink := new(WriterSink)
+	sink.writer = w
+	sink.format = format
+	return sink
+}
+
+// NewStderrSink - Returns a sink writing text lines to stderr.
+func NewStderrSink() *WriterSink {
+	return NewWriterSink(os.Stderr, LogFormatText)
+}
+
+// NewJSONSink - Returns a sink writing JSON lines to w.
+func NewJSONSink(w io.Writer) *WriterSink {
+	return NewWriterSink(w, LogFormatJSON)
+}
+
+func (s *WriterSink) Write(entry LogEntry) error {
+	_, e := s.writer.Write(FormatLogEntry(entry, s.format))
+	return e
+}
+
+// Close - Does nothing; the writer belongs to whoever created the sink.
+func (s *WriterSink) Close() error {
+	return nil
+}
+
+// RotatingFileSink - Writes entries to a file, rolling it over to
+// <path>.1, <path>.2 and so on once it reaches a maximum size.
+type RotatingFileSink struct {
+	fileMutex sync.Mutex
+	path      string
+	format    LogFormat
+	maxSize   int64
+	maxFiles  int
+	file      *os.File
+	size      int64
+}
+
+// NewRotatingFileSink - Opens, or creates, the log file at path. Once the
+// file would grow past maxSize bytes it is rotated, keeping at most maxFiles
+// old files. A maxSize of zero disables rotation.
+func NewRotatingFileSink(path string, format LogFormat, maxSize int64, maxFiles int) (*RotatingFileSink, error) {
+	sink := new(RotatingFileSink)
+	sink.path = path
+	sink.format = format
+	sink.maxSize = maxSize
+	sink.maxFiles = maxFiles
+
+	e := sink.open()
+
+	if e != nil {
+		return nil, e
+	}
+
+	return sink, nil
+}
+
+func (s *RotatingFileSink) Write(entry LogEntry) error {
+	s.fileMutex.Lock()
+	defer s.fileMutex.Unlock()
+
+	if s.file == nil {
+		return errors.New("log file closed")
+	}
+
+	line := FormatLogEntry(entry, s.format)
+
+	if s.maxSize > 0 && s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		e := s.rotate()
+
+		if e != nil {
+			return e
+		}
+	}
+
+	written, e := s.file.Write(line)
+	s.size += int64(written)
+	return e
+}
+
+func (s *RotatingFileSink) Close() error {
+	s.fileMutex.Lock()
+	defer s.fileMutex.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+
+	e := s.file.Close()
+	s.file = nil
+	return e
+}
+
+func (s *RotatingFileSink) open() error {
+	e := os.MkdirAll(filepath.Dir(s.path), 0755)
+
+	if e != nil {
+		return e
+	}
+
+	file, e := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+
+	if e != nil {
+		return e
+	}
+
+	info, e := file.Stat()
+
+	if e != nil {
+		file.Close()
+		return e
+	}
+
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+func (s *RotatingFileSink) rotate() error {
+	s.file.Close()
+	s.file = nil
+
+	if s.maxFiles < 1 {
+		os.Remove(s.path)
+		return s.open()
+	}
+
+	os.Remove(fmt.Sprintf("%s.%d", s.path, s.maxFiles))
+
+	for i := s.maxFiles - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", s.path, i), fmt.Sprintf("%s.%d", s.path, i+1))
+	}
+
+	os.Rename(s.path, s.path+".1")
+	return s.open()
+}
+
+// LogConfiguration - Logging settings: the default level, per-subsystem
+// overrides, where entries are written and how many may wait to be written.
+type LogConfiguration struct {
+	Level     LogLevel               `json:"level"`
+	Levels    map[string]LogLevel    `json:"levels,omitempty"`
+	Sinks     []LogSinkConfiguration `json:"sinks"`
+	QueueSize int                    `json:"queue_size"`
+}
+
+// LogSinkConfiguration - Describes a single sink. Type is "stderr", "stdout"
+// or "file"; Path, MaxSize and MaxFiles only apply to files.
+type LogSinkConfiguration struct {
+	Type     string    `json:"type"`
+	Format   LogFormat `json:"format,omitempty"`
+	Path     string    `json:"path,omitempty"`
+	MaxSize  int64     `json:"max_size,omitempty"`
+	MaxFiles int       `json:"max_files,omitempty"`
+}
+
+// DefaultLogConfiguration - Logs at info level and above to stderr.
+func DefaultLogConfiguration() LogConfiguration {
+	config := LogConfiguration{}
+	config.Level = LogLevelInfo
+	config.Sinks = []LogSinkConfiguration{{Type: "stderr", Format: LogFormatText}}
+	config.QueueSize = 1024
+	return config
+}
+
+// problems - Lists what is wrong with the configuration, each problem
+// prefixed with where in the configuration it was found.
+func (c LogConfiguration) problems(prefix string) []string {
+	problems := []string{}
+
+	if c.QueueSize < 0 {
+		problems = append(problems, prefix+".queue_size must not be negative")
+	}
+
+	for i, sink := range c.Sinks {
+		problems = append(problems, sink.problems(fmt.Sprintf("%s.sinks[%d]", prefix, i))...)
+	}
+
+	return problems
+}
+
+func (c LogSinkConfiguration) problems(prefix string) []string {
+	problems := []string{}
+
+	if c.Format != "" && c.Format != LogFormatText && c.Format != LogFormatJSON {
+		problems = append(problems, fmt.Sprintf("%s.format %q must be \"text\" or \"json\"", prefix, c.Format))
+	}
+
+	switch c.Type {
+	case "stderr", "stdout":
+	case "file":
+		if c.Path == "" {
+			problems = append(problems, prefix+".path is required for file sinks")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("%s.type %q must be \"stderr\", \"stdout\" or \"file\"", prefix, c.Type))
+	}
+
+	return problems
+}
+
+// OpenSinks - Creates the sinks described by the configuration.
+func (c LogConfiguration) OpenSinks() ([]LogSink, error) {
+	sinks := []LogSink{}
+
+	for _, sinkConfig := range c.Sinks {
+		sink, e := sinkConfig.Open()
+
+		if e != nil {
+			for _, opened := range sinks {
+				opened.Close()
+			}
+
+			return nil, e
+		}
+
+		sinks = append(sinks, sink)
+	}
+
+	return sinks, nil
+}
+
+// Open - Creates the sink described by the configuration.
+func (c LogSinkConfiguration) Open() (LogSink, error) {
+	format := c.Format
+
+	if format == "" {
+		format = LogFormatText
+	}
+
+	if format != LogFormatText && format != LogFormatJSON {
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+
+	switch c.Type {
+	case "stderr":
+		return NewWriterSink(os.Stderr, format), nil
+	case "stdout":
+		return NewWriterSink(os.Stdout, format), nil
+	case "file":
+		if c.Path == "" {
+			return nil, errors.New("file log sink needs a path")
+		}
+
+		return NewRotatingFileSink(c.Path, format, c.MaxSize, c.MaxFiles)
+	default:
+		return nil, fmt.Errorf("unknown log sink type %q", c.Type)
+	}
+}
@@ -1,76 +1,276 @@
 package kfnetwork
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
-var loggerOnce sync.Once
-var loggerSingleton *LogManager
+// LogLevel - How important a log entry is. Entries below the level set for
+// their subsystem are discarded.
+type LogLevel int
 
-// Log - struct representing
-type Log struct {
-	message string
+const (
+	LogLevelDebug LogLevel = iota
+	LogLevelInfo
+	LogLevelWarn
+	LogLevelError
+)
+
+// Fields - Structured context attached to a log entry, such as the player
+// ID, lobby ID, packet type or remote address involved.
+type Fields map[string]interface{}
+
+// LogEntry - A single log message along with its level, subsystem and
+// fields.
+type LogEntry struct {
+	Time      time.Time
+	Level     LogLevel
+	Subsystem string
+	Message   string
+	Fields    Fields
+	flushed   chan struct{}
 }
 
-// LogManager - Shockingly enough this class manages logs.
+// LogManager - Leveled, structured logging. Entries are queued without
+// blocking and written to every sink by a background goroutine, so a slow
+// disk or terminal never holds up the caller; if the queue fills, entries
+// are dropped and counted instead. Loggers returned by Subsystem and
+// WithFields share their parent's queue, sinks and levels.
 type LogManager struct {
-	logQueue   chan string
-	errorQueue chan string
-	limit      int
+	core      *logCore
+	subsystem string
+	fields    Fields
+}
+
+type logCore struct {
+	queue      chan LogEntry
+	done       chan struct{}
+	closeMutex sync.RWMutex
+	closed     bool
+	sinkMutex  sync.RWMutex
+	sinks      []LogSink
+	levelMutex sync.RWMutex
+	level      LogLevel
+	levels     map[string]LogLevel
+	dropped    uint64
 }
 
-// Logger - Function used to access the LogManager singleton pointer.
-func Logger() *LogManager {
-	loggerOnce.Do(func() {
-		loggerSingleton = new(LogManager)
-		loggerSingleton.limit = 1024
-		loggerSingleton.logQueue = make(chan string, loggerSingleton.limit)
-	})
+// NewLogManager - Returns a pointer to a new log manager writing to the
+// given sinks, or to stderr if none are given.
+func NewLogManager(sinks ...LogSink) *LogManager {
+	if len(sinks) == 0 {
+		sinks = []LogSink{NewStderrSink()}
+	}
 
-	return loggerSingleton
+	return newLogManager(sinks, 0)
 }
 
-// GetQueue - Returns a pointer to the LogManager log queue channel.
-func (l *LogManager) GetQueue() *chan string {
-	return &l.logQueue
+func newLogManager(sinks []LogSink, queueSize int) *LogManager {
+	if queueSize < 1 {
+		queueSize = 1024
+	}
+
+	core := new(logCore)
+	core.queue = make(chan LogEntry, queueSize)
+	core.done = make(chan struct{})
+	core.sinks = sinks
+	core.level = LogLevelInfo
+	core.levels = make(map[string]LogLevel)
+
+	go core.writeLoop()
+
+	logManager := new(LogManager)
+	logManager.core = core
+	return logManager
 }
 
-// Log - Adds a log in the form of a string to the log queue.
-func (l *LogManager) Log(message string) {
-	logMessage := fmt.Sprintf("[   LOG   ] %s", message)
-	l.logQueue <- logMessage
+// NewLogManagerFromConfig - Returns a log manager with the sinks and levels
+// described by the configuration. A configuration with no sinks discards
+// everything.
+func NewLogManagerFromConfig(config LogConfiguration) (*LogManager, error) {
+	sinks, e := config.OpenSinks()
+
+	if e != nil {
+		return nil, e
+	}
+
+	logManager := newLogManager(sinks, config.QueueSize)
+	logManager.SetLevels(config.Level, config.Levels)
+	return logManager, nil
+}
+
+// Configure - Replaces the logger's sinks and levels with those described by
+// the configuration. The previous sinks are closed.
+func (l *LogManager) Configure(config LogConfiguration) error {
+	sinks, e := config.OpenSinks()
+
+	if e != nil {
+		return e
+	}
+
+	l.configure(config, sinks)
+	return nil
+}
+
+// configure - Swaps in sinks already opened from the configuration, closing
+// the previous ones, and applies its levels.
+func (l *LogManager) configure(config LogConfiguration, sinks []LogSink) {
+	l.Flush()
+
+	l.core.sinkMutex.Lock()
+	previous := l.core.sinks
+	l.core.sinks = sinks
+	l.core.sinkMutex.Unlock()
+
+	for _, sink := range previous {
+		sink.Close()
+	}
+
+	l.SetLevels(config.Level, config.Levels)
+}
+
+// SetLevels - Sets the default level and any per-subsystem overrides.
+func (l *LogManager) SetLevels(level LogLevel, levels map[string]LogLevel) {
+	l.core.levelMutex.Lock()
+	defer l.core.levelMutex.Unlock()
+
+	l.core.level = level
+	l.core.levels = make(map[string]LogLevel)
+
+	for subsystem, level := range levels {
+		l.core.levels[subsystem] = level
+	}
 }
 
-// GetLogs - Pull logs off of the channel queue and return them in an array.
-// This is primarily used in conjunction with PrintLogs().
-func (l *LogManager) GetLogs() []string {
-	logs := []string{}
+// SetLevel - Sets the level for a single subsystem, or the default level if
+// the subsystem is empty.
+func (l *LogManager) SetLevel(subsystem string, level LogLevel) {
+	l.core.levelMutex.Lock()
+	defer l.core.levelMutex.Unlock()
 
-	for len(l.logQueue) > 0 {
-		logs = append(logs, <-l.logQueue)
+	if subsystem == "" {
+		l.core.level = level
+		return
 	}
 
-	return logs
+	l.core.levels[subsystem] = level
 }
 
-// PrintLogs - Prints the logs waiting on the queue.
-func (l *LogManager) PrintLogs() {
-	for _, log := range l.GetLogs() {
-		fmt.Println(log)
+// Enabled - Determine whether entries at the given level would be written
+// for this logger's subsystem.
+func (l *LogManager) Enabled(level LogLevel) bool {
+	l.core.levelMutex.RLock()
+	defer l.core.levelMutex.RUnlock()
+
+	threshold, ok := l.core.levels[l.subsystem]
+
+	if !ok {
+		threshold = l.core.level
 	}
+
+	return level >= threshold
+}
+
+// Subsystem - Returns a logger which tags its entries with the subsystem
+// name, such as "network" or "lobby", and uses that subsystem's level.
+func (l *LogManager) Subsystem(subsystem string) *LogManager {
+	logManager := new(LogManager)
+	logManager.core = l.core
+	logManager.subsystem = subsystem
+	logManager.fields = l.fields
+	return logManager
+}
+
+// WithFields - Returns a logger which adds the given fields to every entry.
+func (l *LogManager) WithFields(fields Fields) *LogManager {
+	logManager := new(LogManager)
+	logManager.core = l.core
+	logManager.subsystem = l.subsystem
+	logManager.fields = mergeFields(l.fields, fields)
+	return logManager
+}
+
+// Debug - Logs detail which is only useful while debugging.
+func (l *LogManager) Debug(message string, fields ...Fields) {
+	l.write(LogLevelDebug, message, fields)
+}
+
+// Info - Logs normal operation.
+func (l *LogManager) Info(message string, fields ...Fields) {
+	l.write(LogLevelInfo, message, fields)
+}
+
+// Log - Logs normal operation. Same as Info.
+func (l *LogManager) Log(message string, fields ...Fields) {
+	l.write(LogLevelInfo, message, fields)
+}
+
+// Warn - Logs something unexpected which the server recovered from.
+func (l *LogManager) Warn(message string, fields ...Fields) {
+	l.write(LogLevelWarn, message, fields)
 }
 
 // Error - Logs an error.
-func (l *LogManager) Error(message string) {
-	logMessage := fmt.Sprintf("[  ERROR  ] %s", message)
-	l.logQueue <- logMessage
+func (l *LogManager) Error(message string, fields ...Fields) {
+	l.write(LogLevelError, message, fields)
+}
+
+// Dropped - Returns how many entries were dropped because the queue was
+// full.
+func (l *LogManager) Dropped() uint64 {
+	return atomic.LoadUint64(&l.core.dropped)
+}
+
+// Flush - Blocks until every entry queued so far has been written.
+func (l *LogManager) Flush() {
+	l.core.closeMutex.RLock()
+
+	if l.core.closed {
+		l.core.closeMutex.RUnlock()
+		return
+	}
+
+	flushed := make(chan struct{})
+	l.core.queue <- LogEntry{flushed: flushed}
+	l.core.closeMutex.RUnlock()
+
+	<-flushed
 }
 
-// Warn - Emits a warning to the console.
-func (l *LogManager) Warn(message string) {
-	logMessage := fmt.Sprintf("[ WARNING ] %s", message)
-	l.logQueue <- logMessage
+// Close - Writes out anything still queued and closes every sink. Entries
+// logged afterwards are discarded.
+func (l *LogManager) Close() error {
+	l.core.closeMutex.Lock()
+
+	if l.core.closed {
+		l.core.closeMutex.Unlock()
+		return nil
+	}
+
+	l.core.closed = true
+	close(l.core.queue)
+	l.core.closeMutex.Unlock()
+
+	<-l.core.done
+
+	l.core.sinkMutex.Lock()
+	defer l.core.sinkMutex.Unlock()
+
+	var result error
+
+	for _, sink := range l.core.sinks {
+		e := sink.Close()
+
+		if e != nil && result == nil {
+			result = e
+		}
+	}
+
+	return result
 }
 
 // Notify - logs events.
@@ -81,14 +281,144 @@ func (l *LogManager) Notify(event Event) {
 	}
 }
 
+// LogNetworkEvent - Logs a received packet at debug level, with any
+// sensitive fields redacted.
 func (l *LogManager) LogNetworkEvent(event NetworkEvent) {
-	payload, e := GetPacketPayload(*event.packet)
+	logger := l.Subsystem("network")
+
+	if !logger.Enabled(LogLevelDebug) {
+		return
+	}
+
+	fields := Fields{"packet_type": event.Packet().GetHeader().Type}
+
+	if event.connection != nil {
+		fields["remote_addr"] = event.connection.RemoteAddr().String()
+	}
+
+	payload, e := RedactedPacketPayload(*event.packet)
 
 	if e != nil {
-		Logger().Error(fmt.Sprintf("Unable to retrieve packet payload: %s", e.Error()))
+		logger.Error(fmt.Sprintf("Unable to retrieve packet payload: %s", e.Error()), fields)
 		return
 	}
 
 	logEntry := fmt.Sprintf("Received packet with the following payload: %s", payload)
-	l.Log(logEntry)
+	logger.Debug(logEntry, fields)
+}
+
+func (l *LogManager) write(level LogLevel, message string, fields []Fields) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	entry := LogEntry{}
+	entry.Time = time.Now()
+	entry.Level = level
+	entry.Subsystem = l.subsystem
+	entry.Message = message
+	entry.Fields = l.fields
+
+	for _, f := range fields {
+		entry.Fields = mergeFields(entry.Fields, f)
+	}
+
+	l.core.closeMutex.RLock()
+	defer l.core.closeMutex.RUnlock()
+
+	if l.core.closed {
+		return
+	}
+
+	select {
+	case l.core.queue <- entry:
+	default:
+		atomic.AddUint64(&l.core.dropped, 1)
+	}
+}
+
+func (c *logCore) writeLoop() {
+	defer close(c.done)
+
+	for entry := range c.queue {
+		if entry.flushed != nil {
+			close(entry.flushed)
+			continue
+		}
+
+		c.sinkMutex.RLock()
+
+		for _, sink := range c.sinks {
+			sink.Write(entry)
+		}
+
+		c.sinkMutex.RUnlock()
+	}
+}
+
+func mergeFields(base Fields, extra Fields) Fields {
+	if len(extra) == 0 {
+		return base
+	}
+
+	merged := make(Fields, len(base)+len(extra))
+
+	for key, value := range base {
+		merged[key] = value
+	}
+
+	for key, value := range extra {
+		merged[key] = value
+	}
+
+	return merged
+}
+
+// String - Returns the level's name.
+func (l LogLevel) String() string {
+	switch l {
+	case LogLevelDebug:
+		return "debug"
+	case LogLevelInfo:
+		return "info"
+	case LogLevelWarn:
+		return "warn"
+	case LogLevelError:
+		return "error"
+	default:
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+}
+
+// ParseLogLevel - Converts a level name such as "warn" into a LogLevel.
+func ParseLogLevel(name string) (LogLevel, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return LogLevelDebug, nil
+	case "info", "log":
+		return LogLevelInfo, nil
+	case "warn", "warning":
+		return LogLevelWarn, nil
+	case "error":
+		return LogLevelError, nil
+	default:
+		return LogLevelInfo, errors.New("unknown log level " + name)
+	}
+}
+
+// MarshalText - Encodes the level by name.
+func (l LogLevel) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText - Decodes a level name.
+func (l *LogLevel) UnmarshalText(text []byte) error {
+	level, e := ParseLogLevel(string(text))
+
+	if e != nil {
+		return e
+	}
+
+	*l = level
+	return nil
 }
@@ -5,16 +5,25 @@ import (
 	"encoding/json"
 	"errors"
 	"net"
+	"reflect"
+	"sync"
 )
 
+// Packet - Any message sent between client and server. Fields holding
+// secrets such as tokens or session IDs are tagged `audit:"redact"` so they
+// never reach the logs.
 type Packet interface {
 	GetHeader() PacketHeader
 }
 
+// PacketHeader - Common header for all packets. Sequence is chosen by the
+// client for each request and echoed back by the server on the matching
+// response (and any ErrorPacket the request caused) so the client can pair
+// them up. Packets the server sends unprompted carry a sequence of zero.
 type PacketHeader struct {
-	//Sequence uint16 `json:"sequence"`
-	Type   uint16 `json:"type"`
-	Length uint16 `json:"-"`
+	Sequence uint16 `json:"sequence"`
+	Type     uint16 `json:"type"`
+	Length   uint16 `json:"-"`
 }
 
 type VersionPacket struct {
@@ -35,11 +44,12 @@ type LoginRequestPacket struct {
 	PacketHeader
 	Name  string `json:"name"`
 	ID    string `json:"id"`
-	Token string `json:"token"`
+	Token string `json:"token" audit:"redact"`
 }
 
 type LoginResponsePacket struct {
 	PacketHeader
+	Session string `json:"session" audit:"redact"`
 }
 
 type PlayerListRequestPacket struct {
@@ -193,6 +203,75 @@ type DiscardCardResponsePacket struct {
 	Played bool   `json:"played"`
 }
 
+type PingPacket struct {
+	PacketHeader
+	Timestamp int64 `json:"timestamp"`
+}
+
+type PongPacket struct {
+	PacketHeader
+	Timestamp int64 `json:"timestamp"`
+}
+
+type ResumeRequestPacket struct {
+	PacketHeader
+	Session string `json:"session" audit:"redact"`
+}
+
+type ResumeResponsePacket struct {
+	PacketHeader
+	Session string `json:"session" audit:"redact"`
+	Success bool   `json:"success"`
+}
+
+type StateSnapshotPacket struct {
+	PacketHeader
+	Player PlayerListEntry `json:"player"`
+	Lobby  *LobbySnapshot  `json:"lobby,omitempty"`
+	Game   *GameSnapshot   `json:"game,omitempty"`
+}
+
+type ServerShutdownPacket struct {
+	PacketHeader
+	Message string `json:"message"`
+}
+
+type ReloadRequestPacket struct {
+	PacketHeader
+}
+
+type ReloadResponsePacket struct {
+	PacketHeader
+	Cards int `json:"cards"`
+}
+
+type CardSearchRequestPacket struct {
+	PacketHeader
+	Query    string `json:"query"`
+	Page     int    `json:"page"`
+	PageSize int    `json:"page_size"`
+}
+
+type CardSearchResponsePacket struct {
+	PacketHeader
+	Total int    `json:"total"`
+	Page  int    `json:"page"`
+	Cards []Card `json:"cards"`
+}
+
+type SelectDeckRequestPacket struct {
+	PacketHeader
+	DeckID string `json:"deck_id"`
+}
+
+type SelectDeckResponsePacket struct {
+	PacketHeader
+	DeckID string   `json:"deck_id"`
+	Name   string   `json:"name"`
+	Houses []string `json:"houses"`
+	Cards  int      `json:"cards"`
+}
+
 func (p PacketHeader) GetHeader() PacketHeader {
 	return p
 }
@@ -274,8 +353,8 @@ func WritePacket(client net.Conn, packet Packet) error {
 	payload = append(payload, header.GetBytes()...)
 	payload = append(payload, jsonPayload...)
 
-	client.Write(payload)
-	return nil
+	_, e = client.Write(payload)
+	return e
 }
 
 func ParsePacket(header PacketHeader, payload []byte) (Packet, error) {
@@ -291,8 +370,6 @@ func ParsePacket(header PacketHeader, payload []byte) (Packet, error) {
 // RenderPacket - a giant case switch used to output the correct packet type
 // when packets are read off of the wire.
 func RenderPacket(header PacketHeader, payload []byte) (Packet, error) {
-	var packet Packet
-
 	switch header.Type {
 	case PacketTypeExit:
 		packet := ExitPacket{}
@@ -410,9 +487,111 @@ func RenderPacket(header PacketHeader, payload []byte) (Packet, error) {
 		packet := PlayCardResponsePacket{}
 		e := json.Unmarshal(payload, &packet)
 		return packet, e
+	case PacketTypeLobbyChatRequest:
+		packet := LobbyChatRequestPacket{}
+		e := json.Unmarshal(payload, &packet)
+		return packet, e
+	case PacketTypeLobbyChatResponse:
+		packet := LobbyChatResponsePacket{}
+		e := json.Unmarshal(payload, &packet)
+		return packet, e
+	case PacketTypePing:
+		packet := PingPacket{}
+		e := json.Unmarshal(payload, &packet)
+		return packet, e
+	case PacketTypePong:
+		packet := PongPacket{}
+		e := json.Unmarshal(payload, &packet)
+		return packet, e
+	case PacketTypeResumeRequest:
+		packet := ResumeRequestPacket{}
+		e := json.Unmarshal(payload, &packet)
+		return packet, e
+	case PacketTypeResumeResponse:
+		packet := ResumeResponsePacket{}
+		e := json.Unmarshal(payload, &packet)
+		return packet, e
+	case PacketTypeStateSnapshot:
+		packet := StateSnapshotPacket{}
+		e := json.Unmarshal(payload, &packet)
+		return packet, e
+	case PacketTypeServerShutdown:
+		packet := ServerShutdownPacket{}
+		e := json.Unmarshal(payload, &packet)
+		return packet, e
+	case PacketTypeReloadRequest:
+		packet := ReloadRequestPacket{}
+		e := json.Unmarshal(payload, &packet)
+		return packet, e
+	case PacketTypeReloadResponse:
+		packet := ReloadResponsePacket{}
+		e := json.Unmarshal(payload, &packet)
+		return packet, e
+	case PacketTypeCardSearchRequest:
+		packet := CardSearchRequestPacket{}
+		e := json.Unmarshal(payload, &packet)
+		return packet, e
+	case PacketTypeCardSearchResponse:
+		packet := CardSearchResponsePacket{}
+		e := json.Unmarshal(payload, &packet)
+		return packet, e
+	case PacketTypeSelectDeckRequest:
+		packet := SelectDeckRequestPacket{}
+		e := json.Unmarshal(payload, &packet)
+		return packet, e
+	case PacketTypeSelectDeckResponse:
+		packet := SelectDeckResponsePacket{}
+		e := json.Unmarshal(payload, &packet)
+		return packet, e
 	default:
+		return renderCustomPacket(header, payload)
+	}
+}
+
+var customPacketMutex sync.RWMutex
+var customPackets = make(map[uint16]reflect.Type)
+
+// RegisterPacketType - Teaches the packet reader about a custom packet type
+// so plugins can add their own commands. The prototype is an example of the
+// packet struct, which must embed PacketHeader; every packet read with this
+// type is decoded into a fresh value of the same struct. The registry is
+// shared by every server and client in the process, so registering the same
+// struct again succeeds, while registering a different one for a type
+// already in use returns ErrPacketTypeRegistered.
+func RegisterPacketType(packetType uint16, prototype Packet) error {
+	if packetType < PacketTypeUserDefined {
+		return ErrPacketTypeReserved
+	}
+
+	customPacketMutex.Lock()
+	defer customPacketMutex.Unlock()
+
+	if registered, ok := customPackets[packetType]; ok {
+		if registered == reflect.TypeOf(prototype) {
+			return nil
+		}
+
+		return ErrPacketTypeRegistered
+	}
+
+	customPackets[packetType] = reflect.TypeOf(prototype)
+	return nil
+}
+
+func renderCustomPacket(header PacketHeader, payload []byte) (Packet, error) {
+	var packet Packet
+
+	customPacketMutex.RLock()
+	packetType, ok := customPackets[header.Type]
+	customPacketMutex.RUnlock()
+
+	if !ok {
 		return packet, errors.New("unknown packet type")
 	}
+
+	value := reflect.New(packetType)
+	e := json.Unmarshal(payload, value.Interface())
+	return value.Elem().Interface().(Packet), e
 }
 
 func GetPacketPayload(packet Packet) ([]byte, error) {
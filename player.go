@@ -2,7 +2,6 @@ package kfnetwork
 
 import (
 	"fmt"
-	"net"
 	"sync"
 )
 
@@ -11,7 +10,7 @@ type Player struct {
 	ID          string
 	playerMutex sync.Mutex
 	affects     []*PlayerAffect
-	Client      net.Conn
+	Client      Connection
 	Name        string
 	Game        *Game
 	Debug       bool
@@ -27,6 +26,9 @@ type Player struct {
 	Amber       int
 	Keys        int
 	Chains      int
+	// vaultToken - The Vault API token the player logged in with, used to
+	// fetch the decks they select.
+	vaultToken string
 }
 
 // NewPlayer - Returns a pointer to a new player object.
@@ -52,6 +54,27 @@ func (p *Player) Unlock() {
 	p.playerMutex.Unlock()
 }
 
+// Connection - Returns the connection the player is using. Resuming a
+// session moves the player onto a new connection, so it is read under the
+// player's lock; callers must not already hold it.
+func (p *Player) Connection() Connection {
+	p.playerMutex.Lock()
+	defer p.playerMutex.Unlock()
+
+	return p.Client
+}
+
+// swapConnection - Moves the player onto a new connection and returns the
+// one they were using.
+func (p *Player) swapConnection(connection Connection) Connection {
+	p.playerMutex.Lock()
+	defer p.playerMutex.Unlock()
+
+	previous := p.Client
+	p.Client = connection
+	return previous
+}
+
 // Affects - this function returns an array of PlayerAffect pointers
 // and is basically used to allow outside access to other functions.
 func (p *Player) Affects() []*PlayerAffect {
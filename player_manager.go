@@ -3,103 +3,189 @@ package kfnetwork
 import (
 	"errors"
 	"fmt"
-	"net"
+	"sort"
 	"sync"
 )
 
-var playerManagerOnce sync.Once
-var playerManagerSingleton *PlayerManager
-
+// PlayerManager - Keeps track of the players logged in to a server. Players
+// are indexed by ID, name and connection so every lookup is a single map
+// access, and the indexes are guarded by a read/write mutex so any number of
+// read loops can search at once.
 type PlayerManager struct {
-	players []*Player
+	logger       *LogManager
+	playerMutex  sync.RWMutex
+	players      map[*Player]struct{}
+	byID         map[string]*Player
+	byName       map[string]*Player
+	byConnection map[Connection]*Player
 }
 
-func Players() *PlayerManager {
-	playerManagerOnce.Do(func() {
-		playerManagerSingleton = new(PlayerManager)
-	})
-
-	return playerManagerSingleton
+// NewPlayerManager - Returns a pointer to a new player manager which logs to
+// the given logger.
+func NewPlayerManager(logger *LogManager) *PlayerManager {
+	playerManager := new(PlayerManager)
+	playerManager.logger = logger
+	playerManager.players = make(map[*Player]struct{})
+	playerManager.byID = make(map[string]*Player)
+	playerManager.byName = make(map[string]*Player)
+	playerManager.byConnection = make(map[Connection]*Player)
+	return playerManager
 }
 
+// AddPlayer - Adds a player and indexes them by ID, name and connection.
+// Adding a player who is already present does nothing.
 func (p *PlayerManager) AddPlayer(player *Player) {
-	logEntry := fmt.Sprintf("Player %s logged in.", player.Name)
-	Logger().Log(logEntry)
+	// Handlers look players up while holding a player's lock, so the
+	// player's lock is never taken while holding the manager's.
+	connection := player.Connection()
+
+	p.playerMutex.Lock()
 
-	if !p.PlayerExists(player) {
-		player.Lock()
-		defer player.Unlock()
+	if _, ok := p.players[player]; ok {
+		p.playerMutex.Unlock()
+		return
+	}
+
+	p.players[player] = struct{}{}
+
+	if player.ID != "" {
+		p.byID[player.ID] = player
+	}
+
+	if player.Name != "" {
+		p.byName[player.Name] = player
+	}
 
-		p.players = append(p.players, player)
+	if connection != nil {
+		p.byConnection[connection] = player
 	}
+
+	p.playerMutex.Unlock()
+
+	logEntry := fmt.Sprintf("Player %s logged in.", player.Name)
+	p.logger.Log(logEntry)
 }
 
+// RemovePlayer - Removes a player and drops them from every index.
 func (p *PlayerManager) RemovePlayer(player *Player) {
-	players := []*Player{}
+	connection := player.Connection()
+
+	p.playerMutex.Lock()
+	defer p.playerMutex.Unlock()
+
+	if _, ok := p.players[player]; !ok {
+		return
+	}
+
+	delete(p.players, player)
 
-	for _, p := range p.players {
-		p.Lock()
-		defer p.Unlock()
+	// Only drop index entries which still point at this player; another
+	// player may have since claimed the same ID or name.
+	if p.byID[player.ID] == player {
+		delete(p.byID, player.ID)
+	}
 
-		if p != player {
-			players = append(players, p)
-		}
+	if p.byName[player.Name] == player {
+		delete(p.byName, player.Name)
 	}
 
-	p.players = players
+	if p.byConnection[connection] == player {
+		delete(p.byConnection, connection)
+	}
 }
 
-func (p *PlayerManager) PlayerExists(client *Player) bool {
-	for _, player := range p.players {
-		player.Lock()
-		defer player.Unlock()
+// SetConnection - Moves a player onto a new connection, keeping the
+// connection index in step. Used when a player resumes their session.
+func (p *PlayerManager) SetConnection(player *Player, connection Connection) Connection {
+	previous := player.swapConnection(connection)
+
+	p.playerMutex.Lock()
+	defer p.playerMutex.Unlock()
 
-		if player == client {
-			return true
-		}
+	if _, ok := p.players[player]; !ok {
+		return previous
 	}
 
-	return false
+	if previous != nil && p.byConnection[previous] == player {
+		delete(p.byConnection, previous)
+	}
+
+	if connection != nil {
+		p.byConnection[connection] = player
+	}
+
+	return previous
 }
 
+// PlayerExists - Determine whether a player is present.
+func (p *PlayerManager) PlayerExists(player *Player) bool {
+	p.playerMutex.RLock()
+	defer p.playerMutex.RUnlock()
+
+	_, ok := p.players[player]
+	return ok
+}
+
+// FindPlayerByID - Locate a player given their ID.
 func (p *PlayerManager) FindPlayerByID(id string) (*Player, error) {
-	for _, player := range p.players {
-		player.Lock()
-		defer player.Unlock()
+	p.playerMutex.RLock()
+	defer p.playerMutex.RUnlock()
 
-		if player.ID == id {
-			return player, nil
-		}
+	if player, ok := p.byID[id]; ok {
+		return player, nil
 	}
 
 	return &Player{}, errors.New("no such player found")
 }
 
-func (p *PlayerManager) FindPlayerByConnection(connection net.Conn) (*Player, error) {
-	for _, player := range p.players {
-		player.Lock()
-		defer player.Unlock()
+// FindPlayerByName - Locate a player given their name.
+func (p *PlayerManager) FindPlayerByName(name string) (*Player, error) {
+	p.playerMutex.RLock()
+	defer p.playerMutex.RUnlock()
 
-		if player.Client == connection {
-			return player, nil
-		}
+	if player, ok := p.byName[name]; ok {
+		return player, nil
 	}
 
-	return &Player{}, errors.New("could not find any players with the given connection")
+	return &Player{}, errors.New("no such player found")
 }
 
-// PlayerHasLobby - This function is used to determine whether or not a player
-// is in a lobby.
-func (p *PlayerManager) PlayerHasLobby(player *Player) bool {
-	for _, lobby := range Lobbies().GetLobbies() {
-		if lobby.PlayerExists(player) {
-			return true
-		}
+// FindPlayerByConnection - Locate the player using a given connection.
+func (p *PlayerManager) FindPlayerByConnection(connection Connection) (*Player, error) {
+	p.playerMutex.RLock()
+	defer p.playerMutex.RUnlock()
+
+	if player, ok := p.byConnection[connection]; ok {
+		return player, nil
 	}
 
-	return false
+	return &Player{}, errors.New("could not find any players with the given connection")
 }
 
+// GetPlayers - Returns a copy of the player list sorted by name. The copy is
+// safe to range over while players come and go.
 func (p *PlayerManager) GetPlayers() []*Player {
-	return p.players
+	p.playerMutex.RLock()
+
+	players := make([]*Player, 0, len(p.players))
+
+	for player := range p.players {
+		players = append(players, player)
+	}
+
+	p.playerMutex.RUnlock()
+
+	sort.Slice(players, func(i, j int) bool {
+		return players[i].Name < players[j].Name
+	})
+
+	return players
+}
+
+// Count - Returns the number of players present.
+func (p *PlayerManager) Count() int {
+	p.playerMutex.RLock()
+	defer p.playerMutex.RUnlock()
+
+	return len(p.players)
 }
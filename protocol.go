@@ -54,8 +54,23 @@ const (
 	PacketTypeUseCardResponse
 	PacketTypeLobbyChatRequest
 	PacketTypeLobbyChatResponse
+	PacketTypePing
+	PacketTypePong
+	PacketTypeResumeRequest
+	PacketTypeResumeResponse
+	PacketTypeStateSnapshot
+	PacketTypeServerShutdown
+	PacketTypeReloadRequest
+	PacketTypeReloadResponse
+	PacketTypeCardSearchRequest
+	PacketTypeCardSearchResponse
 )
 
+// PacketTypeUserDefined - The first packet type available to custom packets
+// registered with RegisterPacketType. Everything below is reserved for the
+// protocol itself.
+const PacketTypeUserDefined uint16 = 1024
+
 type PileType uint8
 
 const (
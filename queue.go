@@ -0,0 +1,224 @@
+package kfnetwork
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// SlowClientPolicy - Decides what happens to a connection whose outbound
+// queue fills up because the client isn't reading fast enough.
+type SlowClientPolicy string
+
+const (
+	// SlowClientDrop - Drop the packet that didn't fit and keep going.
+	SlowClientDrop SlowClientPolicy = "drop"
+	// SlowClientDisconnect - Give up on the client and close the connection.
+	SlowClientDisconnect SlowClientPolicy = "disconnect"
+)
+
+// ErrOutboundQueueFull - Returned when a packet is dropped because the
+// connection's outbound queue is full.
+var ErrOutboundQueueFull = errors.New("outbound queue full, packet dropped")
+
+// ErrSlowClient - Returned when a connection is closed because its outbound
+// queue filled up.
+var ErrSlowClient = errors.New("outbound queue full, slow client disconnected")
+
+// ErrConnectionClosed - Returned when writing to a connection that has
+// already been closed.
+var ErrConnectionClosed = errors.New("connection closed")
+
+// QueueStats - Point in time metrics for one or more outbound queues.
+type QueueStats struct {
+	Connections int    `json:"connections"`
+	Depth       int    `json:"depth"`
+	HighWater   int    `json:"high_water"`
+	Capacity    int    `json:"capacity"`
+	Sent        uint64 `json:"sent"`
+	Dropped     uint64 `json:"dropped"`
+	SlowClients int    `json:"slow_clients"`
+}
+
+// QueuedConnection - Wraps a Connection so that writes are handed off to a
+// bounded queue and performed by a single writer goroutine. Callers never
+// block on a slow client, and packets can't interleave on the wire since
+// only the writer touches the underlying connection.
+type QueuedConnection struct {
+	Connection
+	queue        chan Packet
+	done         chan struct{}
+	policy       SlowClientPolicy
+	writeTimeout time.Duration
+	queueMutex   sync.Mutex
+	closed       bool
+	slow         bool
+	highWater    int
+	sent         uint64
+	dropped      uint64
+}
+
+// NewQueuedConnection - Wraps a connection in an outbound queue of the given
+// size and starts its writer goroutine. Each write is bounded by the write
+// timeout if it's greater than zero.
+func NewQueuedConnection(connection Connection, size int, policy SlowClientPolicy, writeTimeout time.Duration) *QueuedConnection {
+	if size < 1 {
+		size = 1
+	}
+
+	queued := new(QueuedConnection)
+	queued.Connection = connection
+	queued.queue = make(chan Packet, size)
+	queued.done = make(chan struct{})
+	queued.policy = policy
+	queued.writeTimeout = writeTimeout
+
+	go queued.writeLoop()
+
+	return queued
+}
+
+// WritePacket - Queues a packet for the writer goroutine. If the queue is
+// full the packet is dropped, and under the disconnect policy the
+// connection is closed as well.
+func (q *QueuedConnection) WritePacket(packet Packet) error {
+	q.queueMutex.Lock()
+	defer q.queueMutex.Unlock()
+
+	if q.closed {
+		return ErrConnectionClosed
+	}
+
+	select {
+	case q.queue <- packet:
+		if len(q.queue) > q.highWater {
+			q.highWater = len(q.queue)
+		}
+
+		return nil
+	default:
+	}
+
+	q.dropped++
+
+	if q.policy == SlowClientDisconnect {
+		q.slow = true
+		q.closed = true
+		close(q.queue)
+		q.Connection.Close()
+		return ErrSlowClient
+	}
+
+	return ErrOutboundQueueFull
+}
+
+// SetWriteDeadline - Write deadlines are managed by the writer goroutine
+// using the queue's write timeout, so this does nothing.
+func (q *QueuedConnection) SetWriteDeadline(deadline time.Time) error {
+	return nil
+}
+
+// Close - Stops accepting packets. Packets already queued are flushed
+// before the underlying connection is closed, so an ErrorPacket sent just
+// before closing still reaches the client.
+func (q *QueuedConnection) Close() error {
+	q.queueMutex.Lock()
+	defer q.queueMutex.Unlock()
+
+	if q.closed {
+		return nil
+	}
+
+	q.closed = true
+	close(q.queue)
+	return nil
+}
+
+// Done - Returns a channel which is closed once the writer goroutine has
+// flushed the queue and closed the underlying connection.
+func (q *QueuedConnection) Done() <-chan struct{} {
+	return q.done
+}
+
+// Slow - Determine whether the connection was closed for falling behind.
+func (q *QueuedConnection) Slow() bool {
+	q.queueMutex.Lock()
+	defer q.queueMutex.Unlock()
+
+	return q.slow
+}
+
+// Stats - Returns the current metrics for the queue.
+func (q *QueuedConnection) Stats() QueueStats {
+	q.queueMutex.Lock()
+	defer q.queueMutex.Unlock()
+
+	stats := QueueStats{}
+	stats.Connections = 1
+	stats.Depth = len(q.queue)
+	stats.HighWater = q.highWater
+	stats.Capacity = cap(q.queue)
+	stats.Sent = q.sent
+	stats.Dropped = q.dropped
+
+	if q.slow {
+		stats.SlowClients = 1
+	}
+
+	return stats
+}
+
+func (q *QueuedConnection) writeLoop() {
+	defer close(q.done)
+	defer q.Connection.Close()
+
+	failed := false
+
+	for packet := range q.queue {
+		if failed {
+			q.countDropped()
+			continue
+		}
+
+		if q.writeTimeout > 0 {
+			q.Connection.SetWriteDeadline(time.Now().Add(q.writeTimeout))
+		}
+
+		e := q.Connection.WritePacket(packet)
+
+		if e != nil {
+			// Once a write fails the connection is unusable. Close it so
+			// the read loop notices, and discard whatever is left.
+			failed = true
+			q.Connection.Close()
+			q.countDropped()
+			continue
+		}
+
+		q.queueMutex.Lock()
+		q.sent++
+		q.queueMutex.Unlock()
+	}
+}
+
+func (q *QueuedConnection) countDropped() {
+	q.queueMutex.Lock()
+	q.dropped++
+	q.queueMutex.Unlock()
+}
+
+// Add - Combines the metrics of another queue into these.
+func (s QueueStats) Add(other QueueStats) QueueStats {
+	s.Connections += other.Connections
+	s.Depth += other.Depth
+	s.Capacity += other.Capacity
+	s.Sent += other.Sent
+	s.Dropped += other.Dropped
+	s.SlowClients += other.SlowClients
+
+	if other.HighWater > s.HighWater {
+		s.HighWater = other.HighWater
+	}
+
+	return s
+}
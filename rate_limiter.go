@@ -0,0 +1,81 @@
+package kfnetwork
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter - A token bucket which lets bursts of up to burst calls
+// through at once and refills at rate calls per second after that.
+type RateLimiter struct {
+	limiterMutex sync.Mutex
+	rate         float64
+	burst        float64
+	tokens       float64
+	last         time.Time
+}
+
+// NewRateLimiter - Returns a pointer to a new, full rate limiter. A rate of
+// zero or less means no limit.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	limiter := new(RateLimiter)
+	limiter.rate = rate
+	limiter.burst = float64(burst)
+	limiter.tokens = float64(burst)
+	limiter.last = time.Now()
+	return limiter
+}
+
+// Wait - Blocks until a call may go ahead or the context ends, in which
+// case the context's error is returned.
+func (r *RateLimiter) Wait(ctx context.Context) error {
+	if r == nil || r.rate <= 0 {
+		return ctx.Err()
+	}
+
+	for {
+		r.limiterMutex.Lock()
+
+		now := time.Now()
+		r.tokens += now.Sub(r.last).Seconds() * r.rate
+		r.last = now
+
+		if r.tokens > r.burst {
+			r.tokens = r.burst
+		}
+
+		if r.tokens >= 1 {
+			r.tokens--
+			r.limiterMutex.Unlock()
+			return nil
+		}
+
+		wait := time.Duration((1 - r.tokens) / r.rate * float64(time.Second))
+		r.limiterMutex.Unlock()
+
+		e := sleepContext(ctx, wait)
+
+		if e != nil {
+			return e
+		}
+	}
+}
+
+// sleepContext - Sleeps for the given duration unless the context ends
+// first.
+func sleepContext(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,279 @@
+package kfnetwork
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNotAdmin - Returned when a player who isn't listed in the admins
+// configuration tries to use an admin command.
+var ErrNotAdmin = errors.New("admin privileges required")
+
+// WithConfigLoader - Reload reads the configuration through loader, which
+// would normally parse the same file, environment and flags the server was
+// started with. Without a loader Reload keeps the current configuration and
+// only reloads the card data.
+func WithConfigLoader(loader func() (ServerConfiguration, error)) ServerOption {
+	return func(s *Server) {
+		s.configLoader = loader
+	}
+}
+
+// Configuration - Returns the configuration currently in effect.
+func (s *Server) Configuration() ServerConfiguration {
+	s.configMutex.RLock()
+	defer s.configMutex.RUnlock()
+
+	return s.Config
+}
+
+// Cards - Returns the card database new games are started with.
+func (s *Server) Cards() *CardManager {
+	s.cardMutex.RLock()
+	defer s.cardMutex.RUnlock()
+
+	return s.cards
+}
+
+// LearnCards - Adds any cards the card database hasn't seen, such as those
+// linked to a deck retrieved from the Vault, and saves them to the card
+// data path along with the cards loaded from it, so it grows as the server
+// is used. Cards from the extra card data files stay in their own files.
+// The cards are added to a copy of the database which is then swapped in,
+// as Reload does, so games already running keep the cards they started
+// with. It returns how many cards were added.
+func (s *Server) LearnCards(cards []Card) (int, error) {
+	// Most decks hold nothing new, and those never wait on a reload or
+	// touch the card file.
+	if len(s.Cards().Unknown(cards)) == 0 {
+		return 0, nil
+	}
+
+	// Holding the reload lock means a reload either sees the saved file or
+	// its fresh database gets the cards.
+	s.reloadMutex.Lock()
+	defer s.reloadMutex.Unlock()
+
+	database := s.Cards().Clone()
+	added := database.Merge(cards)
+
+	if added == 0 {
+		return 0, nil
+	}
+
+	s.cardMutex.Lock()
+	s.cards = database
+	s.cardMutex.Unlock()
+
+	path := s.Configuration().CardDataPath
+	logger := s.Logger.Subsystem("cards")
+	e := database.WriteToFile(path)
+
+	if e != nil {
+		logger.Error(fmt.Sprintf("Unable to save learned cards: %s", e.Error()), Fields{"path": path})
+		return added, e
+	}
+
+	logger.Log(fmt.Sprintf("Learned %d new cards.", added), Fields{"path": path, "cards": database.Count()})
+	return added, nil
+}
+
+// CheckCards - Validates a card database, logging a warning for each
+// problem found and writing the report to the configured card report path,
+// if there is one. It is run whenever card data is loaded.
+func (s *Server) CheckCards(cards *CardManager) CardReport {
+	report := cards.Validate()
+	logger := s.Logger.Subsystem("cards")
+
+	for _, issue := range report.Issues {
+		logger.Warn(fmt.Sprintf("Card data problem: %s", issue.Message), Fields{
+			"kind":      string(issue.Kind),
+			"id":        issue.CardID,
+			"title":     issue.CardTitle,
+			"expansion": issue.Expansion,
+			"number":    issue.Number,
+		})
+	}
+
+	path := s.Configuration().CardReportPath
+
+	if path != "" {
+		e := report.WriteToFile(path)
+
+		if e != nil {
+			logger.Error(fmt.Sprintf("Unable to write the card report: %s", e.Error()), Fields{"path": path})
+		}
+	}
+
+	return report
+}
+
+// IsAdmin - Determine whether a player may use admin commands.
+func (s *Server) IsAdmin(player *Player) bool {
+	for _, id := range s.Configuration().Admins {
+		if player != nil && player.ID == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// StartGame - Starts a game in the lobby using the current card database.
+// The game keeps that database until it ends, even if the cards are
+// reloaded in the meantime.
+func (s *Server) StartGame(lobby *Lobby) (*Game, error) {
+	command := &StartGameCommand{Events: s.Events, Cards: s.Cards()}
+	e := lobby.Execute(command)
+
+	if e != nil {
+		return nil, e
+	}
+
+	return command.Game, command.Err
+}
+
+// Reload - Reloads the configuration and card data without restarting. The
+// new configuration and cards are loaded and validated in full before
+// anything is changed, so a bad file leaves the server as it was. The card
+// database is swapped in one step: games already running keep the cards
+// they started with while new games get the new ones. Listen addresses,
+// debug mode and the deck store directory only change on restart. Settings
+// read when a connection is accepted, such as the ping interval, apply to
+// new connections. A ServerReloadedEvent is published once the reload is
+// done.
+func (s *Server) Reload() error {
+	s.reloadMutex.Lock()
+	defer s.reloadMutex.Unlock()
+
+	logger := s.Logger.Subsystem("server")
+	current := s.Configuration()
+	config := current
+
+	if s.configLoader != nil {
+		loaded, e := s.configLoader()
+
+		if e == nil {
+			e = loaded.Validate()
+		}
+
+		if e != nil {
+			logger.Error(fmt.Sprintf("Reload failed: %s", e.Error()))
+			return e
+		}
+
+		config = loaded
+	}
+
+	cards := NewCardManager()
+	e := cards.LoadFromPaths(config.CardDataPaths()...)
+
+	if e != nil {
+		logger.Error(fmt.Sprintf("Reload failed, unable to load card data: %s", e.Error()), Fields{"paths": config.CardDataPaths()})
+		return e
+	}
+
+	restartOnly := []struct {
+		name    string
+		changed bool
+	}{
+		{"address", config.Address != current.Address},
+		{"websocket_address", config.WebSocketAddress != current.WebSocketAddress},
+		{"debug", config.Debug != current.Debug},
+		{"deck_store_directory", config.DeckStoreDirectory != current.DeckStoreDirectory},
+	}
+
+	for _, setting := range restartOnly {
+		if setting.changed {
+			logger.Warn(fmt.Sprintf("Setting %s only takes effect after a restart.", setting.name))
+		}
+	}
+
+	config.Address = current.Address
+	config.WebSocketAddress = current.WebSocketAddress
+	config.Debug = current.Debug
+	config.DeckStoreDirectory = current.DeckStoreDirectory
+
+	// Both sets of sinks are opened before either is swapped in, so a
+	// failure leaves logging and auditing as they were.
+	var logSinks, auditSinks []LogSink
+
+	if s.ownLogger {
+		logSinks, e = config.Logging.OpenSinks()
+
+		if e != nil {
+			logger.Error(fmt.Sprintf("Reload failed, unable to configure logging: %s", e.Error()))
+			return e
+		}
+	}
+
+	if s.ownAudit {
+		auditSinks, e = config.Audit.logConfiguration().OpenSinks()
+
+		if e != nil {
+			for _, sink := range logSinks {
+				sink.Close()
+			}
+
+			logger.Error(fmt.Sprintf("Reload failed, unable to configure the audit log: %s", e.Error()))
+			return e
+		}
+	}
+
+	if s.ownLogger {
+		s.Logger.configure(config.Logging, logSinks)
+	}
+
+	if s.ownAudit {
+		s.Audit.configure(config.Audit, auditSinks)
+	}
+
+	s.configMutex.Lock()
+	s.Config = config
+	s.configMutex.Unlock()
+
+	s.cardMutex.Lock()
+	s.cards = cards
+	s.cardMutex.Unlock()
+
+	s.Lobbies.SetCapacity(config.LobbyCapacity)
+	s.CheckCards(cards)
+
+	if s.ownDecks {
+		s.Decks.SetTTL(time.Duration(config.DeckCacheTTL))
+	}
+
+	logger.Log("Configuration and card data reloaded.", Fields{"cards": cards.Count()})
+	s.Events.Publish(ServerReloadedEvent{Config: config, Cards: cards})
+	return nil
+}
+
+// HandleReloadRequest - Reloads the server on behalf of an admin.
+func (s *Server) HandleReloadRequest(client Connection, packet ReloadRequestPacket) error {
+	player, e := s.Players.FindPlayerByConnection(client)
+
+	if e != nil || !s.IsAdmin(player) {
+		return ErrNotAdmin
+	}
+
+	s.Logger.Subsystem("server").Log(fmt.Sprintf("Player %s requested a reload.", player.Name), PlayerFields(player))
+
+	e = s.Reload()
+
+	if e != nil {
+		return fmt.Errorf("reload failed: %s", e.Error())
+	}
+
+	return s.SendReloadResponse(player, packet.Sequence, s.Cards().Count())
+}
+
+// SendReloadResponse - Tells an admin their reload succeeded.
+func (s *Server) SendReloadResponse(player *Player, sequence uint16, cards int) error {
+	packet := ReloadResponsePacket{}
+	packet.Type = PacketTypeReloadResponse
+	packet.Sequence = sequence
+	packet.Cards = cards
+
+	return s.WritePacket(player.Connection(), packet)
+}
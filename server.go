@@ -1,50 +1,230 @@
 package kfnetwork
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Server - This type represent our server at a high level
 type Server struct {
 	ClientMutex   sync.Mutex
-	CardManager   *CardManager
+	connections   map[Connection]struct{}
+	Config        ServerConfiguration
+	configMutex   sync.RWMutex
+	configLoader  func() (ServerConfiguration, error)
+	reloadMutex   sync.Mutex
+	cards         *CardManager
+	cardMutex     sync.RWMutex
 	Debug         bool
 	Listener      net.Listener
 	ListenerMutex sync.Mutex
-	LogQueue      chan string
+	WebServer     *http.Server
 	observers     []Observer
 	PacketQueue   chan Packet
-	Running       bool
+	Sessions      *SessionManager
+	Players       *PlayerManager
+	Lobbies       *LobbyManager
+	Events        *EventManager
+	Logger        *LogManager
+	Handlers      *HandlerRegistry
+	Audit         *AuditLog
+	Vault         VaultClient
+	Decks         *DeckStore
+	ownEvents     bool
+	ownLogger     bool
+	ownAudit      bool
+	ownDecks      bool
+	running       int32
+	closing       int32
+	shuttingDown  bool
+	closed        bool
+	waitGroup     sync.WaitGroup
+	readLoops     sync.WaitGroup
+	done          chan struct{}
+	ctx           context.Context
+	cancel        context.CancelFunc
 }
 
-// NewServer - Return a pointer to a newly created server
-func NewServer(address string) *Server {
+// ServerOption - Customizes a server as it is created.
+type ServerOption func(*Server)
+
+// WithPlayerManager - Use the given player manager instead of a new one.
+func WithPlayerManager(players *PlayerManager) ServerOption {
+	return func(s *Server) {
+		s.Players = players
+	}
+}
+
+// WithLobbyManager - Use the given lobby manager instead of a new one.
+func WithLobbyManager(lobbies *LobbyManager) ServerOption {
+	return func(s *Server) {
+		s.Lobbies = lobbies
+	}
+}
+
+// WithEventManager - Use the given event manager instead of a new one.
+func WithEventManager(events *EventManager) ServerOption {
+	return func(s *Server) {
+		s.Events = events
+	}
+}
+
+// WithLogger - Use the given logger instead of a new one.
+func WithLogger(logger *LogManager) ServerOption {
+	return func(s *Server) {
+		s.Logger = logger
+	}
+}
+
+// WithAuditLog - Use the given packet audit log instead of a new one.
+func WithAuditLog(audit *AuditLog) ServerOption {
+	return func(s *Server) {
+		s.Audit = audit
+	}
+}
+
+// WithDeckStore - Use the given deck store instead of opening the one in
+// the configured directory.
+func WithDeckStore(decks *DeckStore) ServerOption {
+	return func(s *Server) {
+		s.Decks = decks
+	}
+}
+
+// WithVaultClient - Use the given Vault client instead of one built from the
+// configuration.
+func WithVaultClient(vault VaultClient) ServerOption {
+	return func(s *Server) {
+		s.Vault = vault
+	}
+}
+
+// NewServer - Return a pointer to a newly created server listening on the
+// configured address. Each server owns its own players, lobbies, events and
+// logs unless options supply them. An error is returned if the configuration
+// is invalid or its log files cannot be opened.
+func NewServer(config ServerConfiguration, options ...ServerOption) (*Server, error) {
+	e := config.Validate()
+
+	if e != nil {
+		return nil, e
+	}
+
 	server := new(Server)
-	server.Debug = true
-	server.Running = true
-	server.LogQueue = make(chan string, 1024)
+	server.Config = config
+
+	for _, option := range options {
+		option(server)
+	}
+
+	if server.Logger == nil {
+		server.Logger, e = NewLogManagerFromConfig(server.Config.Logging)
+
+		if e != nil {
+			return nil, fmt.Errorf("unable to configure logging: %s", e.Error())
+		}
+
+		server.ownLogger = true
+	}
+
+	if server.Audit == nil {
+		server.Audit, e = NewAuditLogFromConfig(server.Config.Audit)
+
+		if e != nil {
+			if server.ownLogger {
+				server.Logger.Close()
+			}
+
+			return nil, fmt.Errorf("unable to configure the audit log: %s", e.Error())
+		}
+
+		server.ownAudit = true
+	}
+
+	if server.Vault == nil {
+		server.Vault = NewHTTPVaultClientFromConfig(server.Config.Vault)
+	}
+
+	if server.Decks == nil {
+		server.Decks, e = NewDeckStore(server.Config.DeckStoreDirectory, time.Duration(server.Config.DeckCacheTTL))
+
+		if e != nil {
+			if server.ownAudit {
+				server.Audit.Close()
+			}
+
+			if server.ownLogger {
+				server.Logger.Close()
+			}
+
+			return nil, fmt.Errorf("unable to open the deck store: %s", e.Error())
+		}
+
+		server.ownDecks = true
+	}
+
+	if server.Players == nil {
+		server.Players = NewPlayerManager(server.Logger)
+	}
+
+	if server.Lobbies == nil {
+		server.Lobbies = NewLobbyManager()
+		server.Lobbies.SetCapacity(server.Config.LobbyCapacity)
+		server.Lobbies.SetLogger(server.Logger.Subsystem("lobby"))
+	}
+
+	if server.Events == nil {
+		server.Events = NewEventManager(server.Logger)
+		server.ownEvents = true
+	}
 
-	server.CardManager = NewCardManager()
-	e := server.CardManager.LoadFromFile("data/cards.json")
+	server.Handlers = NewHandlerRegistry()
+	server.registerBuiltinHandlers()
+
+	server.Debug = server.Config.Debug
+	server.running = 1
+	server.done = make(chan struct{})
+	server.ctx, server.cancel = context.WithCancel(context.Background())
+	server.Sessions = NewSessionManager()
+	server.connections = make(map[Connection]struct{})
+
+	server.cards = NewCardManager()
+	e = server.cards.LoadFromPaths(server.Config.CardDataPaths()...)
 
 	if e != nil && server.Debug {
 		logEntry := fmt.Sprintf("error loading card data: %s", e.Error())
-		Logger().Warn(logEntry)
+		server.Logger.Subsystem("cards").Warn(logEntry)
+	}
+
+	if e == nil {
+		server.CheckCards(server.cards)
 	}
 
 	// Add Observers
-	server.AddObserver(Events())
+	server.AddObserver(server.Events)
 
-	// Start the listen loop on the specified address
-	go server.ListenLoop(address)
+	// Start the listen loop on the configured address
+	server.waitGroup.Add(1)
+	go server.ListenLoop(server.Config.Address)
 
 	if server.Debug {
-		Logger().Log("Server successfully started.")
+		server.Logger.Log("Server successfully started.")
 	}
 
-	return server
+	return server, nil
+}
+
+// Context - Returns a context which is cancelled once the server starts
+// shutting down. Work done on a client's behalf, such as Vault lookups,
+// should use it so it doesn't hold up the shutdown.
+func (s *Server) Context() context.Context {
+	return s.ctx
 }
 
 // AddObserver - Adds an observer to the list of observers. Observers would be
@@ -77,17 +257,26 @@ func (s *Server) NotifyObservers(event Event) {
 
 // Listen - Listen for incoming connections
 func (s *Server) Listen(address string) error {
-	var e error
-
-	s.Listener, e = net.Listen("tcp4", address)
+	listener, e := net.Listen("tcp4", address)
 
 	if e != nil {
 		return e
 	}
 
+	s.ListenerMutex.Lock()
+	defer s.ListenerMutex.Unlock()
+
+	// Shutdown may have run while we were binding the port.
+	if s.closed {
+		listener.Close()
+		return errors.New("server is shutting down")
+	}
+
+	s.Listener = listener
+
 	if s.Debug {
 		logEntry := fmt.Sprintf("Listener started on address %s.", address)
-		Logger().Log(logEntry)
+		s.Logger.Subsystem("network").Log(logEntry, Fields{"address": address})
 	}
 
 	return nil
@@ -96,31 +285,39 @@ func (s *Server) Listen(address string) error {
 // ListenLoop - Listen on the specified address and accept incoming clients.
 // Spins off a new goroutine to handle the incoming client.
 func (s *Server) ListenLoop(address string) {
+	defer s.waitGroup.Done()
+
 	e := s.Listen(address)
 
 	// If we can't listen on the port print an error, halt the server, and return.
 	if e != nil {
 		logEntry := fmt.Sprintf("Unable to listen on address %s: %s", address, e.Error())
-		Logger().Error(logEntry)
-		s.Running = false
+		s.Logger.Subsystem("network").Error(logEntry, Fields{"address": address})
+		go s.Stop()
 		return
 	}
 
-	for s.Running {
+	for s.IsRunning() {
 		client, e := s.Accept()
 
-		// If we encounter an error, close the client.
-		if e != nil && client != nil {
-			client.Close()
-		} else {
-			if s.Debug {
-				logEntry := fmt.Sprintf("Client connection accepted from remote address %s.", client.RemoteAddr())
-				Logger().Log(logEntry)
+		// Accept fails once the listener is closed during shutdown.
+		if e != nil {
+			if !s.IsRunning() {
+				return
 			}
 
-			// Handle accepted client
-			go s.ReadLoop(client)
+			logEntry := fmt.Sprintf("Accept: %s", e.Error())
+			s.Logger.Subsystem("network").Error(logEntry)
+			continue
+		}
+
+		if s.Debug {
+			logEntry := fmt.Sprintf("Client connection accepted from remote address %s.", client.RemoteAddr())
+			s.Logger.Subsystem("network").Log(logEntry, Fields{"remote_addr": client.RemoteAddr().String()})
 		}
+
+		// Handle accepted client
+		go s.ReadLoop(s.QueueConnection(NewTCPConnection(client)))
 	}
 }
 
@@ -137,137 +334,557 @@ func (s *Server) Accept() (net.Conn, error) {
 	return connection, nil
 }
 
-func (s *Server) Stop() {
-	s.Running = false
+// ListenWebSocket - Start an HTTP listener on the specified address which
+// upgrades requests made to /ws into WebSocket connections. Browser clients
+// can't open raw TCP sockets, so this gives them a way in to the same packet
+// pipeline as everyone else.
+func (s *Server) ListenWebSocket(address string) error {
+	listener, e := net.Listen("tcp4", address)
+
+	if e != nil {
+		return e
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", s.ServeWebSocket)
+	webServer := &http.Server{Handler: mux}
+
+	s.ListenerMutex.Lock()
+	defer s.ListenerMutex.Unlock()
+
+	if s.closed {
+		listener.Close()
+		return errors.New("server is shutting down")
+	}
+
+	s.WebServer = webServer
+
+	if s.Debug {
+		logEntry := fmt.Sprintf("WebSocket listener started on address %s.", address)
+		s.Logger.Subsystem("network").Log(logEntry, Fields{"address": address})
+	}
+
+	s.waitGroup.Add(1)
+
+	go func() {
+		defer s.waitGroup.Done()
+		webServer.Serve(listener)
+	}()
+
+	return nil
+}
+
+// ServeWebSocket - HTTP handler which upgrades the request to a WebSocket
+// connection and runs the read loop for it.
+func (s *Server) ServeWebSocket(w http.ResponseWriter, r *http.Request) {
+	client, e := UpgradeWebSocket(w, r)
+
+	if e != nil {
+		logEntry := fmt.Sprintf("Unable to upgrade WebSocket connection from %s: %s", r.RemoteAddr, e.Error())
+		s.Logger.Subsystem("network").Error(logEntry, Fields{"remote_addr": r.RemoteAddr})
+		return
+	}
+
+	if s.Debug {
+		logEntry := fmt.Sprintf("WebSocket connection accepted from remote address %s.", client.RemoteAddr())
+		s.Logger.Subsystem("network").Log(logEntry, RemoteFields(client))
+	}
+
+	s.ReadLoop(s.QueueConnection(client))
+}
+
+// QueueConnection - Wraps a freshly accepted connection in an outbound queue
+// using the configured queue size, slow client policy and write timeout.
+func (s *Server) QueueConnection(client Connection) *QueuedConnection {
+	config := s.Configuration()
+	return NewQueuedConnection(client, config.OutboundQueueSize, config.SlowClientPolicy, time.Duration(config.WriteTimeout))
+}
+
+// OutboundQueueStats - Returns the combined outbound queue metrics for every
+// open connection.
+func (s *Server) OutboundQueueStats() QueueStats {
+	stats := QueueStats{}
+
+	s.ClientMutex.Lock()
+	defer s.ClientMutex.Unlock()
+
+	for client := range s.connections {
+		if queued, ok := client.(*QueuedConnection); ok {
+			stats = stats.Add(queued.Stats())
+		}
+	}
+
+	return stats
+}
+
+// trackConnection - Registers a connection so shutdown can find and wait
+// for it. Returns false if the server is already shutting down.
+func (s *Server) trackConnection(client Connection) bool {
+	s.ClientMutex.Lock()
+	defer s.ClientMutex.Unlock()
+
+	if s.shuttingDown {
+		return false
+	}
+
+	s.connections[client] = struct{}{}
+	s.waitGroup.Add(1)
+	s.readLoops.Add(1)
+	return true
+}
+
+func (s *Server) untrackConnection(client Connection) {
+	s.ClientMutex.Lock()
+	delete(s.connections, client)
+	s.ClientMutex.Unlock()
+
+	s.readLoops.Done()
+	s.waitGroup.Done()
+}
+
+// IsRunning - Determine whether the server is still accepting work. This
+// turns false as soon as a shutdown begins.
+func (s *Server) IsRunning() bool {
+	return atomic.LoadInt32(&s.running) == 1
+}
+
+// connectionsOpen - Determine whether read loops should keep reading. A
+// shutdown leaves connections open while running games are drained, so
+// players can still finish them, and only then closes them.
+func (s *Server) connectionsOpen() bool {
+	return atomic.LoadInt32(&s.closing) == 0
+}
+
+// armReadDeadline - Pushes back the connection's read deadline before the
+// next read. Returns false once connections are closing. Shutdown expires
+// the deadlines under the same lock, so one can't be pushed back after it.
+func (s *Server) armReadDeadline(client Connection) bool {
+	s.ClientMutex.Lock()
+	defer s.ClientMutex.Unlock()
+
+	if !s.connectionsOpen() {
+		return false
+	}
+
+	if timeout := s.Configuration().ReadTimeout; timeout > 0 {
+		client.SetReadDeadline(time.Now().Add(time.Duration(timeout)))
+	}
+
+	return true
 }
 
 func (s *Server) Log(message string) {
-	Logger().Log(message)
+	s.Logger.Log(message)
+}
+
+// RemoteFields - Log fields identifying a connection.
+func RemoteFields(client Connection) Fields {
+	return Fields{"remote_addr": client.RemoteAddr().String()}
+}
+
+// PlayerFields - Log fields identifying a player.
+func PlayerFields(player *Player) Fields {
+	return Fields{"player_id": player.ID, "player_name": player.Name}
 }
 
-func (s *Server) ReadLoop(client net.Conn) {
-	for s.Running {
-		packet, e := ReadPacket(client)
+// ReadLoop - Reads packets from a connection until it fails or times out.
+// A heartbeat goroutine pings the connection for as long as the loop runs,
+// and any connection which stays silent past the read timeout is evicted.
+func (s *Server) ReadLoop(client Connection) {
+	if !s.trackConnection(client) {
+		client.Close()
+		return
+	}
+
+	defer s.untrackConnection(client)
+
+	done := make(chan struct{})
+	defer close(done)
+
+	if s.Configuration().PingInterval > 0 {
+		s.waitGroup.Add(1)
+
+		go func() {
+			defer s.waitGroup.Done()
+			s.HeartbeatLoop(client, done)
+		}()
+	}
+
+	for s.armReadDeadline(client) {
+		packet, e := client.ReadPacket()
 
 		if e != nil {
-			logEntry := fmt.Sprintf("ReadPacket: %s", e.Error())
-			Logger().Error(logEntry)
-			player, e := Players().FindPlayerByConnection(client)
-			if e == nil {
-				Players().RemovePlayer(player)
+			// Shutdown closes every connection and cleans up after them.
+			if !s.connectionsOpen() {
+				return
 			}
-			s.CloseConnection(client)
+
+			if IsTimeout(e) {
+				logEntry := fmt.Sprintf("Connection %s timed out.", client.RemoteAddr())
+				s.Logger.Subsystem("network").Warn(logEntry, RemoteFields(client))
+			} else if queued, ok := client.(*QueuedConnection); ok && queued.Slow() {
+				logEntry := fmt.Sprintf("Connection %s fell too far behind and was closed.", client.RemoteAddr())
+				s.Logger.Subsystem("network").Warn(logEntry, RemoteFields(client))
+			} else {
+				logEntry := fmt.Sprintf("ReadPacket: %s", e.Error())
+				s.Logger.Subsystem("network").Error(logEntry, RemoteFields(client))
+			}
+
+			s.DropClient(client)
 			return
 		}
 
-		s.NotifyObservers(NetworkEvent{connection: &client, packet: &packet})
+		s.auditPacket(AuditInbound, client, packet)
+		s.NotifyObservers(NetworkEvent{connection: client, packet: &packet})
 		s.HandlePacket(client, packet)
 	}
 }
 
-func (s *Server) CloseConnection(client net.Conn) {
+// DisconnectClient - The single removal path for a connection going away,
+// whether the client quit, the socket failed, or the heartbeat timed out. The
+// player is pulled out of any game and lobby they belong to before being
+// removed from the player list and having their connection closed.
+func (s *Server) DisconnectClient(client Connection) {
+	player, e := s.Players.FindPlayerByConnection(client)
+
+	if e == nil {
+		s.RemovePlayer(player)
+
+		logEntry := fmt.Sprintf("Player %s disconnected.", player.Name)
+		s.Logger.Subsystem("session").Log(logEntry, PlayerFields(player))
+	}
+
+	s.CloseConnection(client)
+}
+
+// DropClient - Called when a connection fails rather than quitting cleanly.
+// Players holding a session keep their seat for the configured grace period
+// so they can resume; everyone else is disconnected right away.
+func (s *Server) DropClient(client Connection) {
+	player, e := s.Players.FindPlayerByConnection(client)
+	gracePeriod := time.Duration(s.Configuration().SessionGracePeriod)
+
+	if e != nil || gracePeriod <= 0 {
+		s.DisconnectClient(client)
+		return
+	}
+
+	session, e := s.Sessions.FindSessionByPlayer(player)
+
+	if e != nil {
+		s.DisconnectClient(client)
+		return
+	}
+
+	session.Suspend(gracePeriod, func() {
+		s.ExpireSession(session)
+	})
+
+	logEntry := fmt.Sprintf("Player %s lost their connection, holding their session for %s.", player.Name, gracePeriod)
+	s.Logger.Subsystem("session").Log(logEntry, PlayerFields(player))
+
+	s.CloseConnection(client)
+}
+
+// ExpireSession - Called once a suspended session's grace period runs out
+// without the player coming back.
+func (s *Server) ExpireSession(session *Session) {
+	player := session.Player
+	s.RemovePlayer(player)
+
+	logEntry := fmt.Sprintf("Session for player %s expired.", player.Name)
+	s.Logger.Subsystem("session").Log(logEntry, PlayerFields(player))
+}
+
+// RemovePlayer - Removes a player from the server entirely: their game seat,
+// lobby membership, session and entry in the player list.
+func (s *Server) RemovePlayer(player *Player) {
+	session, e := s.Sessions.FindSessionByPlayer(player)
+
+	if e == nil {
+		s.Sessions.RemoveSession(session)
+	}
+
+	s.RemovePlayerFromGame(player)
+	s.RemovePlayerFromLobby(player)
+	s.Players.RemovePlayer(player)
+}
+
+// RemovePlayerFromLobby - Removes a player from whichever lobby they are in.
+// The remaining players are told about the departure, the host role passes
+// to the next player, and empty lobbies are removed entirely.
+func (s *Server) RemovePlayerFromLobby(player *Player) {
+	lobby, e := s.Lobbies.FindLobbyByPlayer(player)
+
+	if e != nil {
+		return
+	}
+
+	command := s.Lobbies.LeaveLobby(lobby, player)
+
+	for _, p := range command.Remaining {
+		s.SendLeaveLobbyResponse(p, 0, lobby.Name(), lobby.ID(), true)
+	}
+}
+
+// RemovePlayerFromGame - Removes a player from the game they are seated in,
+// if any. A game which no longer has enough players stops running. Games
+// belonging to a lobby are changed on the lobby's goroutine.
+func (s *Server) RemovePlayerFromGame(player *Player) {
+	if player.Game == nil {
+		return
+	}
+
+	lobby, e := s.Lobbies.FindLobbyByPlayer(player)
+
+	if e == nil && lobby.Game() == player.Game {
+		lobby.Execute(&LeaveGameCommand{Player: player})
+		return
+	}
+
+	player.Game.RemovePlayer(player)
+	player.Game = nil
+}
+
+// AddPlayer - Adds a player to this server's player list.
+func (s *Server) AddPlayer(player *Player) {
+	s.Players.AddPlayer(player)
+}
+
+// PlayerExists - Determine whether a player is on this server.
+func (s *Server) PlayerExists(player *Player) bool {
+	return s.Players.PlayerExists(player)
+}
+
+// FindPlayerByConnection - Locate the player using a given connection.
+func (s *Server) FindPlayerByConnection(client Connection) (*Player, error) {
+	return s.Players.FindPlayerByConnection(client)
+}
+
+// PlayerHasLobby - Determine whether a player is in one of this server's
+// lobbies.
+func (s *Server) PlayerHasLobby(player *Player) bool {
+	_, e := s.Lobbies.FindLobbyByPlayer(player)
+	return e == nil
+}
+
+// AddLobby - Creates a lobby hosted by the given player.
+func (s *Server) AddLobby(creator *Player, name string) *Lobby {
+	return s.Lobbies.AddLobby(creator, name)
+}
+
+// RemoveLobby - Removes a lobby from this server.
+func (s *Server) RemoveLobby(lobby *Lobby) {
+	s.Lobbies.RemoveLobby(lobby)
+}
+
+// FindLobbyByName - Locate a lobby given its name.
+func (s *Server) FindLobbyByName(name string) (*Lobby, error) {
+	return s.Lobbies.FindLobbyByName(name)
+}
+
+// FindLobbyByID - Locate a lobby given its ID.
+func (s *Server) FindLobbyByID(id string) (*Lobby, error) {
+	return s.Lobbies.FindLobbyByID(id)
+}
+
+// WritePacket - Writes a packet to a connection, bounded by the configured
+// write timeout so a stalled client can't block the caller forever.
+func (s *Server) WritePacket(client Connection, packet Packet) error {
+	if timeout := s.Configuration().WriteTimeout; timeout > 0 {
+		client.SetWriteDeadline(time.Now().Add(time.Duration(timeout)))
+	}
+
+	s.auditPacket(AuditOutbound, client, packet)
+	return client.WritePacket(packet)
+}
+
+// auditPacket - Records a packet in the audit log. The player is only looked
+// up while someone is being audited.
+func (s *Server) auditPacket(direction AuditDirection, client Connection, packet Packet) {
+	if !s.Audit.Active() {
+		return
+	}
+
+	player, e := s.Players.FindPlayerByConnection(client)
+
+	if e != nil {
+		player = nil
+	}
+
+	s.Audit.Record(direction, client, player, packet)
+}
+
+func (s *Server) CloseConnection(client Connection) {
 	if s.Debug {
 		logMessage := fmt.Sprintf("Closing remote connection for %s.", client.RemoteAddr())
-		Logger().Log(logMessage)
+		s.Logger.Subsystem("network").Log(logMessage, RemoteFields(client))
 	}
 	client.Close()
 }
 
-func (s *Server) SendErrorPacket(client net.Conn, message string) error {
+func (s *Server) SendErrorPacket(client Connection, sequence uint16, message string) error {
 	packet := ErrorPacket{}
 	packet.Type = PacketTypeError
+	packet.Sequence = sequence
 	packet.Message = message
 
-	e := WritePacket(client, packet)
+	e := s.WritePacket(client, packet)
 	return e
 }
 
-func (s *Server) SendVersionResponse(client net.Conn) error {
+func (s *Server) SendVersionResponse(client Connection, sequence uint16) error {
 	packet := VersionPacket{}
 	packet.Type = PacketTypeVersionResponse
+	packet.Sequence = sequence
 	packet.Version = ProtocolVersion
 
-	e := WritePacket(client, packet)
+	e := s.WritePacket(client, packet)
 	return e
 }
 
-func (s *Server) SendCreateLobbyResponse(player *Player, id string) error {
+func (s *Server) SendLoginResponse(player *Player, sequence uint16, session string) error {
+	packet := LoginResponsePacket{}
+	packet.Type = PacketTypeLoginResponse
+	packet.Sequence = sequence
+	packet.Session = session
+
+	e := s.WritePacket(player.Connection(), packet)
+	return e
+}
+
+func (s *Server) SendResumeResponse(client Connection, sequence uint16, session string, success bool) error {
+	packet := ResumeResponsePacket{}
+	packet.Type = PacketTypeResumeResponse
+	packet.Sequence = sequence
+	packet.Session = session
+	packet.Success = success
+
+	e := s.WritePacket(client, packet)
+	return e
+}
+
+func (s *Server) SendStateSnapshot(player *Player, sequence uint16, snapshot StateSnapshotPacket) error {
+	snapshot.Type = PacketTypeStateSnapshot
+	snapshot.Sequence = sequence
+
+	e := s.WritePacket(player.Connection(), snapshot)
+	return e
+}
+
+func (s *Server) SendCreateLobbyResponse(player *Player, sequence uint16, id string) error {
 	packet := CreateLobbyResponsePacket{}
 	packet.Type = PacketTypeCreateLobbyResponse
+	packet.Sequence = sequence
 	packet.ID = id
 
-	e := WritePacket(player.Client, packet)
+	e := s.WritePacket(player.Connection(), packet)
 	return e
 }
 
-func (s *Server) SendPlayerListResponse(player *Player, list PlayerList) error {
+// MaxCardSearchPageSize - The most cards sent back for one card search.
+const MaxCardSearchPageSize = 25
+
+// SendCardSearchResponse - Sends a page of card search results.
+func (s *Server) SendCardSearchResponse(player *Player, sequence uint16, page int, result CardSearchResult) error {
+	packet := CardSearchResponsePacket{}
+	packet.Type = PacketTypeCardSearchResponse
+	packet.Sequence = sequence
+	packet.Total = result.Total
+	packet.Page = page
+	packet.Cards = result.Cards
+
+	return s.WritePacket(player.Connection(), packet)
+}
+
+// SendSelectDeckResponse - Confirms the deck a player selected.
+func (s *Server) SendSelectDeckResponse(player *Player, sequence uint16, deck Deck) error {
+	packet := SelectDeckResponsePacket{}
+	packet.Type = PacketTypeSelectDeckResponse
+	packet.Sequence = sequence
+	packet.DeckID = deck.ID
+	packet.Name = deck.Name
+	packet.Houses = deck.Houses
+	packet.Cards = len(deck.Cards)
+
+	return s.WritePacket(player.Connection(), packet)
+}
+
+func (s *Server) SendPlayerListResponse(player *Player, sequence uint16, list PlayerList) error {
 	packet := PlayerListResponsePacket{}
 	packet.Type = PacketTypePlayerListResponse
+	packet.Sequence = sequence
 	packet.Count = list.Count
 	packet.Players = list.Players
 
-	e := WritePacket(player.Client, packet)
+	e := s.WritePacket(player.Connection(), packet)
 	return e
 }
 
-func (s *Server) SendLobbyListResponse(player *Player, list LobbyList) error {
+func (s *Server) SendLobbyListResponse(player *Player, sequence uint16, list LobbyList) error {
 	packet := LobbyListResponsePacket{}
 	packet.Type = PacketTypeLobbyListResponse
+	packet.Sequence = sequence
 	packet.Count = list.Count
 	packet.Lobbies = list.Lobbies
 
-	e := WritePacket(player.Client, packet)
+	e := s.WritePacket(player.Connection(), packet)
 	return e
 }
 
-func (s *Server) SendGlobalChatResponse(player *Player, name, message string) error {
+func (s *Server) SendGlobalChatResponse(player *Player, sequence uint16, name, message string) error {
 	packet := GlobalChatResponsePacket{}
 	packet.Type = PacketTypeGlobalChatResponse
+	packet.Sequence = sequence
 	packet.Name = name
 	packet.Message = message
 
-	e := WritePacket(player.Client, packet)
+	e := s.WritePacket(player.Connection(), packet)
 	return e
 }
 
-func (s *Server) SendJoinLobbyResponse(player *Player, name, id string, success bool) error {
+func (s *Server) SendJoinLobbyResponse(player *Player, sequence uint16, name, id string, success bool) error {
 	packet := JoinLobbyResponsePacket{}
 	packet.Type = PacketTypeJoinLobbyResponse
+	packet.Sequence = sequence
 	packet.Name = name
 	packet.ID = id
 	packet.Success = success
 
-	e := WritePacket(player.Client, packet)
+	e := s.WritePacket(player.Connection(), packet)
 	return e
 }
 
-func (s *Server) SendLeaveLobbyResponse(player *Player, name, id string, success bool) error {
+func (s *Server) SendLeaveLobbyResponse(player *Player, sequence uint16, name, id string, success bool) error {
 	packet := JoinLobbyResponsePacket{}
 	packet.Type = PacketTypeLeaveLobbyResponse
+	packet.Sequence = sequence
 	packet.Name = name
 	packet.ID = id
 	packet.Success = success
 
-	e := WritePacket(player.Client, packet)
+	e := s.WritePacket(player.Connection(), packet)
 	return e
 }
 
-func (s *Server) SendLobbyKickResponse(player *Player, target string, success bool) error {
+func (s *Server) SendLobbyKickResponse(player *Player, sequence uint16, target string, success bool) error {
 	packet := LobbyKickResponsePacket{}
 	packet.Type = PacketTypeKickLobbyResponse
+	packet.Sequence = sequence
 	packet.Target = target
 	packet.Success = success
 
-	e := WritePacket(player.Client, packet)
+	e := s.WritePacket(player.Connection(), packet)
 	return e
 }
 
-func (s *Server) SendLobbyChatResponse(player *Player, name string, message string) error {
+func (s *Server) SendLobbyChatResponse(player *Player, sequence uint16, name string, message string) error {
 	packet := LobbyChatResponsePacket{}
 	packet.Type = PacketTypeLobbyChatResponse
+	packet.Sequence = sequence
 	packet.Name = name
 	packet.Message = message
 
-	e := WritePacket(player.Client, packet)
+	e := s.WritePacket(player.Connection(), packet)
 	return e
 }
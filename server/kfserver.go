@@ -1,11 +1,80 @@
 package main
 
-import kfnetwork "github.com/team-neutron-shark/keyforge-network"
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	kfnetwork "github.com/team-neutron-shark/keyforge-network"
+)
 
 func main() {
-	s := kfnetwork.NewServer(":8888")
+	config, e := kfnetwork.ParseConfiguration(os.Args[0], os.Args[1:])
+
+	if e == flag.ErrHelp {
+		return
+	}
+
+	if e != nil {
+		fmt.Fprintln(os.Stderr, e.Error())
+		os.Exit(2)
+	}
+
+	loader := func() (kfnetwork.ServerConfiguration, error) {
+		return kfnetwork.ParseConfiguration(os.Args[0], os.Args[1:])
+	}
+
+	s, e := kfnetwork.NewServer(config, kfnetwork.WithConfigLoader(loader))
+
+	if e != nil {
+		fmt.Fprintln(os.Stderr, e.Error())
+		os.Exit(1)
+	}
+
+	if config.WebSocketAddress != "" {
+		e = s.ListenWebSocket(config.WebSocketAddress)
+
+		if e != nil {
+			s.Logger.Error(e.Error())
+		}
+	}
+
+	// SIGHUP reloads the configuration file and card data.
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+
+	go func() {
+		for range hangups {
+			s.Reload()
+		}
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	select {
+	case <-signals:
+	case <-s.Done():
+		return
+	}
+
+	s.Logger.Log("Shutting down, press Ctrl+C again to exit immediately.")
+
+	go func() {
+		<-signals
+		os.Exit(1)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	e = s.Shutdown(ctx)
 
-	for s.Running {
-		kfnetwork.Logger().PrintLogs()
+	if e != nil {
+		fmt.Fprintln(os.Stderr, e.Error())
 	}
 }
@@ -1,124 +1,310 @@
 package kfnetwork
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"net"
 )
 
-func (s *Server) HandlePacket(client net.Conn, packet Packet) {
-	switch packet.GetHeader().Type {
-	case PacketTypeVersionRequest:
-		s.HandleVersionRequest(client, packet.(VersionPacket))
-	case PacketTypeLoginRequest:
-		s.HandleLoginRequest(client, packet.(LoginRequestPacket))
-	case PacketTypeGlobalChatRequest:
-		s.HandleGlobalChatRequest(client, packet.(GlobalChatRequestPacket))
-	case PacketTypePlayerListRequest:
-		s.HandlePlayerListRequest(client, packet.(PlayerListRequestPacket))
-	case PacketTypeCreateLobbyRequest:
-		s.HandleCreateLobbyRequest(client, packet.(CreateLobbyRequestPacket))
-	case PacketTypeLobbyListRequest:
-		s.HandleLobbyListRequest(client, packet.(LobbyListRequestPacket))
-	case PacketTypeJoinLobbyRequest:
-		s.HandleJoinLobbyRequest(client, packet.(JoinLobbyRequestPacket))
-	case PacketTypeLeaveLobbyRequest:
-		s.HandleLeaveLobbyRequest(client, packet.(LeaveLobbyRequestPacket))
-	case PacketTypeKickLobbyRequest:
-		s.HandleLobbyKickRequest(client, packet.(LobbyKickRequestPacket))
-	case PacketTypeLobbyChatRequest:
-		s.HandleLobbyChatRequest(client, packet.(LobbyChatRequestPacket))
+// HandlePacket - Routes a packet through the handler registry. If the
+// handler, or any middleware, fails the error is sent back to the client in
+// an ErrorPacket carrying the request's sequence number so the client can
+// match it to the request that caused it.
+func (s *Server) HandlePacket(client Connection, packet Packet) {
+	e := s.Handlers.Dispatch(client, packet)
+
+	if e != nil {
+		s.SendErrorPacket(client, packet.GetHeader().Sequence, e.Error())
 	}
 }
 
-func (s *Server) HandleVersionRequest(client net.Conn, packet VersionPacket) error {
+func (s *Server) HandleVersionRequest(client Connection, packet VersionPacket) error {
 	if packet.Version != ProtocolVersion {
 		logEntry := fmt.Sprintf("Client %s sent a version packet with a mismatching version.", client.RemoteAddr())
-		Logger().Error(logEntry)
-		s.SendErrorPacket(client, "Protocol version mismatch.")
+		s.Logger.Subsystem("network").Error(logEntry, RemoteFields(client))
+		s.SendErrorPacket(client, packet.Sequence, "Protocol version mismatch.")
 		s.CloseConnection(client)
-		return errors.New("protocol version mismatch")
+		return nil
 	}
 
-	s.SendVersionResponse(client)
-	return nil
+	return s.SendVersionResponse(client, packet.Sequence)
 }
 
-func (s *Server) HandleLoginRequest(client net.Conn, packet LoginRequestPacket) error {
-	vaultUser, e := RetrieveProfile(packet.Token)
+func (s *Server) HandleLoginRequest(client Connection, packet LoginRequestPacket) error {
+	vaultUser, e := s.Vault.RetrieveProfile(s.Context(), packet.Token)
 
 	if e != nil {
-		return e
+		logEntry := fmt.Sprintf("Client %s could not be logged in: %s", client.RemoteAddr(), e.Error())
+		s.Logger.Subsystem("session").Warn(logEntry, RemoteFields(client))
+		return vaultLoginError(e)
 	}
 
 	if vaultUser.ID != packet.ID {
-		s.SendErrorPacket(client, "Login failed.")
+		logEntry := fmt.Sprintf("Client %s supplied an incorrect user ID while logging in.", client.RemoteAddr())
+		s.Logger.Subsystem("session").Error(logEntry, RemoteFields(client))
+		s.SendErrorPacket(client, packet.Sequence, "Login failed.")
 		s.CloseConnection(client)
-		return errors.New("incorrect user ID supplied in packet")
+		return nil
 	}
 
 	player := NewPlayer()
 	player.Name = packet.Name
 	player.ID = packet.ID
 	player.Client = client
+	player.vaultToken = packet.Token
 
-	Players().AddPlayer(player)
-	return nil
+	s.Players.AddPlayer(player)
+	s.Events.Publish(PlayerLoggedInEvent{Player: player})
+
+	session := s.Sessions.CreateSession(player)
+	return s.SendLoginResponse(player, packet.Sequence, session.Token)
+}
+
+// HandleSelectDeckRequest - Sets the deck a player will use in their next
+// game. Decks come from the server's deck store, which fetches them from the
+// Vault when they aren't cached, or falls back to the cached copy when the
+// Vault can't be reached.
+func (s *Server) HandleSelectDeckRequest(client Connection, packet SelectDeckRequestPacket) error {
+	player, e := s.Players.FindPlayerByConnection(client)
+
+	if e != nil {
+		return e
+	}
+
+	player.Lock()
+	inGame := player.Game != nil
+	user := VaultUser{ID: player.ID, Token: player.vaultToken}
+	player.Unlock()
+
+	if inGame {
+		return errors.New("decks cannot be changed during a game")
+	}
+
+	// The Vault may be slow, so it is asked without holding the player.
+	deck, e := s.Decks.Retrieve(s.Context(), s.Vault, &user, packet.DeckID)
+
+	if e != nil {
+		logEntry := fmt.Sprintf("Player %s could not select deck %s: %s", player.Name, packet.DeckID, e.Error())
+		s.Logger.Subsystem("session").Warn(logEntry, PlayerFields(player))
+		return vaultDeckError(e)
+	}
+
+	// Failing to save the cards doesn't stop the player from using them.
+	s.LearnCards(deck.Cards)
+
+	player.Lock()
+
+	if player.Game != nil {
+		player.Unlock()
+		return errors.New("decks cannot be changed during a game")
+	}
+
+	player.SetDeck(deck)
+	player.Unlock()
+
+	logEntry := fmt.Sprintf("Player %s selected deck %s (%s)", player.Name, deck.Name, deck.ID)
+	s.Logger.Subsystem("session").Log(logEntry, PlayerFields(player), Fields{"deck_id": deck.ID})
+
+	return s.SendSelectDeckResponse(player, packet.Sequence, deck)
+}
+
+// HandleCardSearchRequest - Looks cards up in the card database using the
+// search syntax understood by ParseCardQuery.
+func (s *Server) HandleCardSearchRequest(client Connection, packet CardSearchRequestPacket) error {
+	player, e := s.Players.FindPlayerByConnection(client)
+
+	if e != nil {
+		return e
+	}
+
+	query, e := ParseCardQuery(packet.Query)
+
+	if e != nil {
+		return fmt.Errorf("invalid card search: %s", e.Error())
+	}
+
+	page := packet.Page
+	pageSize := packet.PageSize
+
+	if page < 1 {
+		page = 1
+	}
+
+	if pageSize < 1 || pageSize > MaxCardSearchPageSize {
+		pageSize = MaxCardSearchPageSize
+	}
+
+	query.SetPage(page, pageSize)
+	result := s.Cards().Search(query)
+
+	return s.SendCardSearchResponse(player, packet.Sequence, page, result)
+}
+
+// vaultDeckError - Turns a failed deck lookup into the message shown to the
+// player.
+func vaultDeckError(e error) error {
+	switch {
+	case errors.Is(e, ErrNotFound):
+		return errors.New("No such deck in the Vault.")
+	case errors.Is(e, ErrUnauthorized):
+		return errors.New("The Vault rejected your token, please log in again.")
+	case errors.Is(e, ErrRateLimited):
+		return errors.New("The Vault is busy, please try again shortly.")
+	case errors.Is(e, ErrVaultUnavailable), errors.Is(e, context.DeadlineExceeded):
+		return errors.New("The Vault is unavailable and the deck isn't cached.")
+	}
+
+	return errors.New("Unable to select the deck.")
+}
+
+// vaultLoginError - Turns a failed Vault lookup into the message shown to
+// the player, leaving out details only the server log needs.
+func vaultLoginError(e error) error {
+	switch {
+	case errors.Is(e, ErrUnauthorized):
+		return errors.New("Login failed: the Vault rejected your token.")
+	case errors.Is(e, ErrNotFound):
+		return errors.New("Login failed: the Vault has no such user.")
+	case errors.Is(e, ErrRateLimited):
+		return errors.New("Login failed: the Vault is busy, please try again shortly.")
+	case errors.Is(e, ErrVaultUnavailable), errors.Is(e, context.DeadlineExceeded):
+		return errors.New("Login failed: the Vault is unavailable.")
+	}
+
+	return errors.New("Login failed.")
+}
+
+// HandleResumeRequest - Rebinds a player held by a session to the connection
+// presenting the session token, then sends them a snapshot of their state so
+// the client can redraw the lobby and any game in progress.
+func (s *Server) HandleResumeRequest(client Connection, packet ResumeRequestPacket) error {
+	session, e := s.Sessions.FindSessionByToken(packet.Session)
+
+	if e != nil || !session.Resume() {
+		return errors.New("session expired")
+	}
+
+	player := session.Player
+	previous := s.Players.SetConnection(player, client)
+
+	// The player may come back before the server noticed the old connection
+	// died. Close it so its read loop doesn't linger.
+	if previous != nil && previous != client {
+		previous.Close()
+	}
+
+	logEntry := fmt.Sprintf("Player %s resumed their session from %s.", player.Name, client.RemoteAddr())
+	s.Logger.Subsystem("session").Log(logEntry, PlayerFields(player))
+
+	e = s.SendResumeResponse(client, packet.Sequence, session.Token, true)
+
+	if e != nil {
+		return e
+	}
+
+	return s.SendStateSnapshot(player, packet.Sequence, s.BuildStateSnapshot(player))
+}
+
+// BuildStateSnapshot - Collects everything a resuming player needs to know
+// about their lobby and game.
+func (s *Server) BuildStateSnapshot(player *Player) StateSnapshotPacket {
+	snapshot := StateSnapshotPacket{}
+	snapshot.Player = PlayerListEntry{ID: player.ID, Name: player.Name}
+
+	lobby, e := s.Lobbies.FindLobbyByPlayer(player)
+
+	if e == nil {
+		lobbySnapshot := LobbySnapshot{ID: lobby.ID(), Name: lobby.Name()}
+
+		if lobby.Host() != nil {
+			lobbySnapshot.Host = lobby.Host().ID
+		}
+
+		for _, p := range lobby.Players() {
+			entry := PlayerListEntry{ID: p.ID, Name: p.Name}
+			lobbySnapshot.Players = append(lobbySnapshot.Players, entry)
+		}
+
+		snapshot.Lobby = &lobbySnapshot
+	}
+
+	player.Lock()
+	defer player.Unlock()
+
+	if player.Game != nil {
+		game := player.Game
+		gameSnapshot := GameSnapshot{}
+		gameSnapshot.Running = game.Running
+		gameSnapshot.Turn = game.Turn
+		gameSnapshot.Round = game.Round
+		gameSnapshot.Active = player.Active
+		gameSnapshot.Amber = player.Amber
+		gameSnapshot.Keys = player.Keys
+		gameSnapshot.Chains = player.Chains
+		gameSnapshot.Hand = player.HandPile
+		gameSnapshot.Creatures = player.Creatures
+		gameSnapshot.Artifacts = player.Artifacts
+		gameSnapshot.DrawCount = len(player.DrawPile)
+		gameSnapshot.DiscardCount = len(player.DiscardPile)
+		gameSnapshot.ArchiveCount = len(player.ArchivePile)
+
+		snapshot.Game = &gameSnapshot
+	}
+
+	return snapshot
 }
 
-func (s *Server) HandleExitRequest(client net.Conn, packet ExitPacket) error {
-	player, e := Players().FindPlayerByConnection(client)
+func (s *Server) HandleExitRequest(client Connection, packet ExitPacket) error {
+	_, e := s.Players.FindPlayerByConnection(client)
 
 	if e != nil {
 		return e
 	}
 
-	s.CloseConnection(player.Client)
-	Players().RemovePlayer(player)
+	s.DisconnectClient(client)
 	return nil
 }
 
-func (s *Server) HandleCreateLobbyRequest(client net.Conn, packet CreateLobbyRequestPacket) error {
-	player, e := Players().FindPlayerByConnection(client)
+func (s *Server) HandleCreateLobbyRequest(client Connection, packet CreateLobbyRequestPacket) error {
+	player, e := s.Players.FindPlayerByConnection(client)
 
 	if e != nil {
 		if s.Debug {
 			logEntry := fmt.Sprintf("HandleCreateLobbyRequest: %s", e.Error())
-			Logger().Log(logEntry)
+			s.Logger.Subsystem("lobby").Debug(logEntry, RemoteFields(client))
 		}
 
 		return e
 	}
 
-	player.Lock()
-	defer player.Unlock()
+	if s.PlayerHasLobby(player) {
+		return errors.New("player is already in a lobby")
+	}
 
-	lobby := Lobbies().AddLobby(player, packet.Name)
+	lobby := s.Lobbies.AddLobby(player, packet.Name)
+	s.Events.Publish(LobbyCreatedEvent{Lobby: lobby, Host: player})
 
 	logEntry := fmt.Sprintf("Player %s created lobby %s (%s)", player.Name, lobby.name, lobby.ID())
-	Logger().Log(logEntry)
+	s.Logger.Subsystem("lobby").Log(logEntry, PlayerFields(player), Fields{"lobby_id": lobby.ID()})
 
-	e = s.SendCreateLobbyResponse(player, lobby.ID())
+	e = s.SendCreateLobbyResponse(player, packet.Sequence, lobby.ID())
 	return e
 }
 
-func (s *Server) HandlePlayerListRequest(client net.Conn, packet PlayerListRequestPacket) error {
-	player, e := Players().FindPlayerByConnection(client)
+func (s *Server) HandlePlayerListRequest(client Connection, packet PlayerListRequestPacket) error {
+	player, e := s.Players.FindPlayerByConnection(client)
 
 	if e != nil {
 		if s.Debug {
 			logEntry := fmt.Sprintf("HandlePlayerListRequest: %s", e.Error())
-			Logger().Log(logEntry)
+			s.Logger.Subsystem("network").Debug(logEntry, RemoteFields(client))
 		}
 		return e
 	}
 
-	player.Lock()
-	defer player.Unlock()
-
 	playerList := PlayerList{}
 
-	for _, p := range Players().GetPlayers() {
+	for _, p := range s.Players.GetPlayers() {
 		entry := PlayerListEntry{}
 		entry.ID = p.ID
 		entry.Name = p.Name
@@ -128,42 +314,39 @@ func (s *Server) HandlePlayerListRequest(client net.Conn, packet PlayerListReque
 
 	playerList.Count = uint(len(playerList.Players))
 
-	e = s.SendPlayerListResponse(player, playerList)
+	e = s.SendPlayerListResponse(player, packet.Sequence, playerList)
 
 	if e != nil {
 		return e
 	}
 
 	logEntry := fmt.Sprintf("Player %s requested the player list", player.Name)
-	Logger().Log(logEntry)
+	s.Logger.Subsystem("network").Debug(logEntry, PlayerFields(player))
 	return nil
 }
 
-func (s *Server) HandleLobbyChatRequest(client net.Conn, packet LobbyChatRequestPacket) error {
-	player, e := Players().FindPlayerByConnection(client)
+func (s *Server) HandleLobbyChatRequest(client Connection, packet LobbyChatRequestPacket) error {
+	player, e := s.Players.FindPlayerByConnection(client)
 
 	if e != nil {
 		return e
 	}
 
-	lobby, e := Lobbies().FindLobbyByPlayer(player)
+	lobby, e := s.Lobbies.FindLobbyByPlayer(player)
 
 	if e != nil {
 		return e
 	}
 
 	for _, p := range lobby.Players() {
-		p.Lock()
-		defer p.Unlock()
-
-		s.SendLobbyChatResponse(p, player.Name, packet.Message)
+		s.SendLobbyChatResponse(p, ReplySequence(p, player, packet.Sequence), player.Name, packet.Message)
 	}
 
 	return nil
 }
 
-func (s *Server) HandleGlobalChatRequest(client net.Conn, packet GlobalChatRequestPacket) error {
-	player, e := Players().FindPlayerByConnection(client)
+func (s *Server) HandleGlobalChatRequest(client Connection, packet GlobalChatRequestPacket) error {
+	player, e := s.Players.FindPlayerByConnection(client)
 
 	if e != nil {
 		return e
@@ -173,146 +356,140 @@ func (s *Server) HandleGlobalChatRequest(client net.Conn, packet GlobalChatReque
 	playerName := player.Name
 	player.Unlock()
 
-	for _, p := range Players().GetPlayers() {
-		p.Lock()
-		defer p.Unlock()
-		s.SendGlobalChatResponse(p, playerName, packet.Message)
+	for _, p := range s.Players.GetPlayers() {
+		s.SendGlobalChatResponse(p, ReplySequence(p, player, packet.Sequence), playerName, packet.Message)
 	}
 
 	logEntry := fmt.Sprintf("(Global Chat) %s: %s", player.Name, packet.Message)
-	Logger().Log(logEntry)
+	s.Logger.Subsystem("chat").Log(logEntry, PlayerFields(player))
 	return nil
 }
 
-func (s *Server) HandleLobbyListRequest(client net.Conn, packet LobbyListRequestPacket) error {
+func (s *Server) HandleLobbyListRequest(client Connection, packet LobbyListRequestPacket) error {
 	lobbyList := LobbyList{}
 
-	player, e := Players().FindPlayerByConnection(client)
+	player, e := s.Players.FindPlayerByConnection(client)
 
 	if e != nil {
 		return e
 	}
 
-	for _, lobby := range Lobbies().GetLobbies() {
+	for _, lobby := range s.Lobbies.GetLobbies() {
 		entry := LobbyListEntry{ID: lobby.ID(), Name: lobby.Name()}
 		lobbyList.Lobbies = append(lobbyList.Lobbies, entry)
 	}
 
 	lobbyList.Count = uint(len(lobbyList.Lobbies))
 
-	s.SendLobbyListResponse(player, lobbyList)
+	s.SendLobbyListResponse(player, packet.Sequence, lobbyList)
 
 	logEntry := fmt.Sprintf("Player %s requested a lobby list.", player.Name)
-	Logger().Log(logEntry)
+	s.Logger.Subsystem("lobby").Debug(logEntry, PlayerFields(player))
 	return nil
 }
 
-func (s *Server) HandleJoinLobbyRequest(client net.Conn, packet JoinLobbyRequestPacket) error {
-	player, e := Players().FindPlayerByConnection(client)
+func (s *Server) HandleJoinLobbyRequest(client Connection, packet JoinLobbyRequestPacket) error {
+	player, e := s.Players.FindPlayerByConnection(client)
 
 	if e != nil {
 		return e
 	}
 
-	lobby, e := Lobbies().FindLobbyByID(packet.ID)
-
-	if e == nil {
-		lobby.AddPlayer(player)
+	if s.PlayerHasLobby(player) {
+		return errors.New("player is already in a lobby")
+	}
 
-		for _, p := range lobby.Players() {
-			p.Lock()
-			defer p.Unlock()
-			s.SendJoinLobbyResponse(p, lobby.name, lobby.ID(), true)
-		}
+	lobby, e := s.Lobbies.FindLobbyByID(packet.ID)
 
-		return nil
+	if e != nil {
+		lobby, e = s.Lobbies.FindLobbyByName(packet.Name)
 	}
 
-	lobby, e = Lobbies().FindLobbyByName(packet.Name)
-
-	if e == nil {
-		lobby.AddPlayer(player)
+	if e != nil {
+		return errors.New("no such lobby found")
+	}
 
-		for _, p := range lobby.Players() {
-			p.Lock()
-			defer p.Unlock()
-			s.SendJoinLobbyResponse(p, lobby.name, lobby.ID(), true)
-		}
+	if !s.Lobbies.JoinLobby(lobby, player) {
+		return errors.New("lobby is full")
+	}
 
-		return nil
+	for _, p := range lobby.Players() {
+		s.SendJoinLobbyResponse(p, ReplySequence(p, player, packet.Sequence), lobby.name, lobby.ID(), true)
 	}
 
-	return errors.New("no such lobby found")
+	return nil
 }
 
-func (s *Server) HandleLeaveLobbyRequest(client net.Conn, packet LeaveLobbyRequestPacket) error {
-	player, e := Players().FindPlayerByConnection(client)
+func (s *Server) HandleLeaveLobbyRequest(client Connection, packet LeaveLobbyRequestPacket) error {
+	player, e := s.Players.FindPlayerByConnection(client)
 
 	if e != nil {
 		return e
 	}
 
-	if !Players().PlayerHasLobby(player) {
+	if !s.PlayerHasLobby(player) {
 		return errors.New("player is not in a lobby")
 	}
 
-	lobby, e := Lobbies().FindLobbyByID(packet.ID)
-
-	if e == nil {
-		lobby.RemovePlayer(player)
-
-		for _, p := range lobby.Players() {
-			s.SendLeaveLobbyResponse(p, lobby.name, lobby.ID(), true)
-		}
+	lobby, e := s.Lobbies.FindLobbyByID(packet.ID)
 
-		return nil
+	if e != nil {
+		lobby, e = s.Lobbies.FindLobbyByName(packet.Name)
 	}
 
-	lobby, e = Lobbies().FindLobbyByName(packet.Name)
+	if e != nil {
+		return errors.New("no such lobby found")
+	}
 
-	if e == nil {
-		lobby.RemovePlayer(player)
+	command := s.Lobbies.LeaveLobby(lobby, player)
+	s.SendLeaveLobbyResponse(player, packet.Sequence, lobby.name, lobby.ID(), true)
 
-		for _, p := range lobby.Players() {
-			p.Lock()
-			defer p.Unlock()
-			s.SendLeaveLobbyResponse(p, lobby.name, lobby.ID(), true)
-		}
-
-		return nil
+	for _, p := range command.Remaining {
+		s.SendLeaveLobbyResponse(p, 0, lobby.name, lobby.ID(), true)
 	}
 
-	return errors.New("no such lobby found")
+	return nil
 }
 
-func (s *Server) HandleLobbyKickRequest(client net.Conn, packet LobbyKickRequestPacket) error {
-	player, e := Players().FindPlayerByConnection(client)
+func (s *Server) HandleLobbyKickRequest(client Connection, packet LobbyKickRequestPacket) error {
+	player, e := s.Players.FindPlayerByConnection(client)
 
 	if e != nil {
 		return e
 	}
 
-	targetPlayer, e := Players().FindPlayerByID(packet.Target)
+	targetPlayer, e := s.Players.FindPlayerByID(packet.Target)
 
 	if e != nil {
 		return e
 	}
 
-	lobby, e := Lobbies().FindLobbyByPlayer(player)
+	lobby, e := s.Lobbies.FindLobbyByPlayer(player)
 
 	if e != nil {
 		return e
 	}
 
-	if lobby.Host() != player {
-		logEntry := fmt.Sprintf("%s attempted to kick player %s, but they are not the host.", player.Name, targetPlayer.Name)
-		s.Log(logEntry)
-		return errors.New("insufficient privileges; must be lobby host to kick users")
-	}
+	e = s.Lobbies.KickPlayer(lobby, player, targetPlayer)
 
-	lobby.RemovePlayer(targetPlayer)
-	s.SendLobbyKickResponse(player, targetPlayer.ID, true)
-	s.SendLobbyKickResponse(targetPlayer, targetPlayer.ID, true)
+	if e != nil {
+		logEntry := fmt.Sprintf("%s was unable to kick player %s: %s", player.Name, targetPlayer.Name, e.Error())
+		s.Logger.Subsystem("lobby").Warn(logEntry, PlayerFields(player), Fields{"lobby_id": lobby.ID(), "target_id": targetPlayer.ID})
+		return e
+	}
+	s.SendLobbyKickResponse(player, packet.Sequence, targetPlayer.ID, true)
+	s.SendLobbyKickResponse(targetPlayer, 0, targetPlayer.ID, true)
 
 	return nil
 }
+
+// ReplySequence - Picks the sequence number to use when a response is sent
+// to several players at once. Only the player who made the request gets
+// their sequence echoed back; everyone else receives an unsolicited packet.
+func ReplySequence(recipient *Player, requester *Player, sequence uint16) uint16 {
+	if recipient == requester {
+		return sequence
+	}
+
+	return 0
+}
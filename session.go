@@ -0,0 +1,156 @@
+package kfnetwork
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Session - Issued to a player at login. If the player's connection drops
+// the session keeps their player, lobby membership and game seat alive for a
+// grace period, during which a new connection can present the token to
+// pick up where the old one left off.
+type Session struct {
+	Token        string
+	Player       *Player
+	sessionMutex sync.Mutex
+	suspended    bool
+	timer        *time.Timer
+}
+
+// SessionManager - Keeps track of the sessions issued by a server.
+type SessionManager struct {
+	sessionMutex sync.Mutex
+	sessions     map[string]*Session
+}
+
+// NewSessionManager - Returns a pointer to a new session manager.
+func NewSessionManager() *SessionManager {
+	sessionManager := new(SessionManager)
+	sessionManager.sessions = make(map[string]*Session)
+	return sessionManager
+}
+
+// GenerateSessionToken - Returns a random, hex encoded session token. Unlike
+// GenerateUUID this draws from crypto/rand since the token is a credential.
+func GenerateSessionToken() string {
+	buffer := make([]byte, 32)
+	rand.Read(buffer)
+	return hex.EncodeToString(buffer)
+}
+
+// CreateSession - Issues a new session for a player, replacing any session
+// the player already had.
+func (m *SessionManager) CreateSession(player *Player) *Session {
+	existing, e := m.FindSessionByPlayer(player)
+
+	if e == nil {
+		m.RemoveSession(existing)
+	}
+
+	session := new(Session)
+	session.Token = GenerateSessionToken()
+	session.Player = player
+
+	m.sessionMutex.Lock()
+	m.sessions[session.Token] = session
+	m.sessionMutex.Unlock()
+
+	return session
+}
+
+// RemoveSession - Removes a session and cancels its expiry timer.
+func (m *SessionManager) RemoveSession(session *Session) {
+	session.sessionMutex.Lock()
+	if session.timer != nil {
+		session.timer.Stop()
+	}
+	session.sessionMutex.Unlock()
+
+	m.sessionMutex.Lock()
+	delete(m.sessions, session.Token)
+	m.sessionMutex.Unlock()
+}
+
+// FindSessionByToken - Locate a session given its token.
+func (m *SessionManager) FindSessionByToken(token string) (*Session, error) {
+	m.sessionMutex.Lock()
+	defer m.sessionMutex.Unlock()
+
+	session, ok := m.sessions[token]
+
+	if !ok {
+		return &Session{}, errors.New("no session found with the given token")
+	}
+
+	return session, nil
+}
+
+// FindSessionByPlayer - Locate the session belonging to a player.
+func (m *SessionManager) FindSessionByPlayer(player *Player) (*Session, error) {
+	m.sessionMutex.Lock()
+	defer m.sessionMutex.Unlock()
+
+	for _, session := range m.sessions {
+		if session.Player == player {
+			return session, nil
+		}
+	}
+
+	return &Session{}, errors.New("no session found for the given player")
+}
+
+// Suspend - Marks the session as disconnected. If the session isn't resumed
+// before the grace period runs out the expire function is called.
+func (s *Session) Suspend(grace time.Duration, expire func()) {
+	s.sessionMutex.Lock()
+	defer s.sessionMutex.Unlock()
+
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+
+	s.suspended = true
+	s.timer = time.AfterFunc(grace, expire)
+}
+
+// Resume - Cancels a pending expiry. Returns false if the session has
+// already expired.
+func (s *Session) Resume() bool {
+	s.sessionMutex.Lock()
+	defer s.sessionMutex.Unlock()
+
+	if s.timer != nil && !s.timer.Stop() {
+		return false
+	}
+
+	s.suspended = false
+	s.timer = nil
+	return true
+}
+
+// Suspended - Determine whether the session is waiting to be resumed.
+func (s *Session) Suspended() bool {
+	s.sessionMutex.Lock()
+	defer s.sessionMutex.Unlock()
+
+	return s.suspended
+}
+
+// RemoveAll - Removes every session and cancels their expiry timers.
+func (m *SessionManager) RemoveAll() {
+	m.sessionMutex.Lock()
+	sessions := m.sessions
+	m.sessions = make(map[string]*Session)
+	m.sessionMutex.Unlock()
+
+	for _, session := range sessions {
+		session.sessionMutex.Lock()
+		if session.timer != nil {
+			session.timer.Stop()
+		}
+		session.sessionMutex.Unlock()
+	}
+}
@@ -0,0 +1,298 @@
+package kfnetwork
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// ShutdownMessage - Sent to every connected client when the server begins
+// shutting down.
+const ShutdownMessage = "The server is shutting down."
+
+// Shutdown - Stops the server gracefully. The listeners are closed so no new
+// connections are accepted, every connected client is told the server is
+// going away, and running games are given until the game drain timeout to
+// finish before they are saved to disk. Connections keep being read while
+// games drain, so players can still finish them. Connections are then
+// closed, their queued packets flushed, and Shutdown waits for every
+// goroutine the server started to exit. If the context ends first its
+// error is returned and whatever is still running is abandoned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.ClientMutex.Lock()
+
+	if s.shuttingDown {
+		s.ClientMutex.Unlock()
+		return s.waitForDone(ctx)
+	}
+
+	s.shuttingDown = true
+	s.ClientMutex.Unlock()
+
+	atomic.StoreInt32(&s.running, 0)
+	s.cancel()
+	s.closeListeners()
+
+	connections := s.trackedConnections()
+
+	for _, client := range connections {
+		s.SendServerShutdown(client, ShutdownMessage)
+	}
+
+	s.drainGames(ctx)
+	s.saveGames()
+
+	// Each read loop finishes the packet it is handling before it stops,
+	// so replies to the last requests aren't cut off.
+	connections = s.expireReads()
+	s.waitForReadLoops(ctx)
+
+	for _, client := range connections {
+		player, e := s.Players.FindPlayerByConnection(client)
+
+		if e == nil {
+			s.RemovePlayer(player)
+		}
+
+		client.Close()
+	}
+
+	for _, client := range connections {
+		if queued, ok := client.(*QueuedConnection); ok {
+			select {
+			case <-queued.Done():
+			case <-ctx.Done():
+			}
+		}
+	}
+
+	s.Sessions.RemoveAll()
+
+	// Injected event managers may be shared with other servers, so only
+	// close one we created.
+	if s.ownEvents {
+		s.Events.Close()
+	}
+
+	finished := make(chan struct{})
+
+	go func() {
+		s.waitGroup.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		close(s.done)
+		return ctx.Err()
+	}
+
+	if s.Debug {
+		s.Logger.Subsystem("server").Log("Server shut down.")
+	}
+
+	// Like the event manager, an injected logger or audit log may still be
+	// in use elsewhere.
+	if s.ownAudit {
+		s.Audit.Close()
+	}
+
+	if s.ownLogger {
+		s.Logger.Close()
+	}
+
+	close(s.done)
+	return nil
+}
+
+// Stop - Shuts the server down, giving it a few seconds to do so cleanly.
+func (s *Server) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	e := s.Shutdown(ctx)
+
+	if e != nil {
+		logEntry := fmt.Sprintf("Shutdown: %s", e.Error())
+		s.Logger.Subsystem("server").Error(logEntry)
+	}
+}
+
+// Done - Returns a channel which is closed once the server has shut down.
+func (s *Server) Done() <-chan struct{} {
+	return s.done
+}
+
+// RunningGames - Returns every running game in the server's lobbies,
+// including games whose players are disconnected but still within their
+// session's grace period.
+func (s *Server) RunningGames() []*Game {
+	games := []*Game{}
+
+	for _, lobby := range s.Lobbies.GetLobbies() {
+		command := &runningGameCommand{}
+
+		if lobby.Execute(command) == nil && command.Game != nil {
+			games = append(games, command.Game)
+		}
+	}
+
+	return games
+}
+
+// runningGameCommand - Reads the lobby's game, if it is running, on the
+// lobby's goroutine.
+type runningGameCommand struct {
+	Game *Game
+}
+
+func (c *runningGameCommand) Execute(lobby *Lobby) {
+	if game := lobby.Game(); game != nil && game.Running {
+		c.Game = game
+	}
+}
+
+// saveGameCommand - Saves the lobby's game, if it is running, on the
+// lobby's goroutine so it can't change while it is written out.
+type saveGameCommand struct {
+	Directory string
+	Game      *Game
+	Filename  string
+	Err       error
+}
+
+func (c *saveGameCommand) Execute(lobby *Lobby) {
+	game := lobby.Game()
+
+	if game == nil || !game.Running {
+		return
+	}
+
+	c.Game = game
+	c.Filename, c.Err = game.Save(c.Directory)
+}
+
+func (s *Server) SendServerShutdown(client Connection, message string) error {
+	packet := ServerShutdownPacket{}
+	packet.Type = PacketTypeServerShutdown
+	packet.Message = message
+
+	e := s.WritePacket(client, packet)
+	return e
+}
+
+func (s *Server) closeListeners() {
+	s.ListenerMutex.Lock()
+	defer s.ListenerMutex.Unlock()
+
+	s.closed = true
+
+	if s.Listener != nil {
+		s.Listener.Close()
+	}
+
+	if s.WebServer != nil {
+		s.WebServer.Close()
+	}
+}
+
+func (s *Server) trackedConnections() []Connection {
+	s.ClientMutex.Lock()
+	defer s.ClientMutex.Unlock()
+
+	connections := []Connection{}
+
+	for client := range s.connections {
+		connections = append(connections, client)
+	}
+
+	return connections
+}
+
+// expireReads - Stops the read loops by expiring every connection's read
+// deadline, returning the connections.
+func (s *Server) expireReads() []Connection {
+	s.ClientMutex.Lock()
+	defer s.ClientMutex.Unlock()
+
+	atomic.StoreInt32(&s.closing, 1)
+	connections := []Connection{}
+
+	for client := range s.connections {
+		client.SetReadDeadline(time.Now())
+		connections = append(connections, client)
+	}
+
+	return connections
+}
+
+// waitForReadLoops - Waits for every read loop to return, or until the
+// context ends.
+func (s *Server) waitForReadLoops(ctx context.Context) {
+	finished := make(chan struct{})
+
+	go func() {
+		s.readLoops.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+	case <-ctx.Done():
+	}
+}
+
+// drainGames - Waits for running games to finish, up to the game drain
+// timeout or until the context ends.
+func (s *Server) drainGames(ctx context.Context) {
+	timer := time.NewTimer(time.Duration(s.Configuration().GameDrainTimeout))
+	defer timer.Stop()
+
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for len(s.RunningGames()) > 0 {
+		select {
+		case <-ticker.C:
+		case <-timer.C:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *Server) saveGames() {
+	for _, lobby := range s.Lobbies.GetLobbies() {
+		command := &saveGameCommand{Directory: s.Configuration().GameSaveDirectory}
+		e := lobby.Execute(command)
+
+		if e == nil {
+			e = command.Err
+		}
+
+		if command.Game == nil {
+			continue
+		}
+
+		if e != nil {
+			logEntry := fmt.Sprintf("Unable to save game %s: %s", command.Game.ID, e.Error())
+			s.Logger.Subsystem("server").Error(logEntry, Fields{"game_id": command.Game.ID})
+			continue
+		}
+
+		logEntry := fmt.Sprintf("Saved game %s to %s.", command.Game.ID, command.Filename)
+		s.Logger.Subsystem("server").Log(logEntry, Fields{"game_id": command.Game.ID})
+	}
+}
+
+func (s *Server) waitForDone(ctx context.Context) error {
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
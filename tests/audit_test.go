@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	kf "github.com/team-neutron-shark/keyforge-network"
+)
+
+func TestRedactPacket(t *testing.T) {
+	packet := kf.LoginRequestPacket{}
+	packet.Type = kf.PacketTypeLoginRequest
+	packet.Name = "Alice"
+	packet.Token = "secret"
+
+	payload, e := kf.RedactPacket(packet)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	if payload["token"] != kf.RedactedValue {
+		t.Error("token was not redacted")
+	}
+
+	if payload["name"] != "Alice" {
+		t.Error("name should not be redacted")
+	}
+}
+
+func TestAuditLogPerPlayer(t *testing.T) {
+	sink := &memorySink{}
+	audit := kf.NewAuditLog(kf.NewLogManager(sink))
+	defer audit.Close()
+
+	server := newServer(t, ":0", kf.WithAuditLog(audit))
+	defer server.Stop()
+	server.Config.PingInterval = 0
+
+	client, connection := connectClient(server)
+	defer client.Close()
+
+	_, e := client.Version(context.Background())
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	player := kf.NewPlayer()
+	player.ID = "p1"
+	player.Name = "Alice"
+	player.Client = connection
+	server.AddPlayer(player)
+
+	audit.EnablePlayer("p1")
+
+	_, e = client.Version(context.Background())
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	audit.Flush()
+	entries := sink.Entries()
+
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 audit entries, found %d", len(entries))
+	}
+
+	if entries[0].Fields["direction"] != "in" || entries[1].Fields["direction"] != "out" {
+		t.Error("audit entries should record both directions")
+	}
+
+	if entries[0].Fields["player_id"] != "p1" {
+		t.Error("audit entry is missing the player ID")
+	}
+}
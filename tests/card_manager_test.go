@@ -0,0 +1,280 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	kf "github.com/team-neutron-shark/keyforge-network"
+)
+
+func TestCardManagerLoadFromFile(t *testing.T) {
+	cards := kf.NewCardManager()
+	e := cards.LoadFromFile("../data/cards.json")
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	if cards.Count() == 0 {
+		t.Fatal("no cards were loaded")
+	}
+
+	query := kf.NewCardQuery()
+	query.SetExpansion(341)
+	query.SetNumber(1)
+
+	card, e := cards.QueryCard(query)
+
+	if e != nil || card.CardTitle != "Anger" {
+		t.Errorf("expected to find Anger, got %+v (%v)", card, e)
+	}
+}
+
+func TestCardManagerMerge(t *testing.T) {
+	deck, e := kf.LoadDeckFromFile("test_data/test_deck.json")
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	cards := kf.NewCardManager()
+	added := cards.Merge(deck.Cards)
+
+	if added == 0 || added != cards.Count() {
+		t.Fatalf("expected every distinct card to be added, added %d of %d", added, cards.Count())
+	}
+
+	if cards.Merge(deck.Cards) != 0 {
+		t.Error("known cards were added again")
+	}
+
+	maverick := deck.Cards[0]
+	maverick.ID = "maverick-" + maverick.ID
+	maverick.IsMaverick = true
+
+	if cards.Merge([]kf.Card{maverick}) != 1 {
+		t.Error("maverick was not learned")
+	}
+
+	path := filepath.Join(t.TempDir(), "cards.json")
+	e = cards.WriteToFile(path)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	loaded := kf.NewCardManager()
+	e = loaded.LoadFromFile(path)
+
+	if e != nil || loaded.Count() != cards.Count() {
+		t.Errorf("saved cards did not round trip: %d of %d (%v)", loaded.Count(), cards.Count(), e)
+	}
+}
+
+func TestServerLearnsDeckCards(t *testing.T) {
+	vault := newFakeVault(t)
+	defer vault.Close()
+
+	config := kf.DefaultServerConfiguration()
+	config.Address = ":0"
+	config.DeckStoreDirectory = t.TempDir()
+	config.CardDataPath = filepath.Join(t.TempDir(), "cards.json")
+
+	server := newServerWithConfig(t, config, kf.WithVaultClient(vault.Client()))
+	defer server.Stop()
+
+	client, _ := connectClient(server)
+	defer client.Close()
+
+	_, e := client.Login(context.Background(), "archon", "user-1", "token-1")
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	_, e = client.SelectDeck(context.Background(), "deck-3")
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	if server.Cards().Count() != 2 {
+		t.Errorf("expected the deck's two cards to be learned, have %d", server.Cards().Count())
+	}
+
+	saved := kf.NewCardManager()
+	e = saved.LoadFromFile(config.CardDataPath)
+
+	if e != nil || saved.Count() != 2 {
+		t.Errorf("learned cards were not saved: %d (%v)", saved.Count(), e)
+	}
+}
+
+func loadCardDatabase(t *testing.T) *kf.CardManager {
+	cards := kf.NewCardManager()
+	e := cards.LoadFromFile("../data/cards.json")
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	return cards
+}
+
+func TestCardManagerSearch(t *testing.T) {
+	cards := loadCardDatabase(t)
+
+	query := kf.NewCardQuery()
+	query.SetHouses("Brobnar")
+	query.SetTypes("creature")
+	query.SetPowerRange(5, 10)
+	query.SetSort(kf.CardSortPower, true)
+	query.SetPage(1, 3)
+
+	result := cards.Search(query)
+
+	if result.Total < 3 || len(result.Cards) != 3 {
+		t.Fatalf("expected a full page, got %d of %d", len(result.Cards), result.Total)
+	}
+
+	for i, card := range result.Cards {
+		if card.House != "Brobnar" || card.CardType != "Creature" || card.Power < 5 || card.Power > 10 {
+			t.Errorf("%s does not match the query", card.CardTitle)
+		}
+
+		if i > 0 && card.Power > result.Cards[i-1].Power {
+			t.Error("cards are not sorted by power")
+		}
+	}
+
+	query = kf.NewCardQuery()
+	query.SetTraits("giant", "knight")
+
+	for _, card := range cards.Find(query) {
+		if card.Traits != "Giant • Knight" {
+			t.Errorf("%s does not have both traits", card.CardTitle)
+		}
+	}
+
+	query = kf.NewCardQuery()
+	query.SetText("ready and fight")
+	found := false
+
+	for _, card := range cards.Find(query) {
+		found = found || card.CardTitle == "Anger"
+	}
+
+	if !found {
+		t.Error("text search did not find Anger")
+	}
+}
+
+func TestCardManagerSearchMatchesScan(t *testing.T) {
+	cards := loadCardDatabase(t)
+	all := cards.Cards()
+
+	queries := []func(q *kf.CardQuery){
+		func(q *kf.CardQuery) { q.SetHouses("Dis", "Mars") },
+		func(q *kf.CardQuery) { q.SetRarities("rare"); q.SetAmberRange(1, 2) },
+		func(q *kf.CardQuery) { q.SetText("steal"); q.SetSort(kf.CardSortTitle, false) },
+		func(q *kf.CardQuery) { q.SetTraits("Scientist"); q.SetArmorRange(0, 0) },
+		func(q *kf.CardQuery) { q.SetExpansion(341); q.SetNumber(2) },
+		func(q *kf.CardQuery) { q.SetTitle("troll") },
+	}
+
+	for i, setup := range queries {
+		query := kf.NewCardQuery()
+		setup(query)
+
+		indexed := cards.Search(query)
+		scanned, total := query.Filter(all)
+
+		if indexed.Total != total || indexed.Total == 0 {
+			t.Errorf("query %d: index found %d cards, scan found %d", i, indexed.Total, total)
+			continue
+		}
+
+		for j := range scanned {
+			if indexed.Cards[j].ID != scanned[j].ID {
+				t.Errorf("query %d: results differ at %d", i, j)
+				break
+			}
+		}
+	}
+
+	// Paging through every result gives the same cards as one big page.
+	query := kf.NewCardQuery()
+	query.SetHouses("Logos")
+	everything := cards.Find(query)
+	paged := []kf.Card{}
+
+	for page := 1; len(paged) < len(everything); page++ {
+		query.SetPage(page, 7)
+		cards := cards.Find(query)
+
+		if len(cards) == 0 {
+			break
+		}
+
+		paged = append(paged, cards...)
+	}
+
+	if len(paged) != len(everything) {
+		t.Errorf("paging returned %d of %d cards", len(paged), len(everything))
+	}
+}
+
+func TestLearnCardsKeepsExtraCardDataSeparate(t *testing.T) {
+	directory := t.TempDir()
+	extra := []kf.Card{{ID: "extra-1", CardTitle: "Extra", House: "Dis", CardType: "Action", Expansion: 435, CardNumber: 900}}
+	data, _ := json.Marshal(extra)
+	e := ioutil.WriteFile(filepath.Join(directory, "extra.json"), data, 0644)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	config := kf.DefaultServerConfiguration()
+	config.Address = ":0"
+	config.DeckStoreDirectory = t.TempDir()
+	config.CardDataPath = filepath.Join(t.TempDir(), "cards.json")
+	config.ExtraCardData = []string{directory}
+
+	e = ioutil.WriteFile(config.CardDataPath, []byte("[]"), 0644)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	server := newServerWithConfig(t, config)
+	defer server.Stop()
+
+	learned := []kf.Card{{ID: "learned-1", CardTitle: "Learned", House: "Dis", CardType: "Action", Expansion: 435, CardNumber: 901}}
+	added, e := server.LearnCards(learned)
+
+	if e != nil || added != 1 {
+		t.Fatalf("expected one card to be learned, added %d (%v)", added, e)
+	}
+
+	e = server.Reload()
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	report := server.Cards().Validate()
+
+	if server.Cards().Count() != 2 || !report.OK() {
+		t.Errorf("expected both cards without problems, have %d: %v", server.Cards().Count(), report.Counts())
+	}
+
+	saved := kf.NewCardManager()
+	e = saved.LoadFromFile(config.CardDataPath)
+
+	if e != nil || saved.Count() != 1 || saved.Cards()[0].ID != "learned-1" {
+		t.Errorf("expected only the learned card to be saved, got %+v (%v)", saved.Cards(), e)
+	}
+}
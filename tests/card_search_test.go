@@ -0,0 +1,109 @@
+package tests
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	kf "github.com/team-neutron-shark/keyforge-network"
+)
+
+func TestParseCardQuery(t *testing.T) {
+	cards := []kf.Card{
+		{ID: "1", CardTitle: "Mighty Tiger", House: "Untamed", CardType: "Creature", Power: 4, CardText: "Play: Deal 4 damage to an enemy flank creature.", CardNumber: 1},
+		{ID: "2", CardTitle: "Shooler", House: "Dis", CardType: "Creature", Power: 5, CardText: "Play: If your opponent has 4 or more amber, steal 1 amber.", CardNumber: 2},
+		{ID: "3", CardTitle: "Charette", House: "Dis", CardType: "Creature", Power: 4, Traits: "Demon", CardText: "Play: Capture 3 amber.", CardNumber: 3},
+		{ID: "4", CardTitle: "Hand of Dis", House: "Dis", CardType: "Action", Amber: 1, CardText: "Destroy a creature that is not on a flank.", CardNumber: 4},
+	}
+
+	searches := []struct {
+		search   string
+		expected []string
+	}{
+		{`house:dis type:creature power>=4 text:"capture"`, []string{"3"}},
+		{`house:dis,untamed type:creature power<5 sort:-number`, []string{"3", "1"}},
+		{`mighty tiger`, []string{"1"}},
+		{`title:"hand of" amber:1`, []string{"4"}},
+		{`trait:demon`, []string{"3"}},
+		{`power>4 power<=5`, []string{"2"}},
+		{`type:creature sort:power`, []string{"1", "3", "2"}},
+	}
+
+	for _, search := range searches {
+		query, e := kf.ParseCardQuery(search.search)
+
+		if e != nil {
+			t.Errorf("%s: %s", search.search, e.Error())
+			continue
+		}
+
+		matches, _ := query.Filter(cards)
+		ids := []string{}
+
+		for _, card := range matches {
+			ids = append(ids, card.ID)
+		}
+
+		if strings.Join(ids, ",") != strings.Join(search.expected, ",") {
+			t.Errorf("%s: expected %v, got %v", search.search, search.expected, ids)
+		}
+	}
+
+	query, e := kf.ParseCardQuery(`set:cota number:1`)
+
+	if e != nil || query.Expansion() != 341 || query.Number() != 1 {
+		t.Errorf("expected set:cota to search Call of the Archons, got %v", e)
+	}
+
+	invalid := []string{`set:nope`, `house:dis house:mars`, `set:cota expansion:435`, `sort:title sort:power`, `colour:red`, `power>=lots`, `house>dis`, `text:"capture`, `sort:flavor`, `house:`}
+
+	for _, search := range invalid {
+		if _, e := kf.ParseCardQuery(search); e == nil {
+			t.Errorf("expected %q to be rejected", search)
+		}
+	}
+}
+
+func TestServerCardSearch(t *testing.T) {
+	vault := newFakeVault(t)
+	defer vault.Close()
+
+	config := kf.DefaultServerConfiguration()
+	config.Address = ":0"
+	config.DeckStoreDirectory = t.TempDir()
+	config.CardDataPath = "../data/cards.json"
+
+	server := newServerWithConfig(t, config, kf.WithVaultClient(vault.Client()))
+	defer server.Stop()
+
+	client, _ := connectClient(server)
+	defer client.Close()
+
+	_, e := client.Login(context.Background(), "archon", "user-1", "token-1")
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	response, e := client.SearchCards(context.Background(), `house:brobnar type:creature power>=5`, 1, 5)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	if len(response.Cards) != 5 || response.Total <= 5 {
+		t.Errorf("expected a full page of many results, got %d of %d", len(response.Cards), response.Total)
+	}
+
+	for _, card := range response.Cards {
+		if card.House != "Brobnar" || card.Power < 5 {
+			t.Errorf("%s does not match the search", card.CardTitle)
+		}
+	}
+
+	_, e = client.SearchCards(context.Background(), `colour:red`, 1, 5)
+
+	if e == nil || !strings.Contains(e.Error(), "unknown filter") {
+		t.Errorf("expected an invalid search to be reported, got %v", e)
+	}
+}
@@ -20,6 +20,29 @@ func TestCardGetActionCards(t *testing.T) {
 	}
 }
 
+func TestCardHelpersKeepPileOrder(t *testing.T) {
+	deck, e := kf.LoadDeckFromFile("test_data/test_deck.json")
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	pile := kf.Shuffle(deck.Cards)
+	expected := []kf.Card{}
+
+	for _, card := range pile {
+		if card.CardType == "Creature" {
+			expected = append(expected, card)
+		}
+	}
+
+	creatures := kf.GetCreatureCards(pile)
+
+	if len(creatures) != len(expected) || !kf.CompareCardOrder(expected, creatures) {
+		t.Error("creatures were not returned in pile order")
+	}
+}
+
 func TestCardGetArtifactCards(t *testing.T) {
 	deck, e := kf.LoadDeckFromFile("test_data/test_deck.json")
 
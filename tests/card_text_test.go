@@ -0,0 +1,148 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	kf "github.com/team-neutron-shark/keyforge-network"
+)
+
+func TestParseCardText(t *testing.T) {
+	text := kf.ParseCardText("Elusive. (The first time this creature is attacked each turn, no damage is dealt.)\vPlay: Capture 1<A>.\vFight/Reap: Deal 4<D> to a creature with 2<D> splash. Gain 1<A>.")
+
+	if len(text.Sections) != 3 || !text.HasKeyword("elusive") {
+		t.Fatalf("unexpected sections: %+v", text.Sections)
+	}
+
+	play := text.Triggered(kf.TriggerPlay)
+
+	if len(play) != 1 || play[0].Tokens[0].Kind != kf.CardTextCapture || play[0].Tokens[0].Amount != 1 {
+		t.Errorf("expected a capture on play, got %+v", play)
+	}
+
+	reap := text.Triggered(kf.TriggerReap)
+
+	if len(reap) != 1 || !reap[0].HasTrigger(kf.TriggerFight) {
+		t.Fatalf("expected a fight/reap section, got %+v", reap)
+	}
+
+	kinds := []kf.CardTextTokenKind{}
+
+	for _, token := range reap[0].Tokens {
+		if token.Kind != kf.CardTextPlain {
+			kinds = append(kinds, token.Kind)
+		}
+	}
+
+	if len(kinds) != 3 || kinds[0] != kf.CardTextDamage || kinds[1] != kf.CardTextDamage || kinds[2] != kf.CardTextAmber {
+		t.Errorf("unexpected symbols: %v", kinds)
+	}
+
+	expected := "Elusive. (The first time this creature is attacked each turn, no damage is dealt.)\n" +
+		"Play: Capture 1 amber.\n" +
+		"Fight/Reap: Deal 4 damage to a creature with 2 damage splash. Gain 1 amber."
+
+	if rendered := text.Render(kf.PlainCardText); rendered != expected {
+		t.Errorf("unexpected plain text:\n%s", rendered)
+	}
+
+	// Abilities a card grants others aren't its own triggers.
+	granted := kf.ParseCardText("This creature gains, “Reap: Gain 1<A>.”")
+
+	if len(granted.Sections) != 1 || len(granted.Sections[0].Triggers) != 0 {
+		t.Errorf("expected a constant ability, got %+v", granted.Sections)
+	}
+
+	hazardous := kf.ParseCardText("Hazardous 5. (Before this creature is attacked, deal 5<D> to the attacking enemy.)")
+
+	if len(hazardous.Sections) != 1 || hazardous.Sections[0].Keyword != "Hazardous" || hazardous.Sections[0].KeywordValue != 5 {
+		t.Errorf("expected hazardous 5, got %+v", hazardous.Sections)
+	}
+}
+
+func TestCardDatabaseText(t *testing.T) {
+	cards := kf.NewCardManager()
+	e := cards.LoadFromFile("../data/cards.json")
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	for _, card := range cards.Cards() {
+		if card.Text() != card.Text() {
+			t.Fatalf("%s: parsed text was not cached", card.CardTitle)
+		}
+
+		plain := card.PlainText()
+
+		if strings.ContainsAny(plain, "<>") {
+			t.Errorf("%s: symbols left in %q", card.CardTitle, plain)
+		}
+
+		if card.CardText != "" && len(card.Text().Sections) == 0 {
+			t.Errorf("%s: no sections parsed from %q", card.CardTitle, card.CardText)
+		}
+	}
+}
+
+func TestStartGameCachesDeckText(t *testing.T) {
+	config := kf.DefaultServerConfiguration()
+	config.Address = ":0"
+	config.DeckStoreDirectory = t.TempDir()
+	config.GameSaveDirectory = t.TempDir()
+	config.GameDrainTimeout = kf.Duration(50 * time.Millisecond)
+	config.CardDataPath = "../data/cards.json"
+
+	server := newServerWithConfig(t, config)
+	defer server.Stop()
+
+	deck, e := kf.LoadDeckFromFile("test_data/test_deck.json")
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	host := kf.NewPlayer()
+	host.SetDeck(deck)
+	guest := kf.NewPlayer()
+	guest.SetDeck(deck)
+
+	lobby := server.AddLobby(host, "cached text")
+	defer server.Lobbies.RemoveLobby(lobby)
+	server.Lobbies.JoinLobby(lobby, guest)
+
+	_, e = server.StartGame(lobby)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	host.Lock()
+	defer host.Unlock()
+
+	shared := 0
+
+	for _, card := range host.PlayerDeck.Cards {
+		if card.Text() != card.Text() {
+			t.Fatalf("%s: deck card text was not cached", card.CardTitle)
+		}
+
+		query := kf.NewCardQuery()
+		query.SetID(card.ID)
+
+		if known := server.Cards().Find(query); len(known) == 1 && known[0].Text() == card.Text() {
+			shared++
+		}
+	}
+
+	if shared == 0 {
+		t.Error("no deck card shares its parsed text with the card database")
+	}
+
+	for _, card := range append(host.HandPile, host.DrawPile...) {
+		if card.Text() != card.Text() {
+			t.Fatalf("%s: text was not cached in the hand or draw pile", card.CardTitle)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	kf "github.com/team-neutron-shark/keyforge-network"
+)
+
+func TestCardDataIsValid(t *testing.T) {
+	cards := kf.NewCardManager()
+	e := cards.LoadFromFile("../data/cards.json")
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	report := cards.Validate()
+
+	if report.Cards != cards.Count() {
+		t.Errorf("expected %d cards to be checked, got %d", cards.Count(), report.Cards)
+	}
+
+	for _, issue := range report.Issues {
+		t.Errorf("%s %s (%s): %s", issue.Kind, issue.CardTitle, issue.CardID, issue.Message)
+	}
+}
+
+func TestValidateCards(t *testing.T) {
+	cards := []kf.Card{
+		{ID: "1", CardTitle: "Anger", House: "Brobnar", CardType: "Action", CardText: "Play: Gain 1<A>.", Expansion: 341, CardNumber: 1},
+		{ID: "1", CardTitle: "Anger", House: "Brobnar", CardType: "Action", Expansion: 341, CardNumber: 1},
+		{ID: "2", CardTitle: "Not Anger", House: "Brobnar", CardType: "Action", Expansion: 341, CardNumber: 1},
+		{ID: "3", CardTitle: "Stowaway", House: "Star Alliance", CardType: "Action", Expansion: 341, CardNumber: 3},
+		{ID: "4", CardTitle: "Gadget", House: "Logos", CardType: "Gizmo", Expansion: 341, CardNumber: 4},
+		{ID: "5", CardTitle: "Weakling", House: "Dis", CardType: "Creature", Expansion: 341, CardNumber: 5},
+		{ID: "6", CardTitle: "Typo", House: "Mars", CardType: "Action", CardText: "Play: Gain 2<A.", Expansion: 341, CardNumber: 6},
+		{ID: "7", CardTitle: "Odd Symbol", House: "Mars", CardType: "Action", CardText: "Play: Deal 2<X> damage.", Expansion: 341, CardNumber: 7},
+		{ID: "8", CardTitle: "New Set", House: "Saurian", CardType: "Creature", Power: 3, Expansion: 999, CardNumber: 8},
+	}
+
+	report := kf.ValidateCards(cards)
+	counts := report.Counts()
+	expected := map[kf.CardIssueKind]int{
+		kf.CardIssueDuplicateID:       1,
+		kf.CardIssueConflictingNumber: 1,
+		kf.CardIssueUnknownHouse:      1,
+		kf.CardIssueUnknownType:       1,
+		kf.CardIssueMissingPower:      1,
+		kf.CardIssueMalformedMarkup:   2,
+	}
+
+	for kind, count := range expected {
+		if counts[kind] != count {
+			t.Errorf("expected %d %s issues, got %d", count, kind, counts[kind])
+		}
+	}
+
+	if len(report.Issues) != 7 || report.Cards != 8 || report.Err() == nil {
+		t.Errorf("unexpected report: %+v", report)
+	}
+}
+
+func TestServerWritesCardReport(t *testing.T) {
+	directory := t.TempDir()
+	duplicate := []kf.Card{{ID: "dupe", CardTitle: "Dupe", House: "Dis", CardType: "Action", Expansion: 341, CardNumber: 999}}
+	data, _ := json.Marshal(duplicate)
+
+	for _, name := range []string{"a.json", "b.json"} {
+		e := ioutil.WriteFile(filepath.Join(directory, name), data, 0644)
+
+		if e != nil {
+			t.Fatal(e.Error())
+		}
+	}
+
+	config := kf.DefaultServerConfiguration()
+	config.Address = ":0"
+	config.DeckStoreDirectory = t.TempDir()
+	config.CardDataPath = "../data/cards.json"
+	config.ExtraCardData = []string{directory}
+	config.CardReportPath = filepath.Join(t.TempDir(), "report.json")
+
+	server := newServerWithConfig(t, config)
+	defer server.Stop()
+
+	data, e := ioutil.ReadFile(config.CardReportPath)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	report := kf.CardReport{}
+	e = json.Unmarshal(data, &report)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	if len(report.Issues) != 1 || report.Issues[0].Kind != kf.CardIssueDuplicateID || report.Issues[0].CardID != "dupe" {
+		t.Errorf("expected the duplicate card to be reported, got %+v", report.Issues)
+	}
+}
@@ -0,0 +1,184 @@
+package tests
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	kf "github.com/team-neutron-shark/keyforge-network"
+)
+
+// connectClient - Connects a client to a server over an in-memory pipe.
+func connectClient(server *kf.Server) (*kf.Client, kf.Connection) {
+	serverSide, clientSide := net.Pipe()
+	connection := kf.NewTCPConnection(serverSide)
+
+	go server.ReadLoop(connection)
+
+	client := kf.NewClient()
+	client.Timeout = time.Second
+	client.Attach(kf.NewTCPConnection(clientSide))
+
+	return client, connection
+}
+
+func TestClientVersion(t *testing.T) {
+	server := newServer(t, ":0")
+	defer server.Stop()
+	server.Config.PingInterval = 0
+
+	client, _ := connectClient(server)
+	defer client.Close()
+
+	response, e := client.Version(context.Background())
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	if response.Version != kf.ProtocolVersion {
+		t.Error("protocol version mismatch")
+	}
+
+	if response.Sequence == 0 {
+		t.Error("server did not echo the request sequence")
+	}
+}
+
+func TestClientAnswersPings(t *testing.T) {
+	server := newServer(t, ":0")
+	defer server.Stop()
+	server.Config.PingInterval = kf.Duration(10 * time.Millisecond)
+	server.Config.ReadTimeout = kf.Duration(50 * time.Millisecond)
+
+	// Nothing reads Packets, as in a program which only uses the blocking
+	// calls, so the client has to answer the pings itself.
+	client, _ := connectClient(server)
+	defer client.Close()
+
+	time.Sleep(200 * time.Millisecond)
+
+	if _, e := client.Version(context.Background()); e != nil {
+		t.Fatalf("client was evicted despite the server pinging it: %s", e.Error())
+	}
+}
+
+func TestClientJoinLobby(t *testing.T) {
+	server := newServer(t, ":0")
+	defer server.Stop()
+	server.Config.PingInterval = 0
+
+	client, connection := connectClient(server)
+	defer client.Close()
+
+	player := kf.NewPlayer()
+	player.Name = "joiner"
+	player.ID = kf.GenerateUUID()
+	player.Client = connection
+	server.Players.AddPlayer(player)
+	defer server.RemovePlayer(player)
+
+	host := kf.NewPlayer()
+	host.Name = "host"
+	host.ID = kf.GenerateUUID()
+	host.Client = kf.NewTCPConnection(NewMockNetworkConnection())
+	lobby := server.Lobbies.AddLobby(host, "client join lobby")
+	defer server.Lobbies.RemoveLobby(lobby)
+
+	response, e := client.JoinLobby(context.Background(), "client join lobby")
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	if !response.Success || response.ID != lobby.ID() {
+		t.Error("join lobby response did not match the lobby joined")
+	}
+}
+
+func TestClientJoinFullLobby(t *testing.T) {
+	server := newServer(t, ":0")
+	defer server.Stop()
+	server.Config.PingInterval = 0
+
+	client, connection := connectClient(server)
+	defer client.Close()
+
+	player := kf.NewPlayer()
+	player.Name = "latecomer"
+	player.ID = kf.GenerateUUID()
+	player.Client = connection
+	server.Players.AddPlayer(player)
+	defer server.RemovePlayer(player)
+
+	host := kf.NewPlayer()
+	host.Name = "host"
+	host.ID = kf.GenerateUUID()
+	host.Client = kf.NewTCPConnection(NewMockNetworkConnection())
+	lobby := server.Lobbies.AddLobby(host, "full lobby")
+	defer server.Lobbies.RemoveLobby(lobby)
+
+	guest := kf.NewPlayer()
+	guest.Name = "guest"
+	guest.ID = kf.GenerateUUID()
+	guest.Client = kf.NewTCPConnection(NewMockNetworkConnection())
+
+	if !server.Lobbies.JoinLobby(lobby, guest) {
+		t.Fatal("guest could not join")
+	}
+
+	_, e := client.JoinLobby(context.Background(), "full lobby")
+
+	if e == nil || !strings.Contains(e.Error(), "lobby is full") {
+		t.Fatalf("expected the lobby to be reported full, got %v", e)
+	}
+
+	if lobby.PlayerExists(player) || len(lobby.Players()) != 2 {
+		t.Error("player was seated in a full lobby")
+	}
+}
+
+func TestClientErrorRoutedToCaller(t *testing.T) {
+	server := newServer(t, ":0")
+	defer server.Stop()
+	server.Config.PingInterval = 0
+
+	client, _ := connectClient(server)
+	defer client.Close()
+
+	// The client never logged in, so the server answers with an error.
+	_, e := client.JoinLobby(context.Background(), "no such lobby")
+
+	if e == nil {
+		t.Fatal("expected an error joining a lobby without logging in")
+	}
+
+	if _, ok := e.(*kf.ServerError); !ok {
+		t.Errorf("expected a server error, got %v", e)
+	}
+}
+
+func TestClientCallTimeout(t *testing.T) {
+	serverSide, clientSide := net.Pipe()
+	defer serverSide.Close()
+
+	// Swallow everything the client sends without ever answering.
+	go io.Copy(ioutil.Discard, serverSide)
+
+	client := kf.NewClient()
+	client.Attach(kf.NewTCPConnection(clientSide))
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, e := client.Version(ctx)
+
+	if e != context.DeadlineExceeded {
+		t.Errorf("expected the call to time out, got %v", e)
+	}
+}
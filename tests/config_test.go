@@ -0,0 +1,195 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	kf "github.com/team-neutron-shark/keyforge-network"
+)
+
+func TestLoadConfigYAML(t *testing.T) {
+	config, e := kf.LoadConfig("test_data/test_config.yaml")
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	if config.Address != ":9999" || config.Debug || config.LobbyCapacity != 4 {
+		t.Error("top level settings were not loaded")
+	}
+
+	if time.Duration(config.PingInterval) != 5*time.Second {
+		t.Errorf("unexpected ping interval %s", time.Duration(config.PingInterval))
+	}
+
+	if config.Logging.Level != kf.LogLevelWarn || config.Logging.Levels["network"] != kf.LogLevelDebug {
+		t.Error("log levels were not loaded")
+	}
+
+	if len(config.Logging.Sinks) != 2 || config.Logging.Sinks[0].Format != kf.LogFormatJSON {
+		t.Error("log sinks were not loaded")
+	}
+
+	if len(config.Audit.Players) != 2 || config.Audit.Players[1] != "p2" {
+		t.Error("audit players were not loaded")
+	}
+
+	if config.GameSaveDirectory != "data/saves" {
+		t.Error("settings missing from the file should keep their defaults")
+	}
+}
+
+func TestLoadConfigYAMLScalarsFollowFieldTypes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	document := "debug: on\nlobby_capacity: 3\ngame_save_directory: 2024\nadmins: [1234, yes]\naudit:\n  players:\n    - no\n    - 1.5\n"
+	e := os.WriteFile(path, []byte(document), 0644)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	config, e := kf.LoadConfig(path)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	if !config.Debug || config.LobbyCapacity != 3 {
+		t.Error("unquoted booleans and numbers were not read into their fields")
+	}
+
+	if config.GameSaveDirectory != "2024" {
+		t.Errorf("expected a numeric looking string to stay a string, got %q", config.GameSaveDirectory)
+	}
+
+	if strings.Join(config.Admins, ",") != "1234,yes" || strings.Join(config.Audit.Players, ",") != "no,1.5" {
+		t.Errorf("unquoted list items were not kept as strings: %v %v", config.Admins, config.Audit.Players)
+	}
+
+	e = os.WriteFile(path, []byte("debug: maybe\n"), 0644)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	if _, e = kf.LoadConfig(path); e == nil {
+		t.Error("expected a boolean setting which isn't true or false to be rejected")
+	}
+}
+
+func TestLoadConfigRejectsUnknownSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	e := os.WriteFile(path, []byte(`{"ping_intreval": "5s"}`), 0644)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	_, e = kf.LoadConfig(path)
+
+	if e == nil {
+		t.Error("expected a misspelled setting to be rejected")
+	}
+}
+
+func TestSaveConfigRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	config := kf.DefaultServerConfiguration()
+	config.LobbyCapacity = 6
+
+	e := kf.SaveConfig(config, path)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	loaded, e := kf.LoadConfig(path)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	if loaded.LobbyCapacity != 6 || loaded.PingInterval != config.PingInterval {
+		t.Error("configuration did not survive a save and load")
+	}
+}
+
+func TestParseConfigurationPrecedence(t *testing.T) {
+	t.Setenv("KF_CONFIG", "test_data/test_config.yaml")
+	t.Setenv("KF_ADDRESS", ":7777")
+	t.Setenv("KF_LOBBY_CAPACITY", "3")
+	t.Setenv("KF_AUDIT_PLAYERS", "p3")
+
+	config, e := kf.ParseConfiguration("kfserver", []string{"-lobby-capacity", "5", "-logging-level", "error"})
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	if config.Address != ":7777" {
+		t.Error("environment should override the file")
+	}
+
+	if config.LobbyCapacity != 5 || config.Logging.Level != kf.LogLevelError {
+		t.Error("flags should override the environment")
+	}
+
+	if len(config.Audit.Players) != 1 || config.Audit.Players[0] != "p3" {
+		t.Error("lists should be read from the environment")
+	}
+
+	if config.SlowClientPolicy != kf.SlowClientDrop {
+		t.Error("file settings should still apply")
+	}
+}
+
+func TestParseConfigurationBooleanFlags(t *testing.T) {
+	config, e := kf.ParseConfiguration("kfserver", []string{"-debug=false", "-audit-enabled", "-lobby-capacity", "4"})
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	if config.Debug || !config.Audit.Enabled || config.LobbyCapacity != 4 {
+		t.Error("boolean flags were not applied")
+	}
+}
+
+func TestConfigurationRejectsShortReadTimeout(t *testing.T) {
+	config := kf.DefaultServerConfiguration()
+	config.PingInterval = kf.Duration(15 * time.Second)
+	config.ReadTimeout = kf.Duration(15 * time.Second)
+
+	e := config.Validate()
+
+	if e == nil || !strings.Contains(e.Error(), "read_timeout (15s) must be longer than ping_interval (15s)") {
+		t.Errorf("expected a read timeout no longer than the ping interval to be rejected, got %v", e)
+	}
+
+	// Without pings the read timeout has nothing to wait for.
+	config.PingInterval = 0
+
+	if e = config.Validate(); e != nil {
+		t.Errorf("expected a read timeout without pings to be accepted, got %v", e)
+	}
+}
+
+func TestConfigurationValidation(t *testing.T) {
+	config := kf.DefaultServerConfiguration()
+	config.LobbyCapacity = 1
+	config.SlowClientPolicy = "ignore"
+	config.Logging.Sinks = []kf.LogSinkConfiguration{{Type: "file"}}
+
+	if config.Validate() == nil {
+		t.Error("expected the configuration to be rejected")
+	}
+
+	_, e := kf.NewServer(config)
+
+	if e == nil {
+		t.Error("NewServer accepted an invalid configuration")
+	}
+}
@@ -0,0 +1,113 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	kf "github.com/team-neutron-shark/keyforge-network"
+)
+
+func deckIDs(decks []kf.PartialDeckJSON) []string {
+	ids := []string{}
+
+	for _, deck := range decks {
+		ids = append(ids, deck.ID)
+	}
+
+	return ids
+}
+
+func TestDeckQueryString(t *testing.T) {
+	query := kf.DeckQuery{Query: "saffron", Houses: []string{"Dis", "Logos"}}
+	first, e := query.GetQueryString()
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	second, _ := query.GetQueryString()
+
+	if first != second {
+		t.Errorf("query string changed between calls: %q and %q", first, second)
+	}
+
+	expected := "houses=Dis%2CLogos&page=1&page_size=25&search=saffron"
+
+	if first != expected {
+		t.Errorf("expected %q, got %q", expected, first)
+	}
+
+	if query.Page != 0 || query.Values != nil {
+		t.Error("building the query string changed the query")
+	}
+}
+
+func TestDeckIteratorPages(t *testing.T) {
+	vault := newFakeVault(t)
+	defer vault.Close()
+
+	client := vault.Client()
+	user, _ := client.RetrieveProfile(context.Background(), "token-1")
+	query := kf.DeckQuery{PageSize: 1}
+
+	decks, e := kf.SearchAllDecks(context.Background(), client, &user, query)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	if len(decks) != 4 || decks[3].ID != "deck-4" {
+		t.Errorf("expected all four decks, got %v", deckIDs(decks))
+	}
+
+	// Stopping early only fetches the pages used.
+	iterator := kf.NewDeckIterator(context.Background(), client, &user, query)
+
+	if !iterator.Next() || iterator.Deck().ID != "deck-1" {
+		t.Fatal("expected the first deck")
+	}
+
+	if iterator.Pages() != 1 || iterator.Count() != 4 {
+		t.Errorf("expected one page of four decks, got %d pages of %d", iterator.Pages(), iterator.Count())
+	}
+}
+
+func TestDeckIteratorFilters(t *testing.T) {
+	vault := newFakeVault(t)
+	defer vault.Close()
+
+	client := vault.Client()
+	user, _ := client.RetrieveProfile(context.Background(), "token-1")
+
+	filters := []struct {
+		query    kf.DeckQuery
+		expected []string
+	}{
+		{kf.DeckQuery{Houses: []string{"Sanctum"}, Expansion: 435}, []string{"deck-3", "deck-4"}},
+		{kf.DeckQuery{Expansion: 341, PageSize: 1}, []string{"deck-1", "deck-2"}},
+		{kf.DeckQuery{Maverick: kf.DeckCardsRequired, PageSize: 1}, []string{"deck-3"}},
+		{kf.DeckQuery{Houses: []string{"Shadows"}, Legacy: kf.DeckCardsExcluded}, []string{"deck-4"}},
+	}
+
+	for _, filter := range filters {
+		decks, e := kf.SearchAllDecks(context.Background(), client, &user, filter.query)
+
+		if e != nil {
+			t.Fatal(e.Error())
+		}
+
+		ids := deckIDs(decks)
+
+		if len(ids) != len(filter.expected) {
+			t.Errorf("%+v: expected %v, got %v", filter.query, filter.expected, ids)
+			continue
+		}
+
+		for i := range ids {
+			if ids[i] != filter.expected[i] {
+				t.Errorf("%+v: expected %v, got %v", filter.query, filter.expected, ids)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	kf "github.com/team-neutron-shark/keyforge-network"
+)
+
+func TestDeckStoreLibrary(t *testing.T) {
+	directory := t.TempDir()
+	store, e := kf.NewDeckStore(directory, 0)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	deck, e := kf.LoadDeckFromFile("test_data/test_deck.json")
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	e = store.Put(deck)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	store.Put(kf.Deck{ID: "other", Name: "Another Deck", Houses: []string{"Mars"}})
+	store.Tag(deck.ID, "favourite", "tournament")
+	store.Untag(deck.ID, "tournament")
+
+	// A store opened on the same directory sees the same decks and tags.
+	reopened, e := kf.NewDeckStore(directory, 0)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	if len(reopened.List()) != 2 {
+		t.Fatalf("expected two decks, got %d", len(reopened.List()))
+	}
+
+	tagged := reopened.Search(kf.DeckStoreQuery{Tag: "Favourite"})
+
+	if len(tagged) != 1 || tagged[0].ID != deck.ID || len(tagged[0].Tags) != 1 {
+		t.Errorf("tag search failed: %+v", tagged)
+	}
+
+	martian := reopened.Search(kf.DeckStoreQuery{Name: "another", Houses: []string{"mars"}})
+
+	if len(martian) != 1 || martian[0].ID != "other" {
+		t.Errorf("name and house search failed: %+v", martian)
+	}
+
+	stored, e := reopened.Get(deck.ID)
+
+	if e != nil || stored.Name != deck.Name || len(stored.Cards) != len(deck.Cards) {
+		t.Error("stored deck did not round trip")
+	}
+
+	e = reopened.Remove("other")
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	if _, e = reopened.Get("other"); !errors.Is(e, kf.ErrDeckNotStored) {
+		t.Errorf("expected a removed deck to be gone, got %v", e)
+	}
+}
+
+func TestDeckStoreRetrieve(t *testing.T) {
+	vault := newFakeVault(t)
+	defer vault.Close()
+
+	client := vault.Client()
+	client.MaxRetries = 0
+	user, _ := client.RetrieveProfile(context.Background(), "token-1")
+	store, _ := kf.NewDeckStore(t.TempDir(), time.Hour)
+	requests := vault.Requests()
+
+	for i := 0; i < 2; i++ {
+		deck, e := store.Retrieve(context.Background(), client, &user, "deck-1")
+
+		if e != nil {
+			t.Fatal(e.Error())
+		}
+
+		if len(deck.Cards) != 3 {
+			t.Error("retrieved deck is missing cards")
+		}
+	}
+
+	if vault.Requests()-requests != 1 {
+		t.Errorf("expected the cached deck to be used, made %d requests", vault.Requests()-requests)
+	}
+
+	// Once the deck expires the Vault is asked again, but the cached copy
+	// is used if it can't answer.
+	store.SetTTL(time.Nanosecond)
+	vault.FailNext(1, 503, "")
+
+	deck, e := store.Retrieve(context.Background(), client, &user, "deck-1")
+
+	if e != nil || deck.ID != "deck-1" {
+		t.Errorf("expected the stale deck while the Vault is down, got %v", e)
+	}
+
+	vault.FailNext(1, 503, "")
+	_, e = store.Retrieve(context.Background(), client, &user, "deck-2")
+
+	if !errors.Is(e, kf.ErrVaultUnavailable) {
+		t.Errorf("expected an uncached deck to fail while the Vault is down, got %v", e)
+	}
+
+	// A Vault which answers but turns the request down isn't covered for by
+	// the cached copy.
+	for status, expected := range map[int]error{401: kf.ErrUnauthorized, 404: kf.ErrNotFound} {
+		vault.FailNext(1, status, "")
+		_, e = store.Retrieve(context.Background(), client, &user, "deck-1")
+
+		if !errors.Is(e, expected) {
+			t.Errorf("expected %v for a %d from the Vault, got %v", expected, status, e)
+		}
+	}
+}
+
+func TestServerSelectDeck(t *testing.T) {
+	vault := newFakeVault(t)
+	store, _ := kf.NewDeckStore(t.TempDir(), time.Hour)
+
+	server := newServer(t, ":0", kf.WithVaultClient(vault.Client()), kf.WithDeckStore(store))
+	defer server.Stop()
+
+	client, _ := connectClient(server)
+	defer client.Close()
+
+	_, e := client.Login(context.Background(), "archon", "user-1", "token-1")
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	response, e := client.SelectDeck(context.Background(), "deck-1")
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	if response.Name != "Brother Saffron, the Unkempt" || response.Cards != 3 {
+		t.Errorf("unexpected response %+v", response)
+	}
+
+	// The deck is cached, so selecting it again works without the Vault.
+	vault.Close()
+
+	_, e = client.SelectDeck(context.Background(), "deck-1")
+
+	if e != nil {
+		t.Errorf("expected the cached deck to be selected offline, got %v", e)
+	}
+
+	_, e = client.SelectDeck(context.Background(), "deck-2")
+
+	if e == nil {
+		t.Error("expected an uncached deck to fail offline")
+	}
+}
+
+func TestServerStartGameWhileSelectingDeck(t *testing.T) {
+	vault := newFakeVault(t)
+	defer vault.Close()
+
+	server := newServer(t, ":0", kf.WithVaultClient(vault.Client()))
+	defer server.Stop()
+
+	client, _ := connectClient(server)
+	defer client.Close()
+
+	_, e := client.Login(context.Background(), "archon", "user-1", "token-1")
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	player, e := server.Players.FindPlayerByID("user-1")
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	guest := kf.NewPlayer()
+	guest.Client = kf.NewTCPConnection(NewMockNetworkConnection())
+	lobby := server.AddLobby(player, "deck race")
+	defer server.Lobbies.RemoveLobby(lobby)
+	server.Lobbies.JoinLobby(lobby, guest)
+
+	selected := make(chan error, 1)
+
+	go func() {
+		_, e := client.SelectDeck(context.Background(), "deck-1")
+		selected <- e
+	}()
+
+	_, e = server.StartGame(lobby)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	// The deck is either chosen before the game starts or refused.
+	if e = <-selected; e != nil && !strings.Contains(e.Error(), "during a game") {
+		t.Errorf("unexpected deck selection error: %v", e)
+	}
+
+	_, e = client.SelectDeck(context.Background(), "deck-1")
+
+	if e == nil {
+		t.Error("deck was changed during a game")
+	}
+}
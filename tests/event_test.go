@@ -0,0 +1,131 @@
+package tests
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	kf "github.com/team-neutron-shark/keyforge-network"
+)
+
+type recordingObserver struct {
+	eventMutex sync.Mutex
+	events     []kf.Event
+}
+
+func (r *recordingObserver) Notify(event kf.Event) {
+	r.eventMutex.Lock()
+	r.events = append(r.events, event)
+	r.eventMutex.Unlock()
+}
+
+func (r *recordingObserver) Count() int {
+	r.eventMutex.Lock()
+	defer r.eventMutex.Unlock()
+
+	return len(r.events)
+}
+
+type panickingObserver struct{}
+
+func (p panickingObserver) Notify(event kf.Event) {
+	panic("observer failure")
+}
+
+// blockingObserver - Holds up delivery until released.
+type blockingObserver struct {
+	release chan struct{}
+}
+
+func (b blockingObserver) Notify(event kf.Event) {
+	<-b.release
+}
+
+func TestEventTopicSubscription(t *testing.T) {
+	events := kf.NewEventManager(kf.NewLogManager())
+	defer events.Close()
+
+	observer := &recordingObserver{}
+	events.Subscribe(observer, kf.TopicKeyForged)
+
+	events.Publish(kf.PlayerLoggedInEvent{})
+	events.Publish(kf.KeyForgedEvent{Keys: 1})
+
+	if observer.Count() != 1 {
+		t.Errorf("expected 1 event, received %d", observer.Count())
+	}
+}
+
+func TestEventObserverPanicRecovered(t *testing.T) {
+	events := kf.NewEventManager(kf.NewLogManager())
+	defer events.Close()
+
+	observer := &recordingObserver{}
+	events.Subscribe(panickingObserver{})
+	events.Subscribe(observer)
+
+	events.Publish(kf.LobbyCreatedEvent{})
+
+	if observer.Count() != 1 {
+		t.Error("a panicking observer stopped delivery to the others")
+	}
+}
+
+func TestEventAsyncDoesNotBlockPublisher(t *testing.T) {
+	events := kf.NewEventManager(kf.NewLogManager())
+
+	blocker := blockingObserver{release: make(chan struct{})}
+	subscription := events.SubscribeAsync(blocker, 1)
+
+	published := make(chan struct{})
+
+	go func() {
+		for i := 0; i < 10; i++ {
+			events.Publish(kf.GameEndedEvent{})
+		}
+
+		close(published)
+	}()
+
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("a slow asynchronous observer blocked the publisher")
+	}
+
+	if subscription.Dropped() == 0 {
+		t.Error("expected events to be dropped once the buffer filled")
+	}
+
+	close(blocker.release)
+	events.Close()
+}
+
+func TestGameEventsPublished(t *testing.T) {
+	events := kf.NewEventManager(kf.NewLogManager())
+	defer events.Close()
+
+	observer := &recordingObserver{}
+	events.Subscribe(observer, kf.TopicKeyForged, kf.TopicGameEnded)
+
+	lobbies := kf.NewLobbyManager()
+	host := kf.NewPlayer()
+	lobby := lobbies.AddLobby(host, "event lobby")
+	defer lobbies.RemoveLobby(lobby)
+	lobbies.JoinLobby(lobby, kf.NewPlayer())
+
+	start := &kf.StartGameCommand{Events: events}
+	lobby.Execute(start)
+
+	if start.Err != nil {
+		t.Fatal(start.Err.Error())
+	}
+
+	host.Amber = 7
+	start.Game.ForgeKey(host)
+	lobbies.LeaveLobby(lobby, host)
+
+	if observer.Count() != 2 {
+		t.Errorf("expected a key forged and a game ended event, received %d", observer.Count())
+	}
+}
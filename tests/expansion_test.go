@@ -0,0 +1,99 @@
+package tests
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	kf "github.com/team-neutron-shark/keyforge-network"
+)
+
+func TestExpansionRegistry(t *testing.T) {
+	registry := kf.NewDefaultExpansionRegistry()
+
+	for _, name := range []string{"341", "cota", "Call of the Archons"} {
+		expansion, e := registry.Resolve(name)
+
+		if e != nil || expansion.ID != 341 {
+			t.Errorf("%s: expected Call of the Archons, got %+v (%v)", name, expansion, e)
+		}
+	}
+
+	if _, e := registry.Resolve("999"); e == nil {
+		t.Error("expected an unknown expansion to be rejected")
+	}
+
+	if !registry.Less(341, 435) || registry.Less(435, 341) || !registry.Less(479, 999) {
+		t.Error("expansions are not ordered by release")
+	}
+
+	registry.Register(kf.Expansion{ID: 496, Code: "DT", Name: "Dark Tidings", Order: 5, Houses: []string{"Unfathomable"}})
+	all := registry.All()
+
+	if len(all) != 5 || all[4].ID != 496 || !all[4].HasHouse("unfathomable") {
+		t.Errorf("expected the new expansion last, got %+v", all)
+	}
+}
+
+func TestCardManagerLoadFromPaths(t *testing.T) {
+	directory := t.TempDir()
+	reprint := []kf.Card{{ID: "reprint-anger", CardTitle: "Anger", House: "Brobnar", CardType: "Action", Expansion: 435, CardNumber: 1}}
+	data, _ := json.Marshal(reprint)
+
+	e := ioutil.WriteFile(filepath.Join(directory, "aoa.json"), data, 0644)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	cards := kf.NewCardManager()
+	e = cards.LoadFromPaths("../data/cards.json", directory)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	printings := cards.FindByTitle("anger")
+
+	if len(printings) != 2 || printings[0].Expansion != 435 {
+		t.Fatalf("expected both printings of Anger, newest first, got %+v", printings)
+	}
+
+	count := cards.Count()
+
+	if cards.LoadFromPaths("../data/cards.json", filepath.Join(directory, "missing.json")) == nil {
+		t.Error("expected a missing file to be reported")
+	}
+
+	if cards.Count() != count {
+		t.Error("cards were replaced by a failed load")
+	}
+}
+
+func TestCardManagerResolveReprint(t *testing.T) {
+	cards := kf.NewCardManager()
+	e := cards.LoadFromFile("../data/cards.json")
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	// A card from a set the database has no data for, known only by title.
+	reprint := kf.Card{ID: "wc-anger", CardTitle: "Anger", House: "Brobnar", Expansion: 452, CardNumber: 7}
+	resolved, e := cards.ResolveCard(reprint)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	if resolved.ID != "wc-anger" || resolved.Expansion != 452 || resolved.CardNumber != 7 || resolved.CardType != "Action" || resolved.CardText == "" {
+		t.Errorf("reprint was not resolved from the earlier printing: %+v", resolved)
+	}
+
+	deck, unresolved := cards.ResolveDeck(kf.Deck{Cards: []kf.Card{reprint, {CardTitle: "Not A Real Card", Expansion: 452}}})
+
+	if deck.Cards[0].CardType != "Action" || len(unresolved) != 1 || unresolved[0] != "Not A Real Card" {
+		t.Errorf("unexpected deck resolution: %+v, unresolved %v", deck.Cards, unresolved)
+	}
+}
@@ -0,0 +1,109 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+
+	kf "github.com/team-neutron-shark/keyforge-network"
+)
+
+type tournamentPacket struct {
+	kf.PacketHeader
+	Round int `json:"round"`
+}
+
+const packetTypeTournament = kf.PacketTypeUserDefined + 1
+
+func TestServerCustomHandler(t *testing.T) {
+	server := newServer(t, ":0")
+	defer server.Stop()
+
+	e := kf.RegisterPacketType(packetTypeTournament, tournamentPacket{})
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	// Registering the same struct again is harmless, as when the tests run
+	// more than once in a process, but another struct can't take the type.
+	if e = kf.RegisterPacketType(packetTypeTournament, tournamentPacket{}); e != nil {
+		t.Errorf("registering the same packet again failed: %v", e)
+	}
+
+	if e = kf.RegisterPacketType(packetTypeTournament, kf.PacketHeader{}); !errors.Is(e, kf.ErrPacketTypeRegistered) {
+		t.Errorf("expected a conflicting registration to be rejected, got %v", e)
+	}
+
+	round := 0
+
+	server.Handle(packetTypeTournament, func(client kf.Connection, packet kf.Packet) error {
+		round = packet.(tournamentPacket).Round
+		return nil
+	})
+
+	request := tournamentPacket{Round: 3}
+	request.Type = packetTypeTournament
+	payload, _ := kf.GetPacketPayload(request)
+
+	packet, e := kf.ParsePacket(request.PacketHeader, payload)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	server.HandlePacket(kf.NewTCPConnection(NewMockNetworkConnection()), packet)
+
+	if round != 3 {
+		t.Error("custom handler did not receive the packet")
+	}
+}
+
+func TestServerMiddlewareRejects(t *testing.T) {
+	server := newServer(t, ":0")
+	defer server.Stop()
+	connection := NewMockNetworkConnection()
+
+	var result error
+
+	// Added first, so it is the outermost and sees the rejection.
+	server.Handlers.After(func(client kf.Connection, packet kf.Packet, e error) {
+		result = e
+	})
+
+	server.Handlers.Before(func(client kf.Connection, packet kf.Packet) error {
+		if packet.GetHeader().Type == kf.PacketTypeVersionRequest {
+			return errors.New("version requests are disabled")
+		}
+
+		return nil
+	})
+
+	request := kf.VersionPacket{}
+	request.Type = kf.PacketTypeVersionRequest
+	request.Sequence = 7
+	request.Version = kf.ProtocolVersion
+
+	server.HandlePacket(kf.NewTCPConnection(connection), request)
+
+	response, e := kf.ReadPacket(connection)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	errorPacket, ok := response.(kf.ErrorPacket)
+
+	if !ok || errorPacket.Sequence != 7 {
+		t.Error("rejected request did not produce an error packet")
+	}
+
+	if result == nil {
+		t.Error("after hook did not see the rejection")
+	}
+}
+
+func TestRegisterReservedPacketType(t *testing.T) {
+	if kf.RegisterPacketType(kf.PacketTypeLoginRequest, tournamentPacket{}) != kf.ErrPacketTypeReserved {
+		t.Error("expected reserved packet types to be refused")
+	}
+}
@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	kf "github.com/team-neutron-shark/keyforge-network"
+)
+
+func TestHeartbeatSendsPing(t *testing.T) {
+	server := newServer(t, ":0")
+	defer server.Stop()
+	server.Config.PingInterval = kf.Duration(10 * time.Millisecond)
+	server.Config.ReadTimeout = kf.Duration(time.Second)
+
+	serverSide, clientSide := net.Pipe()
+	defer clientSide.Close()
+
+	go server.ReadLoop(kf.NewTCPConnection(serverSide))
+
+	clientSide.SetReadDeadline(time.Now().Add(time.Second))
+	packet, e := kf.ReadPacket(clientSide)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	if packet.GetHeader().Type != kf.PacketTypePing {
+		t.Errorf("expected a ping packet, got packet type %d", packet.GetHeader().Type)
+	}
+}
+
+func TestHeartbeatKeepsConnectionWhenPingDropped(t *testing.T) {
+	server := newServer(t, ":0")
+	defer server.Stop()
+	server.Config.PingInterval = kf.Duration(5 * time.Millisecond)
+
+	// Nothing reads the other end, so the writer stalls and the one slot
+	// queue fills up.
+	serverSide, clientSide := net.Pipe()
+	defer clientSide.Close()
+
+	queued := kf.NewQueuedConnection(kf.NewTCPConnection(serverSide), 1, kf.SlowClientDrop, 0)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		server.HeartbeatLoop(queued, done)
+		close(stopped)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	if e := queued.WritePacket(kf.PingPacket{}); e != kf.ErrOutboundQueueFull {
+		t.Errorf("expected the queue to still be open and full, got %v", e)
+	}
+
+	close(done)
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("heartbeat did not stop once done was closed")
+	}
+}
+
+func TestHeartbeatEvictsIdleConnection(t *testing.T) {
+	server := newServer(t, ":0")
+	defer server.Stop()
+	server.Config.PingInterval = 0
+	server.Config.ReadTimeout = kf.Duration(20 * time.Millisecond)
+
+	serverSide, clientSide := net.Pipe()
+	defer clientSide.Close()
+
+	connection := kf.NewTCPConnection(serverSide)
+	player := kf.NewPlayer()
+	player.Name = "idle"
+	player.ID = kf.GenerateUUID()
+	player.Client = connection
+	server.Players.AddPlayer(player)
+	server.Lobbies.AddLobby(player, "idle lobby")
+
+	done := make(chan struct{})
+
+	go func() {
+		server.ReadLoop(connection)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("idle connection was not evicted")
+	}
+
+	if server.Players.PlayerExists(player) {
+		t.Error("idle player was not removed from the player list")
+	}
+
+	if server.PlayerHasLobby(player) {
+		t.Error("idle player was not removed from their lobby")
+	}
+}
@@ -0,0 +1,262 @@
+package tests
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	kf "github.com/team-neutron-shark/keyforge-network"
+)
+
+// countCommand - Increments a counter without any locking, relying on the
+// lobby to run commands one at a time.
+type countCommand struct {
+	count *int
+}
+
+func (c countCommand) Execute(lobby *kf.Lobby) {
+	*c.count++
+}
+
+func TestLobbyCommandsRunSerially(t *testing.T) {
+	lobby := kf.NewLobby()
+	defer lobby.Close()
+
+	count := 0
+	var wait sync.WaitGroup
+
+	for i := 0; i < 100; i++ {
+		wait.Add(1)
+
+		go func() {
+			defer wait.Done()
+			lobby.Execute(countCommand{count: &count})
+		}()
+	}
+
+	wait.Wait()
+
+	if count != 100 {
+		t.Errorf("expected 100 commands to run, counted %d", count)
+	}
+}
+
+// panicCommand - A command which fails part way through.
+type panicCommand struct{}
+
+func (c panicCommand) Execute(lobby *kf.Lobby) {
+	panic("broken command")
+}
+
+func TestLobbyCommandPanicReported(t *testing.T) {
+	sink := &memorySink{}
+	logger := kf.NewLogManager(sink)
+	defer logger.Close()
+
+	lobby := kf.NewLobby()
+	defer lobby.Close()
+	lobby.SetLogger(logger)
+
+	e := lobby.Execute(panicCommand{})
+
+	if !errors.Is(e, kf.ErrLobbyCommandPanicked) {
+		t.Errorf("expected the panic to be reported, got %v", e)
+	}
+
+	count := 0
+
+	if e = lobby.Execute(countCommand{count: &count}); e != nil || count != 1 {
+		t.Errorf("lobby stopped running commands after a panic: %v", e)
+	}
+
+	logger.Flush()
+	entries := sink.Entries()
+
+	if len(entries) != 1 || entries[0].Level != kf.LogLevelError || entries[0].Fields["stack"] == nil {
+		t.Errorf("expected the panic to be logged with its stack, got %+v", entries)
+	}
+}
+
+func TestLobbyKickRequiresHost(t *testing.T) {
+	lobbies := kf.NewLobbyManager()
+	host := kf.NewPlayer()
+	guest := kf.NewPlayer()
+	lobby := lobbies.AddLobby(host, "kick lobby")
+	defer lobbies.RemoveLobby(lobby)
+
+	lobbies.JoinLobby(lobby, guest)
+
+	if lobbies.KickPlayer(lobby, guest, host) == nil {
+		t.Error("a guest should not be able to kick the host")
+	}
+
+	if e := lobbies.KickPlayer(lobby, host, guest); e != nil {
+		t.Fatal(e.Error())
+	}
+
+	if lobby.PlayerExists(guest) {
+		t.Error("kicked player is still in the lobby")
+	}
+}
+
+func TestLobbyStartGameAndLeave(t *testing.T) {
+	lobbies := kf.NewLobbyManager()
+	host := kf.NewPlayer()
+	guest := kf.NewPlayer()
+	lobby := lobbies.AddLobby(host, "game lobby")
+	defer lobbies.RemoveLobby(lobby)
+
+	lobbies.JoinLobby(lobby, guest)
+
+	start := &kf.StartGameCommand{}
+	lobby.Execute(start)
+
+	if start.Err != nil {
+		t.Fatal(start.Err.Error())
+	}
+
+	leave := lobbies.LeaveLobby(lobby, host)
+
+	if start.Game.Running {
+		t.Error("game kept running after a player left")
+	}
+
+	if len(leave.Remaining) != 1 || lobby.Host() != guest {
+		t.Error("host role did not pass to the remaining player")
+	}
+}
+
+func TestLobbyPlayerMovesBetweenLobbies(t *testing.T) {
+	lobbies := kf.NewLobbyManager()
+	host := kf.NewPlayer()
+	player := kf.NewPlayer()
+	first := lobbies.AddLobby(player, "first lobby")
+	second := lobbies.AddLobby(player, "second lobby")
+	defer lobbies.RemoveLobby(second)
+
+	if first.PlayerExists(player) {
+		t.Error("creating a lobby left the player behind in their old one")
+	}
+
+	if _, e := lobbies.FindLobbyByID(first.ID()); e == nil {
+		t.Error("old lobby was not removed once its only player left")
+	}
+
+	third := lobbies.AddLobby(host, "third lobby")
+	defer lobbies.RemoveLobby(third)
+
+	if !lobbies.JoinLobby(third, player) {
+		t.Fatal("player could not join the third lobby")
+	}
+
+	if second.PlayerExists(player) {
+		t.Error("joining a lobby left the player behind in their old one")
+	}
+
+	if found, e := lobbies.FindLobbyByPlayer(player); e != nil || found != third {
+		t.Error("player is not indexed to the lobby they joined")
+	}
+}
+
+func TestLobbyJoinWhileLastPlayerLeaves(t *testing.T) {
+	lobbies := kf.NewLobbyManager()
+
+	for i := 0; i < 200; i++ {
+		host := kf.NewPlayer()
+		guest := kf.NewPlayer()
+		lobby := lobbies.AddLobby(host, "emptying lobby")
+
+		var wait sync.WaitGroup
+		var joined bool
+		wait.Add(2)
+
+		go func() {
+			defer wait.Done()
+			lobbies.LeaveLobby(lobby, host)
+		}()
+
+		go func() {
+			defer wait.Done()
+			joined = lobbies.JoinLobby(lobby, guest)
+		}()
+
+		wait.Wait()
+
+		found, e := lobbies.FindLobbyByPlayer(guest)
+
+		if joined {
+			// The guest got in first, so the lobby carries on with them.
+			if e != nil || found != lobby {
+				t.Fatal("joined player is not indexed to their lobby")
+			}
+
+			if _, e := lobbies.FindLobbyByID(lobby.ID()); e != nil {
+				t.Fatal("lobby was removed while a player was still in it")
+			}
+
+			lobbies.LeaveLobby(lobby, guest)
+		} else if e == nil {
+			t.Fatal("player turned away from a removed lobby is still indexed to it")
+		}
+
+		if _, e := lobbies.FindLobbyByID(lobby.ID()); e == nil {
+			t.Fatal("empty lobby was not removed")
+		}
+	}
+}
+
+func TestLobbyJoinWhileRemoved(t *testing.T) {
+	lobbies := kf.NewLobbyManager()
+
+	for i := 0; i < 200; i++ {
+		lobby := lobbies.AddLobby(kf.NewPlayer(), "removed lobby")
+		guest := kf.NewPlayer()
+
+		var wait sync.WaitGroup
+		wait.Add(2)
+
+		go func() {
+			defer wait.Done()
+			lobbies.RemoveLobby(lobby)
+		}()
+
+		go func() {
+			defer wait.Done()
+			lobbies.JoinLobby(lobby, guest)
+		}()
+
+		wait.Wait()
+
+		if _, e := lobbies.FindLobbyByPlayer(guest); e == nil {
+			t.Fatal("player is still indexed to a removed lobby")
+		}
+	}
+}
+
+func TestLobbyAfterFunc(t *testing.T) {
+	lobby := kf.NewLobby()
+	defer lobby.Close()
+
+	count := 0
+	lobby.AfterFunc(10*time.Millisecond, countCommand{count: &count})
+
+	time.Sleep(50 * time.Millisecond)
+
+	// Execute queues behind the timer's command, which makes the count safe
+	// to read once it returns.
+	lobby.Execute(countCommand{count: new(int)})
+
+	if count != 1 {
+		t.Error("timer command did not run")
+	}
+}
+
+func TestLobbyClosed(t *testing.T) {
+	lobby := kf.NewLobby()
+	lobby.Close()
+
+	if lobby.Execute(countCommand{count: new(int)}) != kf.ErrLobbyClosed {
+		t.Error("expected closed lobby to reject commands")
+	}
+}
@@ -0,0 +1,149 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	kf "github.com/team-neutron-shark/keyforge-network"
+)
+
+// memorySink - Collects entries in memory.
+type memorySink struct {
+	sinkMutex sync.Mutex
+	entries   []kf.LogEntry
+	block     chan struct{}
+}
+
+func (m *memorySink) Write(entry kf.LogEntry) error {
+	if m.block != nil {
+		<-m.block
+	}
+
+	m.sinkMutex.Lock()
+	m.entries = append(m.entries, entry)
+	m.sinkMutex.Unlock()
+	return nil
+}
+
+func (m *memorySink) Close() error {
+	return nil
+}
+
+func (m *memorySink) Entries() []kf.LogEntry {
+	m.sinkMutex.Lock()
+	defer m.sinkMutex.Unlock()
+
+	return m.entries
+}
+
+func TestLoggerSubsystemLevels(t *testing.T) {
+	sink := &memorySink{}
+	logger := kf.NewLogManager(sink)
+	defer logger.Close()
+
+	logger.SetLevel("network", kf.LogLevelWarn)
+	logger.SetLevel("lobby", kf.LogLevelDebug)
+
+	logger.Subsystem("network").Log("dropped")
+	logger.Subsystem("network").Warn("kept")
+	logger.Subsystem("lobby").Debug("kept", kf.Fields{"lobby_id": "abc"})
+	logger.Debug("dropped")
+	logger.Flush()
+
+	entries := sink.Entries()
+
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, found %d", len(entries))
+	}
+
+	if entries[1].Subsystem != "lobby" || entries[1].Fields["lobby_id"] != "abc" {
+		t.Error("entry lost its subsystem or fields")
+	}
+}
+
+func TestLoggerDoesNotBlock(t *testing.T) {
+	sink := &memorySink{block: make(chan struct{})}
+	logger := kf.NewLogManager(sink)
+
+	done := make(chan struct{})
+
+	go func() {
+		for i := 0; i < 5000; i++ {
+			logger.Log("flood")
+		}
+
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("logging blocked on a stalled sink")
+	}
+
+	if logger.Dropped() == 0 {
+		t.Error("expected entries to be dropped once the queue filled")
+	}
+
+	close(sink.block)
+	logger.Close()
+}
+
+func TestLoggerJSONSink(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := kf.NewLogManager(kf.NewJSONSink(&buffer))
+
+	logger.WithFields(kf.Fields{"player_id": "p1"}).Subsystem("session").Error("failed")
+	logger.Close()
+
+	line := map[string]interface{}{}
+	e := json.Unmarshal(buffer.Bytes(), &line)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	if line["level"] != "error" || line["subsystem"] != "session" || line["player_id"] != "p1" {
+		t.Errorf("unexpected JSON entry: %s", buffer.String())
+	}
+}
+
+func TestLoggerRotatingFile(t *testing.T) {
+	directory, e := ioutil.TempDir("", "kflog")
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	defer os.RemoveAll(directory)
+
+	config := kf.LogConfiguration{Level: kf.LogLevelInfo}
+	path := filepath.Join(directory, "server.log")
+	config.Sinks = []kf.LogSinkConfiguration{{Type: "file", Path: path, MaxSize: 200, MaxFiles: 2}}
+
+	logger, e := kf.NewLogManagerFromConfig(config)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	for i := 0; i < 20; i++ {
+		logger.Log("a line long enough to fill the file quickly")
+	}
+
+	logger.Close()
+
+	if _, e := os.Stat(path + ".2"); e != nil {
+		t.Error("log file was not rotated")
+	}
+
+	if _, e := os.Stat(path + ".3"); e == nil {
+		t.Error("more rotated files were kept than allowed")
+	}
+}
@@ -0,0 +1,177 @@
+package tests
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	kf "github.com/team-neutron-shark/keyforge-network"
+)
+
+func TestPlayerManagerIndexes(t *testing.T) {
+	players := kf.NewPlayerManager(kf.NewLogManager())
+	player := kf.NewPlayer()
+	player.ID = kf.GenerateUUID()
+	player.Name = "indexed"
+	player.Client = kf.NewTCPConnection(NewMockNetworkConnection())
+	players.AddPlayer(player)
+
+	if found, e := players.FindPlayerByID(player.ID); e != nil || found != player {
+		t.Error("player not found by ID")
+	}
+
+	if found, e := players.FindPlayerByName(player.Name); e != nil || found != player {
+		t.Error("player not found by name")
+	}
+
+	previous := player.Client
+	connection := kf.NewTCPConnection(NewMockNetworkConnection())
+	players.SetConnection(player, connection)
+
+	if _, e := players.FindPlayerByConnection(previous); e == nil {
+		t.Error("player still indexed by their old connection")
+	}
+
+	if found, e := players.FindPlayerByConnection(connection); e != nil || found != player {
+		t.Error("player not found by their new connection")
+	}
+
+	players.RemovePlayer(player)
+
+	if _, e := players.FindPlayerByID(player.ID); e == nil {
+		t.Error("removed player still indexed by ID")
+	}
+}
+
+func TestPlayerManagerSetConnectionWhileLocked(t *testing.T) {
+	players := kf.NewPlayerManager(kf.NewLogManager())
+	player := kf.NewPlayer()
+	player.ID = kf.GenerateUUID()
+	player.Name = "resuming"
+	player.Client = kf.NewTCPConnection(NewMockNetworkConnection())
+	players.AddPlayer(player)
+
+	done := make(chan struct{})
+	var wait sync.WaitGroup
+	wait.Add(3)
+
+	// Resumes move the player while handlers, holding the player's lock,
+	// search the manager and others send to the player.
+	go func() {
+		defer wait.Done()
+
+		for i := 0; i < 500; i++ {
+			players.SetConnection(player, kf.NewTCPConnection(NewMockNetworkConnection()))
+			runtime.Gosched()
+		}
+	}()
+
+	go func() {
+		defer wait.Done()
+
+		for i := 0; i < 500; i++ {
+			player.Lock()
+			// Give a resume the chance to start while the lock is held.
+			runtime.Gosched()
+			players.GetPlayers()
+			players.FindPlayerByID(player.ID)
+			player.Unlock()
+		}
+	}()
+
+	go func() {
+		defer wait.Done()
+
+		for i := 0; i < 500; i++ {
+			if _, e := players.FindPlayerByConnection(player.Connection()); e != nil {
+				// The connection may move between the two calls.
+				continue
+			}
+		}
+	}()
+
+	go func() {
+		wait.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("setting a connection deadlocked with a locked player")
+	}
+
+	if found, e := players.FindPlayerByConnection(player.Connection()); e != nil || found != player {
+		t.Error("player not found by their final connection")
+	}
+}
+
+func TestManagersConcurrentLoginsAndJoins(t *testing.T) {
+	players := kf.NewPlayerManager(kf.NewLogManager())
+	lobbies := kf.NewLobbyManager()
+
+	const count = 400
+	hosts := make([]*kf.Player, count/2)
+
+	for i := range hosts {
+		hosts[i] = kf.NewPlayer()
+		hosts[i].ID = kf.GenerateUUID()
+		hosts[i].Name = fmt.Sprintf("host %d", i)
+		players.AddPlayer(hosts[i])
+		lobbies.AddLobby(hosts[i], fmt.Sprintf("lobby %d", i))
+	}
+
+	var wait sync.WaitGroup
+
+	for i := 0; i < count; i++ {
+		wait.Add(1)
+
+		go func(i int) {
+			defer wait.Done()
+
+			player := kf.NewPlayer()
+			player.ID = kf.GenerateUUID()
+			player.Name = fmt.Sprintf("player %d", i)
+			player.Client = kf.NewTCPConnection(NewMockNetworkConnection())
+			players.AddPlayer(player)
+
+			if _, e := players.FindPlayerByConnection(player.Client); e != nil {
+				t.Error(e.Error())
+			}
+
+			lobby, e := lobbies.FindLobbyByName(fmt.Sprintf("lobby %d", i/2))
+
+			if e != nil {
+				t.Error(e.Error())
+				return
+			}
+
+			// Two players race for each lobby's one free seat.
+			if lobbies.JoinLobby(lobby, player) {
+				if found, e := lobbies.FindLobbyByPlayer(player); e != nil || found != lobby {
+					t.Error("joined player not indexed to their lobby")
+				}
+
+				lobbies.LeaveLobby(lobby, player)
+			}
+
+			players.GetPlayers()
+			lobbies.GetLobbies()
+			players.RemovePlayer(player)
+		}(i)
+	}
+
+	wait.Wait()
+
+	if players.Count() != len(hosts) {
+		t.Errorf("expected %d players to remain, found %d", len(hosts), players.Count())
+	}
+
+	for _, lobby := range lobbies.GetLobbies() {
+		if len(lobby.Players()) != 1 {
+			t.Errorf("lobby %s should only contain its host", lobby.Name())
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package tests
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	kf "github.com/team-neutron-shark/keyforge-network"
+)
+
+func newChatPacket(message string) kf.GlobalChatResponsePacket {
+	packet := kf.GlobalChatResponsePacket{}
+	packet.Type = kf.PacketTypeGlobalChatResponse
+	packet.Message = message
+	return packet
+}
+
+func TestQueuedConnectionPreservesOrder(t *testing.T) {
+	connection := NewMockNetworkConnection()
+	queued := kf.NewQueuedConnection(kf.NewTCPConnection(connection), 16, kf.SlowClientDrop, time.Second)
+
+	messages := []string{"one", "two", "three", "four"}
+
+	for _, message := range messages {
+		e := queued.WritePacket(newChatPacket(message))
+
+		if e != nil {
+			t.Fatal(e.Error())
+		}
+	}
+
+	queued.Close()
+	<-queued.Done()
+
+	for _, message := range messages {
+		packet, e := kf.ReadPacket(connection)
+
+		if e != nil {
+			t.Fatal(e.Error())
+		}
+
+		if packet.(kf.GlobalChatResponsePacket).Message != message {
+			t.Errorf("expected message %s, got %s", message, packet.(kf.GlobalChatResponsePacket).Message)
+		}
+	}
+
+	if queued.Stats().Sent != uint64(len(messages)) {
+		t.Errorf("expected %d packets sent, got %d", len(messages), queued.Stats().Sent)
+	}
+}
+
+func TestQueuedConnectionDropsWhenFull(t *testing.T) {
+	serverSide, clientSide := net.Pipe()
+	defer clientSide.Close()
+
+	// Nothing reads from the client side, so the writer blocks on the first
+	// packet and the queue fills up behind it.
+	queued := kf.NewQueuedConnection(kf.NewTCPConnection(serverSide), 2, kf.SlowClientDrop, time.Second)
+	defer queued.Close()
+
+	var dropped error
+
+	for i := 0; i < 5; i++ {
+		e := queued.WritePacket(newChatPacket("spam"))
+
+		if e != nil {
+			dropped = e
+		}
+	}
+
+	if dropped != kf.ErrOutboundQueueFull {
+		t.Errorf("expected packets to be dropped, got %v", dropped)
+	}
+
+	stats := queued.Stats()
+
+	if stats.Dropped == 0 {
+		t.Error("dropped packets were not counted")
+	}
+
+	if stats.HighWater != 2 {
+		t.Errorf("expected a high water mark of 2, got %d", stats.HighWater)
+	}
+
+	if queued.Slow() {
+		t.Error("drop policy should not disconnect the client")
+	}
+}
+
+func TestQueuedConnectionDisconnectsSlowClient(t *testing.T) {
+	serverSide, clientSide := net.Pipe()
+	defer clientSide.Close()
+
+	queued := kf.NewQueuedConnection(kf.NewTCPConnection(serverSide), 1, kf.SlowClientDisconnect, time.Second)
+
+	var result error
+
+	for i := 0; i < 5 && result == nil; i++ {
+		result = queued.WritePacket(newChatPacket("spam"))
+	}
+
+	if result != kf.ErrSlowClient {
+		t.Fatalf("expected the slow client to be disconnected, got %v", result)
+	}
+
+	select {
+	case <-queued.Done():
+	case <-time.After(time.Second):
+		t.Fatal("writer did not stop after the slow client was disconnected")
+	}
+
+	if e := queued.WritePacket(newChatPacket("late")); e != kf.ErrConnectionClosed {
+		t.Errorf("expected writes after disconnect to fail, got %v", e)
+	}
+}
@@ -0,0 +1,201 @@
+package tests
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	kf "github.com/team-neutron-shark/keyforge-network"
+)
+
+func TestServerReloadSwapsCards(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cards.json")
+	e := os.WriteFile(path, []byte("[]"), 0644)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	saves := t.TempDir()
+	loader := func() (kf.ServerConfiguration, error) {
+		config := kf.DefaultServerConfiguration()
+		config.Address = ":1"
+		config.CardDataPath = path
+		config.LobbyCapacity = 4
+		config.GameSaveDirectory = saves
+		config.GameDrainTimeout = kf.Duration(50 * time.Millisecond)
+		return config, nil
+	}
+
+	server := newServer(t, ":0", kf.WithConfigLoader(loader))
+	defer server.Stop()
+
+	observer := &recordingObserver{}
+	server.Events.Subscribe(observer, kf.TopicServerReloaded)
+
+	host := kf.NewPlayer()
+	guest := kf.NewPlayer()
+	lobby := server.AddLobby(host, "reload")
+	server.Lobbies.JoinLobby(lobby, guest)
+
+	before := server.Cards()
+	game, e := server.StartGame(lobby)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	e = server.Reload()
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	if server.Cards() == before {
+		t.Error("card database was not replaced")
+	}
+
+	if game.Cards != before {
+		t.Error("running game lost its card snapshot")
+	}
+
+	if observer.Count() != 1 {
+		t.Error("reload was not announced on the event bus")
+	}
+
+	config := server.Configuration()
+
+	if config.LobbyCapacity != 4 || config.CardDataPath != path {
+		t.Error("reloaded settings were not applied")
+	}
+
+	if config.Address != ":0" {
+		t.Error("listen address should not change without a restart")
+	}
+
+	if server.AddLobby(kf.NewPlayer(), "bigger").Capacity() != 4 {
+		t.Error("new lobbies should use the reloaded capacity")
+	}
+}
+
+func TestServerReloadKeepsStateOnFailure(t *testing.T) {
+	loader := func() (kf.ServerConfiguration, error) {
+		config := kf.DefaultServerConfiguration()
+		config.CardDataPath = filepath.Join(t.TempDir(), "missing.json")
+		return config, nil
+	}
+
+	server := newServer(t, ":0", kf.WithConfigLoader(loader))
+	defer server.Stop()
+
+	before := server.Cards()
+
+	if server.Reload() == nil {
+		t.Fatal("expected reload to fail without card data")
+	}
+
+	if server.Cards() != before {
+		t.Error("failed reload replaced the card database")
+	}
+}
+
+func TestLearnCardsKeepsRunningGameCards(t *testing.T) {
+	config := kf.DefaultServerConfiguration()
+	config.Address = ":0"
+	config.DeckStoreDirectory = t.TempDir()
+	config.CardDataPath = filepath.Join(t.TempDir(), "cards.json")
+
+	e := os.WriteFile(config.CardDataPath, []byte("[]"), 0644)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	server := newServerWithConfig(t, config)
+	defer server.Stop()
+
+	host := kf.NewPlayer()
+	guest := kf.NewPlayer()
+	lobby := server.AddLobby(host, "learn")
+	server.Lobbies.JoinLobby(lobby, guest)
+
+	game, e := server.StartGame(lobby)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	before := server.Cards()
+	learned := []kf.Card{{ID: "learned-1", CardTitle: "Learned", House: "Dis", CardType: "Action", Expansion: 435, CardNumber: 901}}
+	added, e := server.LearnCards(learned)
+
+	if e != nil || added != 1 {
+		t.Fatalf("expected one card to be learned, added %d (%v)", added, e)
+	}
+
+	if server.Cards() == before || server.Cards().Count() != 1 {
+		t.Error("learned cards were not swapped in for new games")
+	}
+
+	if game.Cards != before || before.Count() != 0 {
+		t.Error("learning cards changed a running game's card database")
+	}
+
+	if added, _ = server.LearnCards(learned); added != 0 || server.Cards().Count() != 1 {
+		t.Error("known cards should not be learned again")
+	}
+}
+
+func TestServerReloadKeepsLoggingOnAuditFailure(t *testing.T) {
+	directory := t.TempDir()
+	cards := filepath.Join(directory, "cards.json")
+	logPath := filepath.Join(directory, "server.log")
+	blocker := filepath.Join(directory, "blocker")
+
+	for _, path := range []string{cards, blocker} {
+		if e := os.WriteFile(path, []byte("[]"), 0644); e != nil {
+			t.Fatal(e.Error())
+		}
+	}
+
+	loader := func() (kf.ServerConfiguration, error) {
+		config := kf.DefaultServerConfiguration()
+		config.CardDataPath = cards
+		config.Logging.Sinks = []kf.LogSinkConfiguration{{Type: "file", Path: logPath}}
+		// A file can't be opened beneath another file.
+		config.Audit.Sinks = []kf.LogSinkConfiguration{{Type: "file", Path: filepath.Join(blocker, "audit.log")}}
+		return config, nil
+	}
+
+	server := newServer(t, ":0", kf.WithConfigLoader(loader))
+	defer server.Stop()
+
+	if server.Reload() == nil {
+		t.Fatal("expected reload to fail when the audit log can't be opened")
+	}
+
+	server.Logger.Log("after the failed reload")
+	server.Logger.Flush()
+
+	if data, e := os.ReadFile(logPath); e == nil && strings.Contains(string(data), "after the failed reload") {
+		t.Error("failed reload switched logging to the new sinks")
+	}
+}
+
+func TestReloadRequiresAdmin(t *testing.T) {
+	server := newServer(t, ":0")
+	defer server.Stop()
+	server.Config.PingInterval = 0
+
+	client, _ := connectClient(server)
+	defer client.Close()
+
+	_, e := client.Reload(context.Background())
+
+	if _, ok := e.(*kf.ServerError); !ok {
+		t.Errorf("expected the reload to be refused, got %v", e)
+	}
+}
@@ -7,14 +7,15 @@ import (
 )
 
 func TestServerResponseHandleVersionRequest(t *testing.T) {
-	server := kf.NewServer(":4321")
+	server := newServer(t, ":4321")
 	connection := NewMockNetworkConnection()
+	client := kf.NewTCPConnection(connection)
 
 	versionRequestPacket := kf.VersionPacket{}
 	versionRequestPacket.Type = kf.PacketTypeVersionRequest
 	versionRequestPacket.Version = kf.ProtocolVersion
 
-	server.HandleVersionRequest(connection, versionRequestPacket)
+	server.HandleVersionRequest(client, versionRequestPacket)
 
 	versionResponsePacket, e := kf.ReadPacket(connection)
 
@@ -29,20 +30,21 @@ func TestServerResponseHandleVersionRequest(t *testing.T) {
 	server.Stop()
 }
 func TestServerResponseHandleGlobalChatRequest(t *testing.T) {
-	server := kf.NewServer(":4321")
+	server := newServer(t, ":4321")
 	player := kf.NewPlayer()
 	connection := NewMockNetworkConnection()
+	client := kf.NewTCPConnection(connection)
 
 	player.Name = "testing"
 	player.ID = kf.GenerateUUID()
-	player.Client = connection
+	player.Client = client
 	server.AddPlayer(player)
 
 	request := kf.GlobalChatRequestPacket{}
 	request.Type = kf.PacketTypeGlobalChatRequest
 	request.Message = kf.GenerateUUID()
 
-	server.HandleGlobalChatRequest(connection, request)
+	server.HandleGlobalChatRequest(client, request)
 
 	response, e := kf.ReadPacket(connection)
 
@@ -50,7 +52,7 @@ func TestServerResponseHandleGlobalChatRequest(t *testing.T) {
 		t.Error(e.Error())
 	}
 
-	if response.(kf.GlobalChatResponsePacket).Type != request.Type {
+	if response.(kf.GlobalChatResponsePacket).Type != kf.PacketTypeGlobalChatResponse {
 		t.Error("type mismatch")
 	}
 
@@ -66,19 +68,20 @@ func TestServerResponseHandleGlobalChatRequest(t *testing.T) {
 }
 
 func TestServerResponseHandlePlayerListRequest(t *testing.T) {
-	server := kf.NewServer(":4321")
+	server := newServer(t, ":4321")
 	player := kf.NewPlayer()
 	connection := NewMockNetworkConnection()
+	client := kf.NewTCPConnection(connection)
 
 	player.Name = "testing"
 	player.ID = kf.GenerateUUID()
-	player.Client = connection
+	player.Client = client
 	server.AddPlayer(player)
 
 	request := kf.PlayerListRequestPacket{}
 	request.Type = kf.PacketTypePlayerListRequest
 
-	server.HandlePlayerListRequest(connection, request)
+	server.HandlePlayerListRequest(client, request)
 
 	response, e := kf.ReadPacket(connection)
 
@@ -86,7 +89,7 @@ func TestServerResponseHandlePlayerListRequest(t *testing.T) {
 		t.Error(e.Error())
 	}
 
-	if response.(kf.PlayerListResponsePacket).Type != request.Type {
+	if response.(kf.PlayerListResponsePacket).Type != kf.PacketTypePlayerListResponse {
 		t.Error("type mismatch")
 	}
 
@@ -96,3 +99,37 @@ func TestServerResponseHandlePlayerListRequest(t *testing.T) {
 
 	server.Stop()
 }
+
+func TestServerResponseRejectsSecondLobby(t *testing.T) {
+	server := newServer(t, ":0")
+	defer server.Stop()
+	player := kf.NewPlayer()
+	client := kf.NewTCPConnection(NewMockNetworkConnection())
+
+	player.Name = "testing"
+	player.ID = kf.GenerateUUID()
+	player.Client = client
+	server.AddPlayer(player)
+
+	request := kf.CreateLobbyRequestPacket{}
+	request.Type = kf.PacketTypeCreateLobbyRequest
+	request.Name = "first lobby"
+
+	if e := server.HandleCreateLobbyRequest(client, request); e != nil {
+		t.Fatal(e.Error())
+	}
+
+	request.Name = "second lobby"
+
+	if server.HandleCreateLobbyRequest(client, request) == nil {
+		t.Error("a player already in a lobby was able to create another")
+	}
+
+	join := kf.JoinLobbyRequestPacket{}
+	join.Type = kf.PacketTypeJoinLobbyRequest
+	join.Name = "first lobby"
+
+	if server.HandleJoinLobbyRequest(client, join) == nil {
+		t.Error("a player already in a lobby was able to join another")
+	}
+}
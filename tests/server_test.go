@@ -2,32 +2,55 @@ package tests
 
 import (
 	"testing"
+	"time"
 
 	kf "github.com/team-neutron-shark/keyforge-network"
 )
 
+// newServer - Starts a server on the given address with the default
+// configuration, failing the test if it cannot be created.
+func newServer(t *testing.T, address string, options ...kf.ServerOption) *kf.Server {
+	config := kf.DefaultServerConfiguration()
+	config.Address = address
+	config.DeckStoreDirectory = t.TempDir()
+	config.GameSaveDirectory = t.TempDir()
+	config.GameDrainTimeout = kf.Duration(50 * time.Millisecond)
+
+	return newServerWithConfig(t, config, options...)
+}
+
+func newServerWithConfig(t *testing.T, config kf.ServerConfiguration, options ...kf.ServerOption) *kf.Server {
+	server, e := kf.NewServer(config, options...)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	return server
+}
+
 func TestServerAddLobby(t *testing.T) {
-	server := kf.NewServer(":4321")
+	server := newServer(t, ":4321")
 	defer server.Stop()
 	player := kf.NewPlayer()
 	name := "test lobby"
 
 	server.AddLobby(player, name)
 
-	if len(server.Lobbies) != 1 {
+	if len(server.Lobbies.GetLobbies()) != 1 {
 		t.Error("failed to add lobby to lobby array")
 	}
 }
 
 func TestServerRemoveLobby(t *testing.T) {
-	server := kf.NewServer(":4321")
+	server := newServer(t, ":4321")
 	defer server.Stop()
 	player := kf.NewPlayer()
 	name := "test lobby"
 
 	server.AddLobby(player, name)
 
-	if len(server.Lobbies) != 1 {
+	if len(server.Lobbies.GetLobbies()) != 1 {
 		t.Error("failed to add lobby to lobby array")
 	}
 
@@ -39,20 +62,20 @@ func TestServerRemoveLobby(t *testing.T) {
 
 	server.RemoveLobby(lobby)
 
-	if len(server.Lobbies) != 0 {
+	if len(server.Lobbies.GetLobbies()) != 0 {
 		t.Error("failed to remove lobby from lobby array")
 	}
 }
 
 func TestServerFindLobbyByName(t *testing.T) {
-	server := kf.NewServer(":4321")
+	server := newServer(t, ":4321")
 	defer server.Stop()
 	player := kf.NewPlayer()
 	name := "test lobby"
 
 	server.AddLobby(player, name)
 
-	if len(server.Lobbies) != 1 {
+	if len(server.Lobbies.GetLobbies()) != 1 {
 		t.Error("failed to add lobby to lobby array")
 	}
 
@@ -68,14 +91,14 @@ func TestServerFindLobbyByName(t *testing.T) {
 }
 
 func TestServerFindLobbyByID(t *testing.T) {
-	server := kf.NewServer(":4321")
+	server := newServer(t, ":4321")
 	defer server.Stop()
 	player := kf.NewPlayer()
 	name := "test lobby"
 
 	server.AddLobby(player, name)
 
-	if len(server.Lobbies) != 1 {
+	if len(server.Lobbies.GetLobbies()) != 1 {
 		t.Error("failed to add lobby to lobby array")
 	}
 
@@ -105,40 +128,40 @@ func TestServerFindLobbyByID(t *testing.T) {
 }
 
 func TestServerAddPlayer(t *testing.T) {
-	server := kf.NewServer(":4321")
+	server := newServer(t, ":4321")
 	defer server.Stop()
 	player := kf.NewPlayer()
 
 	server.AddPlayer(player)
 
-	if len(server.Clients) != 1 {
+	if len(server.Players.GetPlayers()) != 1 {
 		t.Error("server does not have the correct number of players")
 	}
 }
 
 func TestServerRemovePlayer(t *testing.T) {
-	server := kf.NewServer(":4321")
+	server := newServer(t, ":4321")
 	defer server.Stop()
 	player := kf.NewPlayer()
 
 	server.AddPlayer(player)
 
-	if len(server.Clients) != 1 {
+	if len(server.Players.GetPlayers()) != 1 {
 		t.Error("server did not add the correct number of players")
 	}
 
 	server.RemovePlayer(player)
 
-	if len(server.Clients) != 0 {
+	if len(server.Players.GetPlayers()) != 0 {
 		t.Error("server did not remove the correct number of players")
 	}
 }
 
 func TestServerFindPlayerByConnection(t *testing.T) {
-	server := kf.NewServer(":4321")
+	server := newServer(t, ":4321")
 	defer server.Stop()
 	player := kf.NewPlayer()
-	connection := MockNetworkConnection{}
+	connection := kf.NewTCPConnection(MockNetworkConnection{})
 
 	player.Client = connection
 	server.AddPlayer(player)
@@ -159,7 +182,7 @@ func TestServerFindPlayerByConnection(t *testing.T) {
 }
 
 func TestServerPlayerExists(t *testing.T) {
-	server := kf.NewServer(":4321")
+	server := newServer(t, ":4321")
 	defer server.Stop()
 	player := kf.NewPlayer()
 
@@ -172,7 +195,7 @@ func TestServerPlayerExists(t *testing.T) {
 }
 
 func TestServerPlayerHasLobby(t *testing.T) {
-	server := kf.NewServer(":4321")
+	server := newServer(t, ":4321")
 	defer server.Stop()
 	player := kf.NewPlayer()
 
@@ -183,3 +206,34 @@ func TestServerPlayerHasLobby(t *testing.T) {
 		t.Error("player does not have a lobby")
 	}
 }
+
+func TestServersAreIsolated(t *testing.T) {
+	first := newServer(t, ":0")
+	defer first.Stop()
+	second := newServer(t, ":0")
+	defer second.Stop()
+	player := kf.NewPlayer()
+
+	first.AddPlayer(player)
+	first.AddLobby(player, "isolated")
+
+	if second.PlayerExists(player) {
+		t.Error("player leaked into another server")
+	}
+
+	if _, e := second.FindLobbyByName("isolated"); e == nil {
+		t.Error("lobby leaked into another server")
+	}
+}
+
+func TestServerWithLobbyManager(t *testing.T) {
+	lobbies := kf.NewLobbyManager()
+	server := newServer(t, ":0", kf.WithLobbyManager(lobbies))
+	defer server.Stop()
+
+	server.AddLobby(kf.NewPlayer(), "shared")
+
+	if len(lobbies.GetLobbies()) != 1 {
+		t.Error("server did not use the injected lobby manager")
+	}
+}
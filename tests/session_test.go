@@ -0,0 +1,123 @@
+package tests
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	kf "github.com/team-neutron-shark/keyforge-network"
+)
+
+// dropPlayer - Logs a player in over a pipe, puts them in a lobby and then
+// drops the connection, returning once the server has noticed.
+func dropPlayer(t *testing.T, server *kf.Server, name string) (*kf.Player, *kf.Session) {
+	serverSide, clientSide := net.Pipe()
+	connection := kf.NewTCPConnection(serverSide)
+
+	player := kf.NewPlayer()
+	player.Name = name
+	player.ID = kf.GenerateUUID()
+	player.Client = connection
+	server.Players.AddPlayer(player)
+	server.Lobbies.AddLobby(player, name)
+	session := server.Sessions.CreateSession(player)
+
+	done := make(chan struct{})
+
+	go func() {
+		server.ReadLoop(connection)
+		close(done)
+	}()
+
+	clientSide.Close()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("read loop did not exit after the connection dropped")
+	}
+
+	return player, session
+}
+
+func TestSessionResume(t *testing.T) {
+	server := newServer(t, ":0")
+	defer server.Stop()
+	server.Config.PingInterval = 0
+	server.Config.SessionGracePeriod = kf.Duration(time.Minute)
+
+	player, session := dropPlayer(t, server, "resume lobby")
+
+	if !server.Players.PlayerExists(player) {
+		t.Fatal("player was removed before the grace period ended")
+	}
+
+	connection := NewMockNetworkConnection()
+	client := kf.NewTCPConnection(connection)
+
+	request := kf.ResumeRequestPacket{}
+	request.Type = kf.PacketTypeResumeRequest
+	request.Session = session.Token
+
+	e := server.HandleResumeRequest(client, request)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	if player.Connection() != client {
+		t.Error("player was not rebound to the new connection")
+	}
+
+	response, e := kf.ReadPacket(connection)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	if !response.(kf.ResumeResponsePacket).Success {
+		t.Error("resume response did not report success")
+	}
+
+	snapshot, e := kf.ReadPacket(connection)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	lobby := snapshot.(kf.StateSnapshotPacket).Lobby
+
+	if lobby == nil || lobby.Name != "resume lobby" {
+		t.Error("snapshot did not contain the player's lobby")
+	}
+}
+
+func TestSessionExpires(t *testing.T) {
+	server := newServer(t, ":0")
+	defer server.Stop()
+	server.Config.PingInterval = 0
+	server.Config.SessionGracePeriod = kf.Duration(10 * time.Millisecond)
+
+	player, session := dropPlayer(t, server, "expire lobby")
+
+	time.Sleep(100 * time.Millisecond)
+
+	if server.Players.PlayerExists(player) {
+		t.Error("player was not removed after the grace period")
+	}
+
+	if server.PlayerHasLobby(player) {
+		t.Error("player was not removed from their lobby after the grace period")
+	}
+
+	connection := NewMockNetworkConnection()
+	request := kf.ResumeRequestPacket{}
+	request.Type = kf.PacketTypeResumeRequest
+	request.Session = session.Token
+
+	e := server.HandleResumeRequest(kf.NewTCPConnection(connection), request)
+
+	if e == nil {
+		t.Error("expired session should not be resumable")
+	}
+}
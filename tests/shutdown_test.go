@@ -0,0 +1,185 @@
+package tests
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	kf "github.com/team-neutron-shark/keyforge-network"
+)
+
+func TestServerShutdown(t *testing.T) {
+	server := newServer(t, ":4322")
+
+	var connection net.Conn
+	var e error
+
+	// The listener starts in the background, so give it a moment.
+	for i := 0; i < 50; i++ {
+		connection, e = net.Dial("tcp4", "127.0.0.1:4322")
+
+		if e == nil {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	defer connection.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	// Wait until the server has picked up the connection before stopping.
+	for i := 0; i < 50 && server.OutboundQueueStats().Connections == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	e = server.Shutdown(ctx)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	packet, e := kf.ReadPacket(connection)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	if _, ok := packet.(kf.ServerShutdownPacket); !ok {
+		t.Errorf("expected a shutdown packet, got %T", packet)
+	}
+
+	if server.IsRunning() {
+		t.Error("server still reports running after shutdown")
+	}
+
+	listener, e := net.Listen("tcp4", ":4322")
+
+	if e != nil {
+		t.Fatalf("port was not released: %s", e.Error())
+	}
+
+	listener.Close()
+}
+
+func TestServerShutdownSavesSuspendedGames(t *testing.T) {
+	config := kf.DefaultServerConfiguration()
+	config.Address = ":0"
+	config.DeckStoreDirectory = t.TempDir()
+	config.GameDrainTimeout = kf.Duration(10 * time.Millisecond)
+	config.GameSaveDirectory = t.TempDir()
+
+	server := newServerWithConfig(t, config)
+
+	// Neither player has a connection, as while their sessions are
+	// suspended waiting for them to reconnect.
+	host := kf.NewPlayer()
+	host.ID = kf.GenerateUUID()
+	guest := kf.NewPlayer()
+	guest.ID = kf.GenerateUUID()
+	lobby := server.AddLobby(host, "suspended game")
+	server.Lobbies.JoinLobby(lobby, guest)
+
+	game, e := server.StartGame(lobby)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	if games := server.RunningGames(); len(games) != 1 || games[0] != game {
+		t.Fatalf("expected the lobby's game to be running, got %v", games)
+	}
+
+	server.Stop()
+
+	files, e := ioutil.ReadDir(config.GameSaveDirectory)
+
+	if e != nil || len(files) != 1 {
+		t.Errorf("expected the game to be saved, found %d files (%v)", len(files), e)
+	}
+}
+
+func TestServerShutdownLetsGamesFinish(t *testing.T) {
+	config := kf.DefaultServerConfiguration()
+	config.Address = ":0"
+	config.PingInterval = 0
+	config.DeckStoreDirectory = t.TempDir()
+	config.GameDrainTimeout = kf.Duration(5 * time.Second)
+	config.GameSaveDirectory = t.TempDir()
+
+	server := newServerWithConfig(t, config)
+	client, connection := connectClient(server)
+	defer client.Close()
+
+	host := kf.NewPlayer()
+	host.ID = kf.GenerateUUID()
+	host.Client = connection
+	server.Players.AddPlayer(host)
+
+	guest := kf.NewPlayer()
+	guest.ID = kf.GenerateUUID()
+	guest.Client = kf.NewTCPConnection(NewMockNetworkConnection())
+	lobby := server.AddLobby(host, "finishing game")
+	server.Lobbies.JoinLobby(lobby, guest)
+
+	if _, e := server.StartGame(lobby); e != nil {
+		t.Fatal(e.Error())
+	}
+
+	// Make sure the server is reading the connection before stopping.
+	if _, e := client.Version(context.Background()); e != nil {
+		t.Fatal(e.Error())
+	}
+
+	stopped := make(chan error, 1)
+	started := time.Now()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		stopped <- server.Shutdown(ctx)
+	}()
+
+	select {
+	case packet := <-client.Packets():
+		if _, ok := packet.(kf.ServerShutdownPacket); !ok {
+			t.Fatalf("expected a shutdown packet, got %T", packet)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("client was not told about the shutdown")
+	}
+
+	// Leaving ends the game, which the server must still be reading for
+	// once it is waiting for games to finish.
+	time.Sleep(100 * time.Millisecond)
+
+	if _, e := client.Version(context.Background()); e != nil {
+		t.Fatal(e.Error())
+	}
+
+	if _, e := client.LeaveLobby(context.Background(), "finishing game"); e != nil {
+		t.Fatal(e.Error())
+	}
+
+	if e := <-stopped; e != nil {
+		t.Fatal(e.Error())
+	}
+
+	if elapsed := time.Since(started); elapsed >= time.Duration(config.GameDrainTimeout) {
+		t.Errorf("shutdown waited out the drain timeout (%s) for a finished game", elapsed)
+	}
+
+	files, e := ioutil.ReadDir(config.GameSaveDirectory)
+
+	if e != nil || len(files) != 0 {
+		t.Errorf("expected the finished game not to be saved, found %d files (%v)", len(files), e)
+	}
+}
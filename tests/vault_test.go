@@ -0,0 +1,236 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	kf "github.com/team-neutron-shark/keyforge-network"
+)
+
+func newFakeVault(t *testing.T) *kf.FakeVault {
+	vault, e := kf.NewFakeVaultFromFile("test_data/vault.json")
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	return vault
+}
+
+func TestVaultLogin(t *testing.T) {
+	vault := newFakeVault(t)
+	defer vault.Close()
+
+	user, e := vault.Client().Login(context.Background(), "archon", "hunter2")
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	if user.ID != "user-1" || user.Token != "token-1" {
+		t.Errorf("unexpected user %+v", user)
+	}
+
+	_, e = vault.Client().Login(context.Background(), "archon", "wrong")
+
+	if !errors.Is(e, kf.ErrUnauthorized) {
+		t.Errorf("expected a bad password to be unauthorized, got %v", e)
+	}
+}
+
+func TestVaultRetrieveDeck(t *testing.T) {
+	vault := newFakeVault(t)
+	defer vault.Close()
+
+	client := vault.Client()
+	user, e := client.RetrieveProfile(context.Background(), "token-1")
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	deck, e := client.RetrieveDeck(context.Background(), &user, "deck-1")
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	if len(deck.Cards) != 3 || deck.Cards[1].CardTitle != "Troll" {
+		t.Error("deck cards were not linked")
+	}
+
+	if len(deck.Houses) != 3 {
+		t.Error("deck houses were not retrieved")
+	}
+
+	_, e = client.RetrieveDeck(context.Background(), &user, "missing")
+
+	if !errors.Is(e, kf.ErrNotFound) {
+		t.Errorf("expected an unknown deck to be not found, got %v", e)
+	}
+}
+
+func TestVaultSearchDecks(t *testing.T) {
+	vault := newFakeVault(t)
+	defer vault.Close()
+
+	client := vault.Client()
+	user, _ := client.RetrieveProfile(context.Background(), "token-1")
+
+	result, e := client.SearchDecks(context.Background(), &user, &kf.DeckQuery{Query: "saffron", PageSize: 1, Page: 2})
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	if result.Count != 2 || len(result.Decks) != 1 || result.Decks[0].ID != "deck-2" {
+		t.Errorf("unexpected search result %+v", result)
+	}
+
+	owned, e := client.RetrieveDecksFromProfile(context.Background(), &user)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	if owned.Count != 1 || owned.Decks[0].ID != "deck-1" {
+		t.Error("profile decks were not listed")
+	}
+}
+
+func TestServerLoginWithFakeVault(t *testing.T) {
+	vault := newFakeVault(t)
+	defer vault.Close()
+
+	server := newServer(t, ":0", kf.WithVaultClient(vault.Client()))
+	defer server.Stop()
+	server.Config.PingInterval = 0
+
+	client, _ := connectClient(server)
+	defer client.Close()
+
+	response, e := client.Login(context.Background(), "archon", "user-1", "token-1")
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	if response.Session == "" {
+		t.Error("login did not return a session")
+	}
+
+	if server.Players.Count() != 1 {
+		t.Error("player was not added")
+	}
+}
+
+func TestVaultRetries(t *testing.T) {
+	vault := newFakeVault(t)
+	defer vault.Close()
+
+	client := vault.Client()
+	vault.FailNext(2, 503, "")
+
+	user, e := client.RetrieveProfile(context.Background(), "token-1")
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	if user.ID != "user-1" || vault.Requests() != 3 {
+		t.Errorf("expected success on the third attempt, made %d", vault.Requests())
+	}
+
+	vault.FailNext(10, 429, "0")
+	_, e = client.RetrieveProfile(context.Background(), "token-1")
+
+	if !errors.Is(e, kf.ErrRateLimited) {
+		t.Errorf("expected rate limiting once retries ran out, got %v", e)
+	}
+
+	if vault.Requests() != 3+client.MaxRetries+1 {
+		t.Errorf("expected %d attempts, made %d", client.MaxRetries+1, vault.Requests()-3)
+	}
+
+	vault.FailNext(0, 0, "")
+	_, e = client.RetrieveProfile(context.Background(), "bad-token")
+
+	if !errors.Is(e, kf.ErrUnauthorized) {
+		t.Errorf("expected a bad token to be unauthorized, got %v", e)
+	}
+}
+
+func TestVaultContextCancelled(t *testing.T) {
+	vault := newFakeVault(t)
+	defer vault.Close()
+
+	client := vault.Client()
+	client.RetryDelay = time.Minute
+	vault.FailNext(1, 500, "")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, e := client.RetrieveProfile(ctx, "token-1")
+
+	if !errors.Is(e, context.DeadlineExceeded) {
+		t.Errorf("expected the deadline to end the retries, got %v", e)
+	}
+
+	if time.Since(start) > 5*time.Second {
+		t.Error("retry ignored the context")
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := kf.NewRateLimiter(50, 2)
+	start := time.Now()
+
+	for i := 0; i < 4; i++ {
+		e := limiter.Wait(context.Background())
+
+		if e != nil {
+			t.Fatal(e.Error())
+		}
+	}
+
+	// Two calls go straight through, the other two wait 20ms each.
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("calls were not spaced out, took %s", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if e := limiter.Wait(ctx); !errors.Is(e, context.Canceled) {
+		t.Errorf("expected a cancelled wait to fail, got %v", e)
+	}
+}
+
+func TestServerLoginVaultErrors(t *testing.T) {
+	vault := newFakeVault(t)
+	defer vault.Close()
+
+	server := newServer(t, ":0", kf.WithVaultClient(vault.Client()))
+	defer server.Stop()
+
+	client, _ := connectClient(server)
+	defer client.Close()
+
+	_, e := client.Login(context.Background(), "archon", "user-1", "bad-token")
+
+	if e == nil || !strings.Contains(e.Error(), "rejected your token") {
+		t.Errorf("expected a rejected token message, got %v", e)
+	}
+
+	vault.FailNext(10, 503, "0")
+	_, e = client.Login(context.Background(), "archon", "user-1", "token-1")
+
+	if e == nil || !strings.Contains(e.Error(), "unavailable") {
+		t.Errorf("expected an unavailable message, got %v", e)
+	}
+}
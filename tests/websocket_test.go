@@ -0,0 +1,86 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	kf "github.com/team-neutron-shark/keyforge-network"
+)
+
+func TestWebSocketReadWritePacket(t *testing.T) {
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		connection, e := kf.UpgradeWebSocket(w, r)
+
+		if e != nil {
+			return
+		}
+
+		defer connection.Close()
+
+		// Echo every packet straight back to the client.
+		for {
+			packet, e := connection.ReadPacket()
+
+			if e != nil {
+				return
+			}
+
+			connection.WritePacket(packet)
+		}
+	}))
+	defer httpServer.Close()
+
+	address := "ws://" + strings.TrimPrefix(httpServer.URL, "http://") + "/ws"
+	connection, e := kf.DialWebSocket(address)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	defer connection.Close()
+
+	packet := kf.GlobalChatRequestPacket{}
+	packet.Type = kf.PacketTypeGlobalChatRequest
+	packet.Message = strings.Repeat("a", 300)
+
+	e = connection.WritePacket(packet)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	response, e := connection.ReadPacket()
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	if response.(kf.GlobalChatRequestPacket).Type != kf.PacketTypeGlobalChatRequest {
+		t.Error("packet type not read correctly")
+	}
+
+	if response.(kf.GlobalChatRequestPacket).Message != packet.Message {
+		t.Error("packet message not read correctly")
+	}
+}
+
+func TestWebSocketRejectsPlainHTTP(t *testing.T) {
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		kf.UpgradeWebSocket(w, r)
+	}))
+	defer httpServer.Close()
+
+	response, e := http.Get(httpServer.URL)
+
+	if e != nil {
+		t.Fatal(e.Error())
+	}
+
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusUpgradeRequired {
+		t.Errorf("expected status %d, got %d", http.StatusUpgradeRequired, response.StatusCode)
+	}
+}
@@ -1,17 +1,11 @@
 package kfnetwork
 
 import (
-	"encoding/json"
-	"io/ioutil"
 	"math/rand"
-	"os"
 	"strings"
 	"time"
 )
 
-type ServerConfiguration struct {
-}
-
 func GenerateUUID() string {
 	var buffer []byte
 	const choices = "abcdef0123456789"
@@ -30,39 +24,6 @@ func GenerateUUID() string {
 	return string(buffer)
 }
 
-func LoadConfig(filename string) (ServerConfiguration, error) {
-	config := ServerConfiguration{}
-
-	bytes, e := ioutil.ReadFile(filename)
-
-	if e != nil {
-		return config, e
-	}
-
-	e = json.Unmarshal(bytes, &config)
-
-	return config, e
-}
-
-func SaveConfig(config ServerConfiguration, filename string) error {
-	file, e := os.Create(filename)
-	defer file.Close()
-
-	if e != nil {
-		return e
-	}
-
-	bytes, e := json.MarshalIndent(config, "", "    ")
-
-	if e != nil {
-		return e
-	}
-
-	_, e = file.WriteString(string(bytes))
-
-	return e
-}
-
 // HouseExists - Determine whether a house is present in an array of house
 // names.
 func HouseExists(array []string, house string) bool {
@@ -1,14 +1,19 @@
-
 package kfnetwork
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type Credentials struct {
@@ -38,24 +43,24 @@ type VaultUser struct {
 }
 
 type PartialDeckJSON struct {
-	Name          string   `json:"name"`
-	Expansion     int      `json:"expansion"`
-	Chains        int      `json:"chains"`
-	Wins          int      `json:"wins"`
-	Losses        int      `json:"losses"`
-	ID            string   `json:"id"`
-	IsMyDeck      bool     `json:"is_my_deck"`
-	Notes         []string `json:"notes"`
-	IsMyFavorite  bool     `json:"is_my_favorite"`
-	IsOnWatchList bool     `json:"is_on_my_watchlist"`
-	CasualWins    int      `json:"casual_wins"`
-	CasualLosses  int      `json:"casual_losses"`
-	CardList      []string `json:"cards"`
+	Name          string           `json:"name"`
+	Expansion     int              `json:"expansion"`
+	Chains        int              `json:"chains"`
+	Wins          int              `json:"wins"`
+	Losses        int              `json:"losses"`
+	ID            string           `json:"id"`
+	IsMyDeck      bool             `json:"is_my_deck"`
+	Notes         []string         `json:"notes"`
+	IsMyFavorite  bool             `json:"is_my_favorite"`
+	IsOnWatchList bool             `json:"is_on_my_watchlist"`
+	CasualWins    int              `json:"casual_wins"`
+	CasualLosses  int              `json:"casual_losses"`
+	CardList      []string         `json:"cards"`
+	Links         FullDeckLinkJSON `json:"_links"`
 }
 
 type FullDeckJSON struct {
 	PartialDeckJSON
-	Links FullDeckLinkJSON `json:"_links"`
 }
 
 type FullDeckLinkJSON struct {
@@ -73,8 +78,9 @@ type SearchVaultUserJSON struct {
 }
 
 type PartialDeckSearchJSON struct {
-	Count int               `json:"count"`
-	Decks []PartialDeckJSON `json:"data"`
+	Count  int               `json:"count"`
+	Decks  []PartialDeckJSON `json:"data"`
+	Linked DeckLinkJSON      `json:"_linked"`
 }
 
 type SearchDeckLink struct {
@@ -98,6 +104,27 @@ type HouseJSON struct {
 	Image string `json:"image"`
 }
 
+// DefaultDeckPageSize - How many decks are asked for at a time when a
+// query doesn't say.
+const DefaultDeckPageSize = 25
+
+// DeckCardFilter - Whether a deck search wants decks with a kind of card,
+// decks without it, or doesn't care.
+type DeckCardFilter int
+
+const (
+	// DeckCardsAny - Doesn't filter on the kind of card.
+	DeckCardsAny DeckCardFilter = iota
+	// DeckCardsRequired - Only decks with at least one such card.
+	DeckCardsRequired
+	// DeckCardsExcluded - Only decks without any such card.
+	DeckCardsExcluded
+)
+
+// DeckQuery - A deck search. Queries are plain values: building the query
+// string leaves them untouched, so one query can be reused for as many
+// searches as needed. Houses and Expansion are filtered by the Vault,
+// Maverick and Legacy by the client from the linked card data.
 type DeckQuery struct {
 	Page          int
 	PageSize      int
@@ -107,53 +134,341 @@ type DeckQuery struct {
 	MinimumChains int
 	MaximumChains int
 	Ordering      string
-	Values        url.Values
+	// Houses - Only decks with every one of these houses.
+	Houses []string
+	// Expansion - Only decks from this expansion, by its Vault number.
+	Expansion int
+	// Maverick - Filters on cards played outside their usual house.
+	Maverick DeckCardFilter
+	// Legacy - Filters on cards from an earlier expansion than the deck.
+	Legacy DeckCardFilter
+	// Values - Extra parameters sent as they are.
+	Values url.Values
 }
 
-func (d *DeckQuery) GetQueryString() (string, error) {
-	if d.Values == nil {
-		d.Values = url.Values{}
-	}
+// GetQueryString - Returns the query string for the query's page. Page
+// defaults to the first and PageSize to DefaultDeckPageSize.
+func (d DeckQuery) GetQueryString() (string, error) {
+	values := copyValues(d.Values)
+	page := d.Page
+	pageSize := d.PageSize
 
-	if d.Page == 0 {
-		d.Page = 1
+	if page == 0 {
+		page = 1
 	}
 
-	if d.PageSize == 0 {
-		d.PageSize = 1
+	if pageSize == 0 {
+		pageSize = DefaultDeckPageSize
 	}
 
-	page := strconv.Itoa(d.Page)
-	pageSize := strconv.Itoa(d.PageSize)
+	if page < 0 || pageSize < 0 {
+		return "", errors.New("deck query page and page size must not be negative")
+	}
 
-	d.Values.Add("page", page)
-	d.Values.Add("page_size", pageSize)
-	d.Values.Add("search", d.Query)
+	values.Set("page", strconv.Itoa(page))
+	values.Set("page_size", strconv.Itoa(pageSize))
+	values.Set("search", d.Query)
 
 	if d.MinimumChains > 0 && d.MaximumChains > 0 && d.MaximumChains >= d.MinimumChains {
 		chainString := fmt.Sprintf("%d,%d", d.MinimumChains, d.MaximumChains)
-		d.Values.Add("chains", chainString)
+		values.Set("chains", chainString)
 	}
 
 	if d.MinimumLevel > 0 && d.MaximumLevel > 0 && d.MaximumLevel >= d.MinimumLevel {
 		levelString := fmt.Sprintf("%d,%d", d.MinimumLevel, d.MaximumLevel)
-		d.Values.Add("power_level", levelString)
+		values.Set("power_level", levelString)
 	}
 
 	if len(d.Ordering) > 0 {
-		d.Values.Add("ordering", d.Ordering)
+		values.Set("ordering", d.Ordering)
+	}
+
+	if len(d.Houses) > 0 {
+		values.Set("houses", strings.Join(d.Houses, ","))
+	}
+
+	if d.Expansion > 0 {
+		values.Set("expansion", strconv.Itoa(d.Expansion))
+	}
+
+	// The card data is only needed to filter on it.
+	if d.Maverick != DeckCardsAny || d.Legacy != DeckCardsAny {
+		values.Set("links", "cards")
+	}
+
+	return values.Encode(), nil
+}
+
+// copyValues - Returns a copy of the values which can be changed without
+// touching the original.
+func copyValues(values url.Values) url.Values {
+	copied := url.Values{}
+
+	for key, value := range values {
+		copied[key] = append([]string(nil), value...)
+	}
+
+	return copied
+}
+
+// Matches - Determine whether a deck from a search passes the filters the
+// Vault can't apply itself, using the cards linked to the search results.
+func (d DeckQuery) Matches(deck PartialDeckJSON, linked []Card) bool {
+	if d.Maverick == DeckCardsAny && d.Legacy == DeckCardsAny {
+		return true
+	}
+
+	cards := make(map[string]Card)
+
+	for _, card := range linked {
+		cards[card.ID] = card
+	}
+
+	maverick := false
+	legacy := false
+
+	for _, id := range deck.Links.CardList {
+		card, ok := cards[id]
+
+		if !ok {
+			continue
+		}
+
+		maverick = maverick || card.IsMaverick
+		legacy = legacy || (card.Expansion != 0 && card.Expansion != deck.Expansion)
+	}
+
+	return d.Maverick.allows(maverick) && d.Legacy.allows(legacy)
+}
+
+func (f DeckCardFilter) allows(present bool) bool {
+	switch f {
+	case DeckCardsRequired:
+		return present
+	case DeckCardsExcluded:
+		return !present
+	}
+
+	return true
+}
+
+// ErrUnauthorized - The Vault rejected the credentials or API token.
+var ErrUnauthorized = errors.New("vault: unauthorized")
+
+// ErrNotFound - The Vault has no such user or deck.
+var ErrNotFound = errors.New("vault: not found")
+
+// ErrRateLimited - The Vault is throttling requests and kept doing so after
+// every retry.
+var ErrRateLimited = errors.New("vault: rate limited")
+
+// ErrVaultUnavailable - The Vault answered with a server error, or not at
+// all, after every retry.
+var ErrVaultUnavailable = errors.New("vault: unavailable")
+
+// VaultError - A failed Vault request. Err is one of the errors above, or
+// the underlying network error, so callers can test for it with errors.Is.
+type VaultError struct {
+	StatusCode int
+	Path       string
+	Err        error
+}
+
+func (v *VaultError) Error() string {
+	if v.StatusCode == 0 {
+		return fmt.Sprintf("%s (%s)", v.Err.Error(), v.Path)
+	}
+
+	return fmt.Sprintf("%s (%d %s)", v.Err.Error(), v.StatusCode, v.Path)
+}
+
+// Unwrap - Returns the error the request failed with.
+func (v *VaultError) Unwrap() error {
+	return v.Err
+}
+
+// vaultStatusError - Returns the error matching an HTTP status, or nil for
+// a success.
+func vaultStatusError(status int) error {
+	switch {
+	case status >= 200 && status <= 299:
+		return nil
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ErrUnauthorized
+	case status == http.StatusNotFound:
+		return ErrNotFound
+	case status == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case status >= 500:
+		return ErrVaultUnavailable
+	}
+
+	return fmt.Errorf("vault: unexpected status %s", http.StatusText(status))
+}
+
+// VaultClient - Talks to the KeyForge Vault on the server's behalf. The
+// server receives one through WithVaultClient, so tests and offline
+// development can point it at a FakeVault instead of the real thing. Every
+// call gives up once its context is done.
+type VaultClient interface {
+	// Login - Signs in with an Asmodee account, returning the user along
+	// with the API token used for the other calls.
+	Login(ctx context.Context, userName, password string) (VaultUser, error)
+	// RetrieveProfile - Returns the user owning an API token.
+	RetrieveProfile(ctx context.Context, token string) (VaultUser, error)
+	// SearchDecks - Searches every deck in the Vault.
+	SearchDecks(ctx context.Context, vaultUser *VaultUser, deckQuery *DeckQuery) (PartialDeckSearchJSON, error)
+	// RetrieveDeck - Returns a deck along with its card data.
+	RetrieveDeck(ctx context.Context, vaultUser *VaultUser, deckID string) (Deck, error)
+	// RetrieveDecksFromProfile - Lists the decks the user has registered.
+	RetrieveDecksFromProfile(ctx context.Context, vaultUser *VaultUser) (PartialDeckSearchJSON, error)
+}
+
+// VaultConfiguration - Where the Vault lives, how long to wait for it and
+// how hard to push it.
+type VaultConfiguration struct {
+	// BaseURL - The Vault website, which also serves the API.
+	BaseURL string `json:"base_url"`
+	// AccountURL - The Asmodee account site users sign in through.
+	AccountURL string `json:"account_url"`
+	// Timeout - How long a single request may take.
+	Timeout Duration `json:"timeout"`
+	// MaxRetries - How many times a request is retried after a server
+	// error, a rate limit or a network failure.
+	MaxRetries int `json:"max_retries"`
+	// RetryDelay - The wait before the first retry, doubled for each retry
+	// after that.
+	RetryDelay Duration `json:"retry_delay"`
+	// RateLimit - The most requests per second sent to the Vault. Zero
+	// means no limit.
+	RateLimit float64 `json:"rate_limit"`
+	// RateBurst - How many requests may be sent at once before the rate
+	// limit applies.
+	RateBurst int `json:"rate_burst"`
+}
+
+// DefaultVaultConfiguration - Returns the settings for the real Vault.
+func DefaultVaultConfiguration() VaultConfiguration {
+	config := VaultConfiguration{}
+	config.BaseURL = "https://www.keyforgegame.com"
+	config.AccountURL = "https://account.asmodee.net"
+	config.Timeout = Duration(10 * time.Second)
+	config.MaxRetries = 3
+	config.RetryDelay = Duration(250 * time.Millisecond)
+	config.RateLimit = 5
+	config.RateBurst = 10
+	return config
+}
+
+func (c VaultConfiguration) problems(prefix string) []string {
+	problems := []string{}
+	urls := []struct {
+		name  string
+		value string
+	}{
+		{"base_url", c.BaseURL},
+		{"account_url", c.AccountURL},
+	}
+
+	for _, u := range urls {
+		parsed, e := url.Parse(u.value)
+
+		if e != nil || parsed.Scheme == "" || parsed.Host == "" {
+			problems = append(problems, fmt.Sprintf("%s.%s %q must be an absolute URL", prefix, u.name, u.value))
+		}
+	}
+
+	if c.Timeout < 0 {
+		problems = append(problems, prefix+".timeout must not be negative")
+	}
+
+	if c.MaxRetries < 0 {
+		problems = append(problems, prefix+".max_retries must not be negative")
+	}
+
+	if c.RetryDelay < 0 {
+		problems = append(problems, prefix+".retry_delay must not be negative")
+	}
+
+	if c.RateLimit < 0 {
+		problems = append(problems, prefix+".rate_limit must not be negative")
 	}
 
-	return d.Values.Encode(), nil
+	if c.RateLimit > 0 && c.RateBurst < 1 {
+		problems = append(problems, prefix+".rate_burst must be at least 1")
+	}
+
+	return problems
+}
+
+// vaultNonce - The nonce the Vault's own web client signs in with.
+const vaultNonce = "4HM~Z5f8"
+
+// maxRetryDelay - The longest a client waits between two attempts, whatever
+// the backoff or the Vault's Retry-After header says.
+const maxRetryDelay = 30 * time.Second
+
+// HTTPVaultClient - VaultClient implementation which makes HTTP requests to
+// the Vault at BaseURL, signing in through AccountURL. Requests failing with
+// a server error, a rate limit or a network error are retried up to
+// MaxRetries times with exponential backoff, and every attempt waits its
+// turn with the rate limiter.
+type HTTPVaultClient struct {
+	BaseURL    string
+	AccountURL string
+	Timeout    time.Duration
+	MaxRetries int
+	RetryDelay time.Duration
+	Limiter    *RateLimiter
+	client     *http.Client
 }
 
-func Login(userName, password string) (VaultUser, error) {
+// NewHTTPVaultClient - Returns a client for the Vault at baseURL. Requests
+// are made with the given http.Client, or a new one if it is nil, and each
+// attempt is abandoned after timeout. A timeout of zero means no limit.
+// AccountURL, retries and rate limiting are set as in the default
+// configuration and can be changed afterwards.
+func NewHTTPVaultClient(baseURL string, client *http.Client, timeout time.Duration) *HTTPVaultClient {
+	if client == nil {
+		client = &http.Client{}
+	}
+
+	defaults := DefaultVaultConfiguration()
+
+	vault := new(HTTPVaultClient)
+	vault.BaseURL = strings.TrimRight(baseURL, "/")
+	vault.AccountURL = defaults.AccountURL
+	vault.Timeout = timeout
+	vault.MaxRetries = defaults.MaxRetries
+	vault.RetryDelay = time.Duration(defaults.RetryDelay)
+	vault.Limiter = NewRateLimiter(defaults.RateLimit, defaults.RateBurst)
+	vault.client = client
+	return vault
+}
+
+// NewHTTPVaultClientFromConfig - Returns a client using the settings from
+// the configuration.
+func NewHTTPVaultClientFromConfig(config VaultConfiguration) *HTTPVaultClient {
+	vault := NewHTTPVaultClient(config.BaseURL, nil, time.Duration(config.Timeout))
+	vault.AccountURL = strings.TrimRight(config.AccountURL, "/")
+	vault.MaxRetries = config.MaxRetries
+	vault.RetryDelay = time.Duration(config.RetryDelay)
+	vault.Limiter = NewRateLimiter(config.RateLimit, config.RateBurst)
+	return vault
+}
+
+// DefaultVaultClient - Client for the real Vault, used by the package level
+// Login, SearchDecks and friends.
+var DefaultVaultClient VaultClient = NewHTTPVaultClientFromConfig(DefaultVaultConfiguration())
+
+func (v *HTTPVaultClient) Login(ctx context.Context, userName, password string) (VaultUser, error) {
 	credentials := Credentials{}
 
-	client := &http.Client{
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
+	// The sign in page answers with a redirect carrying the tokens, which
+	// must be read rather than followed.
+	client := *v.client
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
 	}
 
 	params := url.Values{}
@@ -162,16 +477,27 @@ func Login(userName, password string) (VaultUser, error) {
 	params.Add("response_type", "id_token token")
 	params.Add("client_id", "keyforge-web-portal")
 	params.Add("state", "/")
-	params.Add("redirect_uri", "https://www.keyforgegame.com/authorize")
-	params.Add("nonce", "4HM~Z5f8")
+	params.Add("redirect_uri", v.BaseURL+"/authorize")
+	params.Add("nonce", vaultNonce)
+
+	loginForm := url.Values{}
+
+	for key, values := range params {
+		loginForm[key] = values
+	}
 
-	loginForm := params
 	loginForm.Add("login", userName)
 	loginForm.Add("password", password)
 
-	path := fmt.Sprintf("https://account.asmodee.net/en/signin?%s", params.Encode())
+	path := fmt.Sprintf("%s/en/signin?%s", v.AccountURL, params.Encode())
+	request := vaultRequest{
+		method:      "POST",
+		path:        path,
+		body:        []byte(loginForm.Encode()),
+		contentType: "application/x-www-form-urlencoded",
+	}
 
-	response, e := client.PostForm(path, loginForm)
+	response, _, e := v.send(ctx, &client, request)
 
 	if e != nil {
 		return VaultUser{}, e
@@ -180,7 +506,7 @@ func Login(userName, password string) (VaultUser, error) {
 	redirectLocation, e := response.Location()
 
 	if e != nil {
-		return VaultUser{}, e
+		return VaultUser{}, &VaultError{StatusCode: response.StatusCode, Path: "/en/signin", Err: ErrUnauthorized}
 	}
 
 	redirectLocation.RawQuery = redirectLocation.Fragment
@@ -188,67 +514,40 @@ func Login(userName, password string) (VaultUser, error) {
 
 	credentials.AccessToken = redirectParams.Get("access_token")
 	credentials.IDToken = redirectParams.Get("id_token")
-	credentials.Nonce = "4HM~Z5f8"
+	credentials.Nonce = vaultNonce
 
-	jsonObject, e := json.Marshal(&credentials)
-
-	if e != nil {
-		return VaultUser{}, e
+	if credentials.AccessToken == "" {
+		return VaultUser{}, &VaultError{StatusCode: response.StatusCode, Path: "/en/signin", Err: ErrUnauthorized}
 	}
 
-	path = fmt.Sprintf("https://www.keyforgegame.com/api/users/login/asmodee/")
-
-	contentLength := strconv.Itoa(len(jsonObject))
-	request, e := http.NewRequest("POST", path, bytes.NewBuffer(jsonObject))
-	request.Header.Set("Content-Type", "application/json")
-	request.Header.Set("Content-Length", contentLength)
+	jsonObject, e := json.Marshal(&credentials)
 
 	if e != nil {
 		return VaultUser{}, e
 	}
 
-	response, e = client.Do(request)
+	userResult := SearchVaultUserJSON{}
+	e = v.call(ctx, "POST", v.BaseURL+"/api/users/login/asmodee/", jsonObject, "", &userResult)
 
 	if e != nil {
 		return VaultUser{}, e
 	}
 
-	body, e := ioutil.ReadAll(response.Body)
-	defer response.Body.Close()
-
-	userResult := SearchVaultUserJSON{}
-	json.Unmarshal(body, &userResult)
-
 	userResult.Data.User.Token = userResult.Data.Token
 
 	return userResult.Data.User, nil
 }
 
-func SearchDecks(vaultUser *VaultUser, deckQuery *DeckQuery) (PartialDeckSearchJSON, error) {
-	client := &http.Client{}
-	authHeader := fmt.Sprintf("Token %s", vaultUser.Token)
+func (v *HTTPVaultClient) SearchDecks(ctx context.Context, vaultUser *VaultUser, deckQuery *DeckQuery) (PartialDeckSearchJSON, error) {
 	params, e := deckQuery.GetQueryString()
 
 	if e != nil {
 		return PartialDeckSearchJSON{}, e
 	}
 
-	path := fmt.Sprintf("https://www.keyforgegame.com/api/decks/?%s", params)
-
-	request, e := http.NewRequest("GET", path, nil)
-	request.Header.Add("Authorization", authHeader)
-
-	if e != nil {
-		return PartialDeckSearchJSON{}, e
-	}
-
-	response, e := client.Do(request)
-
-	body, e := ioutil.ReadAll(response.Body)
-	defer response.Body.Close()
-
 	result := PartialDeckSearchJSON{}
-	e = json.Unmarshal(body, &result)
+	path := fmt.Sprintf("%s/api/decks/?%s", v.BaseURL, params)
+	e = v.call(ctx, "GET", path, nil, vaultUser.Token, &result)
 
 	if e != nil {
 		return PartialDeckSearchJSON{}, e
@@ -257,26 +556,12 @@ func SearchDecks(vaultUser *VaultUser, deckQuery *DeckQuery) (PartialDeckSearchJ
 	return result, nil
 }
 
-func RetrieveDeck(vaultUser *VaultUser, deckID string) (Deck, error) {
+func (v *HTTPVaultClient) RetrieveDeck(ctx context.Context, vaultUser *VaultUser, deckID string) (Deck, error) {
 	newDeck := Deck{}
-	client := &http.Client{}
 	deckJSON := RetrieveDeckJSON{}
-	authHeader := fmt.Sprintf("Token %s", vaultUser.Token)
-	path := fmt.Sprintf("https://www.keyforgegame.com/api/decks/%s/?links=cards,notes", deckID)
-
-	request, e := http.NewRequest("GET", path, nil)
-	request.Header.Add("Authorization", authHeader)
-
-	if e != nil {
-		return Deck{}, e
-	}
-
-	response, e := client.Do(request)
-
-	body, e := ioutil.ReadAll(response.Body)
-	defer response.Body.Close()
+	path := fmt.Sprintf("%s/api/decks/%s/?links=cards,notes", v.BaseURL, url.PathEscape(deckID))
 
-	e = json.Unmarshal(body, &deckJSON)
+	e := v.call(ctx, "GET", path, nil, vaultUser.Token, &deckJSON)
 
 	if e != nil {
 		return Deck{}, e
@@ -286,7 +571,7 @@ func RetrieveDeck(vaultUser *VaultUser, deckID string) (Deck, error) {
 	newDeck.CasualWins = deckJSON.Deck.CasualWins
 	newDeck.Chains = deckJSON.Deck.Chains
 	newDeck.Expansion = deckJSON.Deck.Expansion
-	//newDeck.Houses = deckJSON.Deck.Houses
+	newDeck.Houses = deckJSON.Deck.Links.Houses
 	newDeck.ID = deckJSON.Deck.ID
 	newDeck.IsMyDeck = deckJSON.Deck.IsMyDeck
 	newDeck.IsMyFavorite = deckJSON.Deck.IsMyFavorite
@@ -309,56 +594,244 @@ func RetrieveDeck(vaultUser *VaultUser, deckID string) (Deck, error) {
 	return newDeck, nil
 }
 
-func RetrieveProfile(authToken string) (VaultUser, error) {
-	client := &http.Client{}
+func (v *HTTPVaultClient) RetrieveProfile(ctx context.Context, authToken string) (VaultUser, error) {
 	user := VaultUserResult{}
-	path := "https://www.keyforgegame.com/api/users/self"
-	authHeader := fmt.Sprintf("Token %s", authToken)
+	e := v.call(ctx, "GET", v.BaseURL+"/api/users/self", nil, authToken, &user)
 
-	request, e := http.NewRequest("GET", path, nil)
-	request.Header.Add("Authorization", authHeader)
+	if e != nil {
+		return VaultUser{}, e
+	}
+
+	user.Data.Token = authToken
+	return user.Data, nil
+}
+
+func (v *HTTPVaultClient) RetrieveDecksFromProfile(ctx context.Context, vaultUser *VaultUser) (PartialDeckSearchJSON, error) {
+	partialDeckJSON := PartialDeckSearchJSON{}
+	path := fmt.Sprintf("%s/api/users/%s/decks", v.BaseURL, url.PathEscape(vaultUser.ID))
+
+	e := v.call(ctx, "GET", path, nil, vaultUser.Token, &partialDeckJSON)
 
 	if e != nil {
-		return user.Data, e
+		return PartialDeckSearchJSON{}, e
 	}
 
-	response, e := client.Do(request)
+	return partialDeckJSON, nil
+}
 
-	body, e := ioutil.ReadAll(response.Body)
-	defer response.Body.Close()
+// vaultRequest - Everything needed to build a request afresh for each
+// attempt.
+type vaultRequest struct {
+	method      string
+	path        string
+	body        []byte
+	contentType string
+	token       string
+}
+
+// newRequest - Builds one attempt at a request, authorized with the API
+// token if one is given.
+func (r vaultRequest) newRequest(ctx context.Context) (*http.Request, error) {
+	var body io.Reader
+
+	if r.body != nil {
+		body = bytes.NewReader(r.body)
+	}
 
-	e = json.Unmarshal(body, &user)
+	request, e := http.NewRequestWithContext(ctx, r.method, r.path, body)
 
 	if e != nil {
-		return user.Data, e
+		return nil, e
 	}
 
-	return user.Data, nil
+	if r.contentType != "" {
+		request.Header.Set("Content-Type", r.contentType)
+	}
+
+	if r.token != "" {
+		request.Header.Set("Authorization", fmt.Sprintf("Token %s", r.token))
+	}
+
+	return request, nil
 }
 
-func RetrieveDecksFromProfile(vaultUser *VaultUser) (PartialDeckSearchJSON, error) {
-	client := &http.Client{}
-	path := fmt.Sprintf("https://www.keyforgegame.com/api/users/%s/decks", vaultUser.ID)
-	authHeader := fmt.Sprintf("Token %s", vaultUser.Token)
-	partialDeckJSON := PartialDeckSearchJSON{}
+// send - Sends a request, retrying as described on HTTPVaultClient, and
+// returns the final response along with its body, which has already been
+// read and closed. Redirects count as success so Login can read them.
+func (v *HTTPVaultClient) send(ctx context.Context, client *http.Client, request vaultRequest) (*http.Response, []byte, error) {
+	path := request.path
 
-	request, e := http.NewRequest("GET", path, nil)
-	request.Header.Add("Authorization", authHeader)
+	if parsed, e := url.Parse(request.path); e == nil {
+		path = parsed.Path
+	}
+
+	for attempt := 0; ; attempt++ {
+		e := v.Limiter.Wait(ctx)
+
+		if e != nil {
+			return nil, nil, &VaultError{Path: path, Err: e}
+		}
+
+		response, data, e := v.attempt(ctx, client, request)
+		var failure error
+		retryAfter := time.Duration(0)
+
+		switch {
+		case e != nil && ctx.Err() != nil:
+			return nil, nil, &VaultError{Path: path, Err: ctx.Err()}
+		case e != nil:
+			failure = &VaultError{Path: path, Err: fmt.Errorf("%w: %s", ErrVaultUnavailable, e.Error())}
+		case response.StatusCode >= 300 && response.StatusCode <= 399:
+			return response, data, nil
+		default:
+			status := vaultStatusError(response.StatusCode)
+
+			if status == nil {
+				return response, data, nil
+			}
+
+			failure = &VaultError{StatusCode: response.StatusCode, Path: path, Err: status}
+
+			if status != ErrRateLimited && status != ErrVaultUnavailable {
+				return nil, nil, failure
+			}
+
+			retryAfter = parseRetryAfter(response.Header.Get("Retry-After"))
+		}
+
+		if attempt >= v.MaxRetries {
+			return nil, nil, failure
+		}
+
+		e = sleepContext(ctx, v.backoff(attempt, retryAfter))
+
+		if e != nil {
+			return nil, nil, &VaultError{Path: path, Err: e}
+		}
+	}
+}
+
+// attempt - Makes a single attempt at a request, giving up once the
+// client's timeout passes.
+func (v *HTTPVaultClient) attempt(ctx context.Context, client *http.Client, request vaultRequest) (*http.Response, []byte, error) {
+	if v.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, v.Timeout)
+		defer cancel()
+	}
+
+	httpRequest, e := request.newRequest(ctx)
 
 	if e != nil {
-		return partialDeckJSON, e
+		return nil, nil, e
 	}
 
-	response, e := client.Do(request)
+	response, e := client.Do(httpRequest)
+
+	if e != nil {
+		return nil, nil, e
+	}
 
-	body, e := ioutil.ReadAll(response.Body)
 	defer response.Body.Close()
 
-	e = json.Unmarshal(body, &partialDeckJSON)
+	data, e := ioutil.ReadAll(response.Body)
 
 	if e != nil {
-		return partialDeckJSON, e
+		return nil, nil, e
 	}
 
-	return partialDeckJSON, nil
+	return response, data, nil
+}
+
+// backoff - Returns how long to wait before the retry following the given
+// attempt: RetryDelay doubled for every earlier attempt, plus up to half
+// again at random so clients don't retry in step, or the Vault's
+// Retry-After if that is longer.
+func (v *HTTPVaultClient) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	delay := v.RetryDelay << uint(attempt)
+
+	if delay <= 0 || delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+
+	if v.RetryDelay <= 0 {
+		delay = 0
+	}
+
+	if delay > 0 {
+		delay += time.Duration(rand.Int63n(int64(delay)/2 + 1))
+	}
+
+	if retryAfter > delay {
+		delay = retryAfter
+	}
+
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+
+	return delay
+}
+
+// parseRetryAfter - Reads a Retry-After header given in seconds or as a
+// date, returning zero if there is none.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, e := strconv.Atoi(value); e == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, e := http.ParseTime(value); e == nil {
+		return time.Until(date)
+	}
+
+	return 0
+}
+
+// call - Sends a JSON request to the Vault API and decodes the JSON answer
+// into result.
+func (v *HTTPVaultClient) call(ctx context.Context, method, path string, payload []byte, token string, result interface{}) error {
+	request := vaultRequest{method: method, path: path, body: payload, token: token}
+
+	if payload != nil {
+		request.contentType = "application/json"
+	}
+
+	_, data, e := v.send(ctx, v.client, request)
+
+	if e != nil {
+		return e
+	}
+
+	return json.Unmarshal(data, result)
+}
+
+// Login - Signs in to the real Vault. See VaultClient.
+func Login(ctx context.Context, userName, password string) (VaultUser, error) {
+	return DefaultVaultClient.Login(ctx, userName, password)
+}
+
+// SearchDecks - Searches the real Vault. See VaultClient.
+func SearchDecks(ctx context.Context, vaultUser *VaultUser, deckQuery *DeckQuery) (PartialDeckSearchJSON, error) {
+	return DefaultVaultClient.SearchDecks(ctx, vaultUser, deckQuery)
+}
+
+// RetrieveDeck - Retrieves a deck from the real Vault. See VaultClient.
+func RetrieveDeck(ctx context.Context, vaultUser *VaultUser, deckID string) (Deck, error) {
+	return DefaultVaultClient.RetrieveDeck(ctx, vaultUser, deckID)
+}
+
+// RetrieveProfile - Retrieves a profile from the real Vault. See
+// VaultClient.
+func RetrieveProfile(ctx context.Context, authToken string) (VaultUser, error) {
+	return DefaultVaultClient.RetrieveProfile(ctx, authToken)
+}
+
+// RetrieveDecksFromProfile - Lists a user's decks on the real Vault. See
+// VaultClient.
+func RetrieveDecksFromProfile(ctx context.Context, vaultUser *VaultUser) (PartialDeckSearchJSON, error) {
+	return DefaultVaultClient.RetrieveDecksFromProfile(ctx, vaultUser)
 }
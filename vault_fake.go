@@ -0,0 +1,436 @@
+package kfnetwork
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FakeVaultUser - A user known to a FakeVault, along with the password they
+// sign in with, the API token they are given and the IDs of their decks.
+type FakeVaultUser struct {
+	User     VaultUser `json:"user"`
+	Password string    `json:"password"`
+	Token    string    `json:"token"`
+	Decks    []string  `json:"decks"`
+}
+
+// FakeVaultFixture - The contents of a FakeVault, in the form read from
+// fixture files. Decks are stored as the Vault returns them from a deck
+// lookup, linked cards included.
+type FakeVaultFixture struct {
+	Users []FakeVaultUser    `json:"users"`
+	Decks []RetrieveDeckJSON `json:"decks"`
+}
+
+// FakeVault - An in-process stand-in for the KeyForge Vault and the Asmodee
+// account site, serving the handful of endpoints HTTPVaultClient uses from
+// fixture data. Use it to test logins and deck retrieval offline, and
+// FailNext to test how clients cope with an unreliable Vault.
+type FakeVault struct {
+	Server     *httptest.Server
+	vaultMutex sync.RWMutex
+	users      []FakeVaultUser
+	decks      map[string]RetrieveDeckJSON
+	deckOrder  []string
+	requests   int
+	failures   int
+	failStatus int
+	retryAfter string
+}
+
+// NewFakeVault - Starts an empty fake Vault. Call Close once finished.
+func NewFakeVault() *FakeVault {
+	vault := new(FakeVault)
+	vault.decks = make(map[string]RetrieveDeckJSON)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/en/signin", vault.handleSignIn)
+	mux.HandleFunc("/api/users/login/asmodee/", vault.handleLogin)
+	mux.HandleFunc("/api/users/self", vault.handleProfile)
+	mux.HandleFunc("/api/users/", vault.handleUserDecks)
+	mux.HandleFunc("/api/decks/", vault.handleDecks)
+
+	vault.Server = httptest.NewServer(vault.serve(mux))
+	return vault
+}
+
+// NewFakeVaultFromFile - Starts a fake Vault loaded with the users and decks
+// in a fixture file.
+func NewFakeVaultFromFile(path string) (*FakeVault, error) {
+	data, e := ioutil.ReadFile(path)
+
+	if e != nil {
+		return nil, e
+	}
+
+	fixture := FakeVaultFixture{}
+	e = json.Unmarshal(data, &fixture)
+
+	if e != nil {
+		return nil, e
+	}
+
+	vault := NewFakeVault()
+	vault.Load(fixture)
+	return vault, nil
+}
+
+// Load - Adds the users and decks in a fixture.
+func (f *FakeVault) Load(fixture FakeVaultFixture) {
+	for _, user := range fixture.Users {
+		f.AddUser(user)
+	}
+
+	for _, deck := range fixture.Decks {
+		f.AddDeck(deck)
+	}
+}
+
+// AddUser - Adds a user who can sign in and be looked up by token.
+func (f *FakeVault) AddUser(user FakeVaultUser) {
+	f.vaultMutex.Lock()
+	defer f.vaultMutex.Unlock()
+
+	f.users = append(f.users, user)
+}
+
+// AddDeck - Adds a deck which can be searched for and retrieved.
+func (f *FakeVault) AddDeck(deck RetrieveDeckJSON) {
+	f.vaultMutex.Lock()
+	defer f.vaultMutex.Unlock()
+
+	if _, ok := f.decks[deck.Deck.ID]; !ok {
+		f.deckOrder = append(f.deckOrder, deck.Deck.ID)
+	}
+
+	f.decks[deck.Deck.ID] = deck
+}
+
+// URL - Returns the address the fake Vault is listening on.
+func (f *FakeVault) URL() string {
+	return f.Server.URL
+}
+
+// Client - Returns a Vault client which talks to this fake, for both the
+// Vault and account site. It retries quickly and has no rate limit, to keep
+// tests fast.
+func (f *FakeVault) Client() *HTTPVaultClient {
+	client := NewHTTPVaultClient(f.URL(), f.Server.Client(), 5*time.Second)
+	client.AccountURL = f.URL()
+	client.RetryDelay = 10 * time.Millisecond
+	client.Limiter = nil
+	return client
+}
+
+// FailNext - Answers the next count requests with the given status instead
+// of serving them. If retryAfter isn't empty it is sent as the Retry-After
+// header.
+func (f *FakeVault) FailNext(count, status int, retryAfter string) {
+	f.vaultMutex.Lock()
+	defer f.vaultMutex.Unlock()
+
+	f.failures = count
+	f.failStatus = status
+	f.retryAfter = retryAfter
+}
+
+// Requests - Returns how many requests the fake Vault has received,
+// including failed ones.
+func (f *FakeVault) Requests() int {
+	f.vaultMutex.RLock()
+	defer f.vaultMutex.RUnlock()
+
+	return f.requests
+}
+
+// Close - Shuts the fake Vault down.
+func (f *FakeVault) Close() {
+	f.Server.Close()
+}
+
+// serve - Counts each request and fails it if FailNext asked for that,
+// passing the rest on to the handler.
+func (f *FakeVault) serve(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.vaultMutex.Lock()
+		f.requests++
+		failing := f.failures > 0
+		status := f.failStatus
+		retryAfter := f.retryAfter
+
+		if failing {
+			f.failures--
+		}
+
+		f.vaultMutex.Unlock()
+
+		if !failing {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		if retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+
+		http.Error(w, http.StatusText(status), status)
+	})
+}
+
+func (f *FakeVault) findUser(match func(user FakeVaultUser) bool) (FakeVaultUser, bool) {
+	f.vaultMutex.RLock()
+	defer f.vaultMutex.RUnlock()
+
+	for _, user := range f.users {
+		if match(user) {
+			return user, true
+		}
+	}
+
+	return FakeVaultUser{}, false
+}
+
+// authorized - Returns the user whose token the request carries.
+func (f *FakeVault) authorized(r *http.Request) (FakeVaultUser, bool) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Token ")
+
+	if token == "" {
+		return FakeVaultUser{}, false
+	}
+
+	return f.findUser(func(user FakeVaultUser) bool {
+		return user.Token == token
+	})
+}
+
+// handleSignIn - Checks the user name and password, redirecting back to the
+// Vault with an access token in the fragment as the account site does.
+func (f *FakeVault) handleSignIn(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	login := r.PostForm.Get("login")
+	password := r.PostForm.Get("password")
+
+	user, ok := f.findUser(func(user FakeVaultUser) bool {
+		return user.User.UserName == login && user.Password == password
+	})
+
+	location := r.URL.Query().Get("redirect_uri")
+
+	if ok {
+		fragment := url.Values{}
+		fragment.Set("access_token", "access-"+user.Token)
+		fragment.Set("id_token", "id-"+user.User.ID)
+		location += "#" + fragment.Encode()
+	}
+
+	http.Redirect(w, r, location, http.StatusFound)
+}
+
+// handleLogin - Exchanges an access token for the user and their API token.
+func (f *FakeVault) handleLogin(w http.ResponseWriter, r *http.Request) {
+	credentials := Credentials{}
+	e := json.NewDecoder(r.Body).Decode(&credentials)
+
+	if e != nil || r.Method != "POST" {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := f.findUser(func(user FakeVaultUser) bool {
+		return "access-"+user.Token == credentials.AccessToken
+	})
+
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	writeFakeVaultJSON(w, SearchVaultUserJSON{Data: SearchVaultUser{User: user.User, Token: user.Token}})
+}
+
+func (f *FakeVault) handleProfile(w http.ResponseWriter, r *http.Request) {
+	user, ok := f.authorized(r)
+
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	writeFakeVaultJSON(w, VaultUserResult{Data: user.User})
+}
+
+// handleUserDecks - Serves /api/users/<id>/decks.
+func (f *FakeVault) handleUserDecks(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/users/"), "/"), "/")
+
+	if len(parts) != 2 || parts[1] != "decks" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if _, ok := f.authorized(r); !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	owner, ok := f.findUser(func(user FakeVaultUser) bool {
+		return user.User.ID == parts[0]
+	})
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	f.vaultMutex.RLock()
+	decks := []PartialDeckJSON{}
+
+	for _, id := range owner.Decks {
+		if deck, ok := f.decks[id]; ok {
+			decks = append(decks, deck.Deck.PartialDeckJSON)
+		}
+	}
+
+	f.vaultMutex.RUnlock()
+
+	writeFakeVaultJSON(w, PartialDeckSearchJSON{Count: len(decks), Decks: decks})
+}
+
+// handleDecks - Serves both deck searches at /api/decks/ and single decks
+// at /api/decks/<id>/.
+func (f *FakeVault) handleDecks(w http.ResponseWriter, r *http.Request) {
+	if _, ok := f.authorized(r); !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/decks/"), "/")
+
+	if id != "" {
+		f.vaultMutex.RLock()
+		deck, ok := f.decks[id]
+		f.vaultMutex.RUnlock()
+
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		writeFakeVaultJSON(w, deck)
+		return
+	}
+
+	query := r.URL.Query()
+	search := strings.ToLower(query.Get("search"))
+	page, _ := strconv.Atoi(query.Get("page"))
+	pageSize, _ := strconv.Atoi(query.Get("page_size"))
+	expansion, _ := strconv.Atoi(query.Get("expansion"))
+	houses := []string{}
+
+	if query.Get("houses") != "" {
+		houses = strings.Split(query.Get("houses"), ",")
+	}
+
+	if page < 1 {
+		page = 1
+	}
+
+	if pageSize < 1 {
+		pageSize = 10
+	}
+
+	f.vaultMutex.RLock()
+	matches := []PartialDeckJSON{}
+
+	for _, id := range f.deckOrder {
+		deck := f.decks[id].Deck.PartialDeckJSON
+
+		if !strings.Contains(strings.ToLower(deck.Name), search) {
+			continue
+		}
+
+		if expansion != 0 && deck.Expansion != expansion {
+			continue
+		}
+
+		if !hasHouses(deck.Links.Houses, houses) {
+			continue
+		}
+
+		matches = append(matches, deck)
+	}
+
+	f.vaultMutex.RUnlock()
+
+	if query.Get("ordering") == "name" {
+		sort.SliceStable(matches, func(i, j int) bool {
+			return matches[i].Name < matches[j].Name
+		})
+	}
+
+	result := PartialDeckSearchJSON{Count: len(matches), Decks: []PartialDeckJSON{}}
+	start := (page - 1) * pageSize
+
+	if start < len(matches) {
+		end := start + pageSize
+
+		if end > len(matches) {
+			end = len(matches)
+		}
+
+		result.Decks = matches[start:end]
+	}
+
+	// Like the Vault, send the cards of the decks on this page along with
+	// them when asked to.
+	if query.Get("links") == "cards" {
+		f.vaultMutex.RLock()
+		seen := make(map[string]bool)
+
+		for _, deck := range result.Decks {
+			for _, card := range f.decks[deck.ID].Linked.Cards {
+				if !seen[card.ID] {
+					seen[card.ID] = true
+					result.Linked.Cards = append(result.Linked.Cards, card)
+				}
+			}
+		}
+
+		f.vaultMutex.RUnlock()
+	}
+
+	writeFakeVaultJSON(w, result)
+}
+
+// hasHouses - Determine whether a deck has every one of the wanted houses.
+func hasHouses(houses []string, wanted []string) bool {
+	for _, want := range wanted {
+		found := false
+
+		for _, house := range houses {
+			if strings.EqualFold(house, want) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+func writeFakeVaultJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,412 @@
+package kfnetwork
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// webSocketGUID - Magic value from RFC 6455 used to compute the
+// Sec-WebSocket-Accept header during the opening handshake.
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocketMaxMessageSize - Largest message we're willing to accept. Packets
+// sent over TCP can't carry more than a uint16 worth of payload, so the same
+// limit is applied to WebSocket clients.
+const WebSocketMaxMessageSize = 65535
+
+const (
+	webSocketOpContinuation byte = 0x0
+	webSocketOpText         byte = 0x1
+	webSocketOpBinary       byte = 0x2
+	webSocketOpClose        byte = 0x8
+	webSocketOpPing         byte = 0x9
+	webSocketOpPong         byte = 0xA
+)
+
+// WebSocketConnection - Connection implementation for WebSocket clients. Each
+// packet travels as a single message containing the same JSON payload that
+// RenderPacket decodes; the packet type is read from the "type" field rather
+// than from a binary header.
+type WebSocketConnection struct {
+	conn       net.Conn
+	reader     *bufio.Reader
+	writeMutex sync.Mutex
+	masked     bool
+}
+
+// UpgradeWebSocket - Performs the server side of the WebSocket opening
+// handshake and takes over the underlying connection. An HTTP error is
+// written to the response if the request isn't a valid upgrade request.
+func UpgradeWebSocket(w http.ResponseWriter, r *http.Request) (*WebSocketConnection, error) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return nil, errors.New("websocket upgrade requires a GET request")
+	}
+
+	if !headerContainsToken(r.Header, "Connection", "upgrade") || !headerContainsToken(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "upgrade required", http.StatusUpgradeRequired)
+		return nil, errors.New("request is not a websocket upgrade")
+	}
+
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusBadRequest)
+		return nil, errors.New("unsupported websocket version")
+	}
+
+	key := r.Header.Get("Sec-WebSocket-Key")
+
+	if len(key) == 0 {
+		http.Error(w, "missing websocket key", http.StatusBadRequest)
+		return nil, errors.New("missing Sec-WebSocket-Key header")
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+
+	if !ok {
+		http.Error(w, "websocket not supported", http.StatusInternalServerError)
+		return nil, errors.New("response writer does not support hijacking")
+	}
+
+	conn, buffer, e := hijacker.Hijack()
+
+	if e != nil {
+		return nil, e
+	}
+
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + webSocketAccept(key) + "\r\n\r\n"
+
+	_, e = conn.Write([]byte(response))
+
+	if e != nil {
+		conn.Close()
+		return nil, e
+	}
+
+	connection := new(WebSocketConnection)
+	connection.conn = conn
+	connection.reader = buffer.Reader
+	return connection, nil
+}
+
+// DialWebSocket - Opens a client WebSocket connection to the given ws:// URL.
+func DialWebSocket(address string) (*WebSocketConnection, error) {
+	location, e := url.Parse(address)
+
+	if e != nil {
+		return nil, e
+	}
+
+	if location.Scheme != "ws" {
+		return nil, fmt.Errorf("unsupported websocket scheme %q", location.Scheme)
+	}
+
+	host := location.Host
+
+	if len(location.Port()) == 0 {
+		host = net.JoinHostPort(location.Hostname(), "80")
+	}
+
+	conn, e := net.Dial("tcp", host)
+
+	if e != nil {
+		return nil, e
+	}
+
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	path := location.RequestURI()
+	request := fmt.Sprintf("GET %s HTTP/1.1\r\n"+
+		"Host: %s\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: %s\r\n"+
+		"Sec-WebSocket-Version: 13\r\n\r\n", path, location.Host, key)
+
+	_, e = conn.Write([]byte(request))
+
+	if e != nil {
+		conn.Close()
+		return nil, e
+	}
+
+	reader := bufio.NewReader(conn)
+	response, e := http.ReadResponse(reader, &http.Request{Method: http.MethodGet})
+
+	if e != nil {
+		conn.Close()
+		return nil, e
+	}
+
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusSwitchingProtocols {
+		conn.Close()
+		return nil, fmt.Errorf("websocket handshake failed with status %s", response.Status)
+	}
+
+	if response.Header.Get("Sec-WebSocket-Accept") != webSocketAccept(key) {
+		conn.Close()
+		return nil, errors.New("websocket handshake returned an invalid accept key")
+	}
+
+	connection := new(WebSocketConnection)
+	connection.conn = conn
+	connection.reader = reader
+	connection.masked = true
+	return connection, nil
+}
+
+// ReadMessage - Reads the next complete data message, reassembling
+// fragmented frames and answering control frames along the way.
+func (w *WebSocketConnection) ReadMessage() ([]byte, error) {
+	message := []byte{}
+	started := false
+
+	for {
+		fin, opcode, payload, e := w.readFrame()
+
+		if e != nil {
+			return nil, e
+		}
+
+		switch opcode {
+		case webSocketOpPing:
+			e = w.writeFrame(webSocketOpPong, payload)
+
+			if e != nil {
+				return nil, e
+			}
+			continue
+		case webSocketOpPong:
+			continue
+		case webSocketOpClose:
+			w.writeFrame(webSocketOpClose, payload)
+			return nil, io.EOF
+		case webSocketOpText, webSocketOpBinary:
+			if started {
+				return nil, errors.New("websocket data frame received mid-message")
+			}
+			started = true
+		case webSocketOpContinuation:
+			if !started {
+				return nil, errors.New("websocket continuation frame without a message")
+			}
+		default:
+			return nil, fmt.Errorf("unknown websocket opcode %d", opcode)
+		}
+
+		if len(message)+len(payload) > WebSocketMaxMessageSize {
+			return nil, errors.New("websocket message exceeds maximum size")
+		}
+
+		message = append(message, payload...)
+
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+// WriteMessage - Sends a single text message.
+func (w *WebSocketConnection) WriteMessage(message []byte) error {
+	return w.writeFrame(webSocketOpText, message)
+}
+
+// ReadPacket - Reads the next message and renders it as a packet. The packet
+// type is taken from the "type" field of the JSON payload.
+func (w *WebSocketConnection) ReadPacket() (Packet, error) {
+	var packet Packet
+
+	payload, e := w.ReadMessage()
+
+	if e != nil {
+		return packet, e
+	}
+
+	header := PacketHeader{}
+	e = json.Unmarshal(payload, &header)
+
+	if e != nil {
+		return packet, e
+	}
+
+	header.Length = uint16(len(payload))
+
+	return ParsePacket(header, payload)
+}
+
+// WritePacket - Sends a packet as a single JSON text message.
+func (w *WebSocketConnection) WritePacket(packet Packet) error {
+	payload, e := GetPacketPayload(packet)
+
+	if e != nil {
+		return e
+	}
+
+	return w.WriteMessage(payload)
+}
+
+// RemoteAddr - Returns the address of the remote end of the connection.
+func (w *WebSocketConnection) RemoteAddr() net.Addr {
+	return w.conn.RemoteAddr()
+}
+
+// SetReadDeadline - Sets the deadline for the next read on the connection.
+func (w *WebSocketConnection) SetReadDeadline(deadline time.Time) error {
+	return w.conn.SetReadDeadline(deadline)
+}
+
+// SetWriteDeadline - Sets the deadline for the next write on the connection.
+func (w *WebSocketConnection) SetWriteDeadline(deadline time.Time) error {
+	return w.conn.SetWriteDeadline(deadline)
+}
+
+// Close - Sends a close frame and closes the underlying connection.
+func (w *WebSocketConnection) Close() error {
+	w.writeFrame(webSocketOpClose, []byte{})
+	return w.conn.Close()
+}
+
+func (w *WebSocketConnection) readFrame() (bool, byte, []byte, error) {
+	head := make([]byte, 2)
+
+	_, e := io.ReadFull(w.reader, head)
+
+	if e != nil {
+		return false, 0, nil, e
+	}
+
+	fin := head[0]&0x80 != 0
+	opcode := head[0] & 0x0f
+	masked := head[1]&0x80 != 0
+	length := uint64(head[1] & 0x7f)
+
+	// Clients must mask every frame they send, servers must never mask.
+	if masked == w.masked {
+		return false, 0, nil, errors.New("websocket frame has an invalid mask bit")
+	}
+
+	switch length {
+	case 126:
+		extended := make([]byte, 2)
+
+		if _, e = io.ReadFull(w.reader, extended); e != nil {
+			return false, 0, nil, e
+		}
+
+		length = uint64(binary.BigEndian.Uint16(extended))
+	case 127:
+		extended := make([]byte, 8)
+
+		if _, e = io.ReadFull(w.reader, extended); e != nil {
+			return false, 0, nil, e
+		}
+
+		length = binary.BigEndian.Uint64(extended)
+	}
+
+	if length > WebSocketMaxMessageSize {
+		return false, 0, nil, errors.New("websocket frame exceeds maximum size")
+	}
+
+	mask := make([]byte, 4)
+
+	if masked {
+		if _, e = io.ReadFull(w.reader, mask); e != nil {
+			return false, 0, nil, e
+		}
+	}
+
+	payload := make([]byte, length)
+
+	if _, e = io.ReadFull(w.reader, payload); e != nil {
+		return false, 0, nil, e
+	}
+
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+
+	return fin, opcode, payload, nil
+}
+
+func (w *WebSocketConnection) writeFrame(opcode byte, payload []byte) error {
+	frame := []byte{0x80 | opcode}
+	length := len(payload)
+	maskBit := byte(0)
+
+	if w.masked {
+		maskBit = 0x80
+	}
+
+	switch {
+	case length < 126:
+		frame = append(frame, maskBit|byte(length))
+	case length <= 0xffff:
+		extended := make([]byte, 2)
+		binary.BigEndian.PutUint16(extended, uint16(length))
+		frame = append(frame, maskBit|126)
+		frame = append(frame, extended...)
+	default:
+		extended := make([]byte, 8)
+		binary.BigEndian.PutUint64(extended, uint64(length))
+		frame = append(frame, maskBit|127)
+		frame = append(frame, extended...)
+	}
+
+	if w.masked {
+		mask := make([]byte, 4)
+		rand.Read(mask)
+		frame = append(frame, mask...)
+
+		for i, b := range payload {
+			frame = append(frame, b^mask[i%4])
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+
+	w.writeMutex.Lock()
+	defer w.writeMutex.Unlock()
+
+	_, e := w.conn.Write(frame)
+	return e
+}
+
+func webSocketAccept(key string) string {
+	hash := sha1.Sum([]byte(key + webSocketGUID))
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+func headerContainsToken(header http.Header, name string, token string) bool {
+	for _, value := range header[http.CanonicalHeaderKey(name)] {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
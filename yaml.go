@@ -0,0 +1,544 @@
+package kfnetwork
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// YAMLToJSON - Converts a YAML document into JSON so it can be decoded with
+// the usual json struct tags. Only the subset of YAML needed for
+// configuration files is understood: nested mappings, block lists, flow
+// lists of scalars, comments, and plain, single or double quoted scalars.
+// Anchors, multi-line strings and multiple documents are not supported.
+// Unquoted scalars are guessed from how they look, so "yes" becomes true
+// and "42" a number; use YAMLToJSONFor when the target type is known.
+func YAMLToJSON(data []byte) ([]byte, error) {
+	return YAMLToJSONFor(data, nil)
+}
+
+// YAMLToJSONFor - Converts a YAML document into JSON for decoding into
+// target, which should be a pointer. Unquoted scalars are converted by the
+// type of the field they will be decoded into, so an unquoted "yes" or
+// "1234" stays a string when it is read into a string field. Where the type
+// isn't known, such as interface{} fields and types which decode their own
+// JSON, they are guessed as YAMLToJSON does.
+func YAMLToJSONFor(data []byte, target interface{}) ([]byte, error) {
+	parser, e := newYAMLParser(string(data))
+
+	if e != nil {
+		return nil, e
+	}
+
+	if len(parser.lines) == 0 {
+		return []byte("{}"), nil
+	}
+
+	value, e := parser.parseNode(parser.lines[0].indent)
+
+	if e != nil {
+		return nil, e
+	}
+
+	if parser.position < len(parser.lines) {
+		line := parser.lines[parser.position]
+		return nil, fmt.Errorf("line %d: unexpected indentation", line.number)
+	}
+
+	var targetType reflect.Type
+
+	if target != nil {
+		targetType = reflect.TypeOf(target)
+	}
+
+	value, e = resolveYAML(value, targetType)
+
+	if e != nil {
+		return nil, e
+	}
+
+	return json.Marshal(value)
+}
+
+// yamlPlain - An unquoted scalar, kept as written until the type it is
+// decoded into is known.
+type yamlPlain struct {
+	text   string
+	number int
+}
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// resolveYAML - Converts the unquoted scalars in a parsed document by the
+// types they will be decoded into. A nil type means it isn't known.
+func resolveYAML(value interface{}, target reflect.Type) (interface{}, error) {
+	for target != nil && target.Kind() == reflect.Ptr {
+		target = target.Elem()
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			resolved, e := resolveYAML(item, yamlFieldType(target, key))
+
+			if e != nil {
+				return nil, e
+			}
+
+			v[key] = resolved
+		}
+
+		return v, nil
+	case []interface{}:
+		var element reflect.Type
+
+		if target != nil && (target.Kind() == reflect.Slice || target.Kind() == reflect.Array) {
+			element = target.Elem()
+		}
+
+		for i, item := range v {
+			resolved, e := resolveYAML(item, element)
+
+			if e != nil {
+				return nil, e
+			}
+
+			v[i] = resolved
+		}
+
+		return v, nil
+	case yamlPlain:
+		return resolveYAMLScalar(v, target)
+	}
+
+	return value, nil
+}
+
+// yamlFieldType - Returns the type of the value stored under key, matching
+// struct fields by their json tag as encoding/json does, or nil if it isn't
+// known.
+func yamlFieldType(target reflect.Type, key string) reflect.Type {
+	if target == nil {
+		return nil
+	}
+
+	switch target.Kind() {
+	case reflect.Map:
+		return target.Elem()
+	case reflect.Struct:
+		for i := 0; i < target.NumField(); i++ {
+			field := target.Field(i)
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+
+			if name == "-" || field.PkgPath != "" {
+				continue
+			}
+
+			if name == "" {
+				name = field.Name
+			}
+
+			if strings.EqualFold(name, key) {
+				return field.Type
+			}
+		}
+	}
+
+	return nil
+}
+
+// resolveYAMLScalar - Converts an unquoted scalar for a value of the given
+// type.
+func resolveYAMLScalar(scalar yamlPlain, target reflect.Type) (interface{}, error) {
+	switch strings.ToLower(scalar.text) {
+	case "~", "null":
+		return nil, nil
+	}
+
+	if target == nil || target.Kind() == reflect.Interface || reflect.PtrTo(target).Implements(jsonUnmarshalerType) {
+		return guessYAMLScalar(scalar.text), nil
+	}
+
+	// encoding/json only hands strings to UnmarshalText.
+	if reflect.PtrTo(target).Implements(textUnmarshalerType) {
+		return scalar.text, nil
+	}
+
+	switch target.Kind() {
+	case reflect.String:
+		return scalar.text, nil
+	case reflect.Bool:
+		switch strings.ToLower(scalar.text) {
+		case "true", "yes", "on":
+			return true, nil
+		case "false", "no", "off":
+			return false, nil
+		}
+
+		return nil, fmt.Errorf("line %d: %q is not true or false", scalar.number, scalar.text)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		integer, e := strconv.ParseInt(scalar.text, 10, 64)
+
+		if e != nil {
+			return nil, fmt.Errorf("line %d: %q is not a whole number", scalar.number, scalar.text)
+		}
+
+		return integer, nil
+	case reflect.Float32, reflect.Float64:
+		float, e := strconv.ParseFloat(scalar.text, 64)
+
+		if e != nil {
+			return nil, fmt.Errorf("line %d: %q is not a number", scalar.number, scalar.text)
+		}
+
+		return float, nil
+	}
+
+	return guessYAMLScalar(scalar.text), nil
+}
+
+type yamlLine struct {
+	number int
+	indent int
+	text   string
+}
+
+type yamlParser struct {
+	lines    []yamlLine
+	position int
+}
+
+func newYAMLParser(document string) (*yamlParser, error) {
+	parser := new(yamlParser)
+
+	for i, raw := range strings.Split(strings.ReplaceAll(document, "\r\n", "\n"), "\n") {
+		text := strings.TrimRight(stripYAMLComment(raw), " \t")
+		trimmed := strings.TrimLeft(text, " ")
+
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", i+1)
+		}
+
+		parser.lines = append(parser.lines, yamlLine{number: i + 1, indent: len(text) - len(trimmed), text: trimmed})
+	}
+
+	return parser, nil
+}
+
+// stripYAMLComment - Removes a trailing comment, leaving any # inside quotes
+// alone.
+func stripYAMLComment(line string) string {
+	var quote byte
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+
+	return line
+}
+
+func isYAMLListItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func (p *yamlParser) parseNode(indent int) (interface{}, error) {
+	if isYAMLListItem(p.lines[p.position].text) {
+		return p.parseList(indent)
+	}
+
+	return p.parseMap(indent)
+}
+
+func (p *yamlParser) parseMap(indent int) (interface{}, error) {
+	object := make(map[string]interface{})
+
+	for p.position < len(p.lines) {
+		line := p.lines[p.position]
+
+		if line.indent < indent || (line.indent == indent && isYAMLListItem(line.text)) {
+			break
+		}
+
+		if line.indent > indent {
+			return nil, fmt.Errorf("line %d: unexpected indentation", line.number)
+		}
+
+		key, rest, e := splitYAMLKey(line)
+
+		if e != nil {
+			return nil, e
+		}
+
+		if _, ok := object[key]; ok {
+			return nil, fmt.Errorf("line %d: duplicate key %q", line.number, key)
+		}
+
+		p.position++
+
+		if rest != "" {
+			object[key], e = parseYAMLScalar(rest, line.number)
+
+			if e != nil {
+				return nil, e
+			}
+
+			continue
+		}
+
+		object[key] = nil
+
+		if p.position < len(p.lines) {
+			next := p.lines[p.position]
+
+			// A list may sit at the same indentation as its key.
+			if next.indent > indent || (next.indent == indent && isYAMLListItem(next.text)) {
+				object[key], e = p.parseNode(next.indent)
+
+				if e != nil {
+					return nil, e
+				}
+			}
+		}
+	}
+
+	return object, nil
+}
+
+func (p *yamlParser) parseList(indent int) (interface{}, error) {
+	list := []interface{}{}
+
+	for p.position < len(p.lines) {
+		line := p.lines[p.position]
+
+		if line.indent != indent || !isYAMLListItem(line.text) {
+			if line.indent > indent {
+				return nil, fmt.Errorf("line %d: unexpected indentation", line.number)
+			}
+
+			break
+		}
+
+		item := strings.TrimLeft(strings.TrimPrefix(line.text, "-"), " ")
+
+		if item == "" {
+			p.position++
+
+			if p.position < len(p.lines) && p.lines[p.position].indent > indent {
+				value, e := p.parseNode(p.lines[p.position].indent)
+
+				if e != nil {
+					return nil, e
+				}
+
+				list = append(list, value)
+			} else {
+				list = append(list, nil)
+			}
+
+			continue
+		}
+
+		if _, _, e := splitYAMLKey(yamlLine{number: line.number, text: item}); e == nil && !isYAMLFlow(item) {
+			// "- key: value" starts a mapping whose other keys line up
+			// with the first one, so treat the item as its own line.
+			p.lines[p.position] = yamlLine{number: line.number, indent: line.indent + len(line.text) - len(item), text: item}
+
+			value, e := p.parseNode(p.lines[p.position].indent)
+
+			if e != nil {
+				return nil, e
+			}
+
+			list = append(list, value)
+			continue
+		}
+
+		value, e := parseYAMLScalar(item, line.number)
+
+		if e != nil {
+			return nil, e
+		}
+
+		list = append(list, value)
+		p.position++
+	}
+
+	return list, nil
+}
+
+// splitYAMLKey - Splits "key: value" into its key and value. The value is
+// empty when it is given on the following lines.
+func splitYAMLKey(line yamlLine) (string, string, error) {
+	text := line.text
+	var quote byte
+
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+
+		if quote != 0 {
+			if c == quote {
+				quote = 0
+			}
+
+			continue
+		}
+
+		if c == '"' || c == '\'' {
+			quote = c
+			continue
+		}
+
+		if c == ':' && (i == len(text)-1 || text[i+1] == ' ') {
+			key := strings.TrimSpace(text[:i])
+
+			if key == "" {
+				break
+			}
+
+			if key[0] == '"' || key[0] == '\'' {
+				unquoted, e := parseYAMLScalar(key, line.number)
+
+				if e != nil {
+					return "", "", e
+				}
+
+				key = fmt.Sprint(unquoted)
+			}
+
+			return key, strings.TrimSpace(text[i+1:]), nil
+		}
+	}
+
+	return "", "", fmt.Errorf("line %d: expected \"key: value\"", line.number)
+}
+
+func isYAMLFlow(text string) bool {
+	return strings.HasPrefix(text, "[") || strings.HasPrefix(text, "{") || strings.HasPrefix(text, "\"") || strings.HasPrefix(text, "'")
+}
+
+func parseYAMLScalar(text string, number int) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(text, "\""):
+		value, e := strconv.Unquote(text)
+
+		if e != nil {
+			return nil, fmt.Errorf("line %d: invalid quoted string %s", number, text)
+		}
+
+		return value, nil
+	case strings.HasPrefix(text, "'"):
+		if len(text) < 2 || !strings.HasSuffix(text, "'") {
+			return nil, fmt.Errorf("line %d: invalid quoted string %s", number, text)
+		}
+
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	case strings.HasPrefix(text, "["):
+		return parseYAMLFlowList(text, number)
+	case text == "{}":
+		return map[string]interface{}{}, nil
+	case strings.HasPrefix(text, "{"):
+		return nil, fmt.Errorf("line %d: flow mappings are not supported", number)
+	}
+
+	return yamlPlain{text: text, number: number}, nil
+}
+
+// guessYAMLScalar - Converts an unquoted scalar by how it looks.
+func guessYAMLScalar(text string) interface{} {
+	switch strings.ToLower(text) {
+	case "~", "null":
+		return nil
+	case "true", "yes", "on":
+		return true
+	case "false", "no", "off":
+		return false
+	}
+
+	if integer, e := strconv.ParseInt(text, 10, 64); e == nil {
+		return integer
+	}
+
+	if float, e := strconv.ParseFloat(text, 64); e == nil {
+		return float
+	}
+
+	return text
+}
+
+func parseYAMLFlowList(text string, number int) (interface{}, error) {
+	if !strings.HasSuffix(text, "]") {
+		return nil, fmt.Errorf("line %d: unterminated list %s", number, text)
+	}
+
+	list := []interface{}{}
+	inner := strings.TrimSpace(text[1 : len(text)-1])
+
+	if inner == "" {
+		return list, nil
+	}
+
+	start := 0
+	var quote byte
+
+	for i := 0; i <= len(inner); i++ {
+		if i < len(inner) {
+			c := inner[i]
+
+			if quote != 0 {
+				if c == quote {
+					quote = 0
+				}
+
+				continue
+			}
+
+			if c == '"' || c == '\'' {
+				quote = c
+				continue
+			}
+
+			if c == '[' || c == '{' {
+				return nil, fmt.Errorf("line %d: nested flow collections are not supported", number)
+			}
+
+			if c != ',' {
+				continue
+			}
+		}
+
+		value, e := parseYAMLScalar(strings.TrimSpace(inner[start:i]), number)
+
+		if e != nil {
+			return nil, e
+		}
+
+		list = append(list, value)
+		start = i + 1
+	}
+
+	return list, nil
+}